@@ -7,12 +7,20 @@ import (
 	"os"
 	"time"
 
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-redis/redis/v8"
 	"github.com/jackc/pgx/v5/pgxpool"
-	amqp "github.com/rabbitmq/amqp091-go"
 
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/env"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/notify"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/oidc"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/publisher"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/server"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/worker"
 )
 
 func main() {
@@ -28,24 +36,110 @@ func main() {
 	// Conexão Redis
 	rdb := redis.NewClient(&redis.Options{Addr: os.Getenv("REDIS_URL")})
 
-	// JWTAuth
-	jwtAuth := jwtauth.New("HS256", []byte(os.Getenv("JWT_SECRET")), nil)
+	// JWT: configuração lida uma única vez; as chaves são compartilhadas pelas instâncias via banco
+	jwtConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := jwtConfig.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	tokens := auth.NewTokens(jwtConfig, auth.NewKeySet())
+	keySvc := service.NewSigningKeyService(
+		repository.NewSigningKeyRepository(pool),
+		tokens,
+		mustDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+	)
+	if err := keySvc.Refresh(ctx); err != nil {
+		log.Fatal(err)
+	}
+	go worker.NewKeyRotator(keySvc, time.Minute).Run(context.Background())
 
-	// RabbitMQ
-	rabbitURL := os.Getenv("RABBITMQ_URL")
-	conn, _ := amqp.Dial(rabbitURL)
-	ch, _ := conn.Channel()
+	// RabbitMQ: o publisher conecta (e reconecta) em segundo plano; até lá a outbox acumula os eventos
+	encoding, err := publisher.ParseEncoding(os.Getenv("EVENT_ENCODING"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	events := publisher.NewRabbitPublisher(publisher.Config{
+		URL:            os.Getenv("RABBITMQ_URL"),
+		Exchange:       env.String("RABBITMQ_EXCHANGE", "user.events"),
+		Queue:          "user.queue",
+		ConfirmTimeout: mustDuration("RABBITMQ_CONFIRM_TIMEOUT", 5*time.Second),
+		Encoding:       encoding,
+	})
+
+	notifier, err := notify.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	passwords, err := password.PolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	oidcProviders, err := oidc.ProvidersFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	logins, err := loginguard.PolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	forgot, err := loginguard.ForgotPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	srv, err := server.New(
 		server.WithDB(pool),
 		server.WithRedis(rdb),
-		server.WithJWTAuth(jwtAuth),
-		server.WithRabbit(conn, ch),
+		server.WithTokens(tokens),
+		server.WithPasswordPolicy(passwords),
+		server.WithOIDCProviders(oidcProviders),
+		server.WithLoginPolicy(logins),
+		server.WithForgotPolicy(forgot),
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// Envio dos tokens de redefinição de senha pedidos em POST /auth/password/forgot
+	resets := worker.NewPasswordResetSender(
+		service.NewPasswordResetSender(repository.NewUserRepository(pool), repository.NewPasswordResetRepository(pool), notifier),
+		mustDuration("PASSWORD_RESET_SEND_INTERVAL", time.Second),
+	)
+	go resets.Run(context.Background())
+
+	// Expurgo da lixeira de frutas
+	purger := worker.NewFruitPurger(
+		service.NewFruitService(repository.NewFruitRepository(pool)),
+		repository.NewTenantRepository(pool),
+		mustDuration("FRUIT_TRASH_RETENTION", 30*24*time.Hour),
+		mustDuration("FRUIT_PURGE_INTERVAL", time.Hour),
+	)
+	go purger.Run(context.Background())
+
+	// Relay da outbox: publica na user.queue os eventos gravados junto com cada alteração de usuário
+	outbox := service.NewOutboxService(repository.NewOutboxRepository(pool), events)
+	relay := worker.NewOutboxRelay(outbox, mustDuration("OUTBOX_RELAY_INTERVAL", time.Second))
+	go relay.Run(context.Background())
+
+	// Expurgo dos eventos da outbox já publicados
+	outboxPurger := worker.NewOutboxPurger(
+		outbox,
+		mustDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+		mustDuration("OUTBOX_PURGE_INTERVAL", time.Hour),
+	)
+	go outboxPurger.Run(context.Background())
+
 	log.Println("Server running on :8080")
-	http.ListenAndServe(":8080", srv.Router)
+	log.Fatal(http.ListenAndServe(":8080", srv.Router))
+}
+
+// mustDuration lê a duração key com env.Duration e encerra o processo se ela for inválida
+func mustDuration(key string, def time.Duration) time.Duration {
+	d, err := env.Duration(key, def)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return d
 }
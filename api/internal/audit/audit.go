@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Tipos de evento de auditoria
+const (
+	LoginLocked   = "login.locked"
+	LoginUnlocked = "login.unlocked"
+)
+
+// Event registra uma ação relevante para segurança
+type Event struct {
+	Type      string            `json:"type"`
+	At        time.Time         `json:"at"`
+	Actor     string            `json:"actor,omitempty"`
+	Subject   string            `json:"subject,omitempty"`
+	IP        string            `json:"ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Logger é o destino dos eventos de auditoria
+type Logger interface {
+	Record(ctx context.Context, e Event)
+}
+
+// LogLogger escreve os eventos como JSON no log padrão
+type LogLogger struct{}
+
+func (LogLogger) Record(ctx context.Context, e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	if e.RequestID == "" {
+		e.RequestID = middleware.GetReqID(ctx)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	log.Printf("audit %s", b)
+}
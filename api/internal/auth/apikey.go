@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// APIKeyScheme é o esquema do cabeçalho Authorization usado pelas chaves de API
+const APIKeyScheme = "ApiKey"
+
+// ErrInvalidAPIKey cobre chave malformada, desconhecida, expirada ou revogada;
+// o cliente recebe sempre a mesma resposta
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIClient é o cliente autenticado por uma chave de API
+type APIClient struct {
+	KeyID    string
+	Name     string
+	TenantID uuid.UUID
+	Scopes   []string
+}
+
+// APIKeyAuthenticator valida a chave enviada em Authorization: ApiKey <chave>
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (APIClient, error)
+}
+
+type apiClientKey struct{}
+
+// CurrentAPIClient devolve o cliente autenticado por chave de API, se houver
+func CurrentAPIClient(ctx context.Context) (APIClient, bool) {
+	c, ok := ctx.Value(apiClientKey{}).(APIClient)
+	return c, ok
+}
+
+// APIKeyOr aceita Authorization: ApiKey <chave> e, para qualquer outra requisição,
+// aplica a cadeia jwt (Verifier, MustAuth, NotRevoked, TenantFromToken). As permissões
+// de um cliente por chave são os escopos da chave, conferidos por RequirePermission,
+// e a loja é a da chave.
+func APIKeyOr(keys APIKeyAuthenticator, jwt ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		viaJWT := next
+		for i := len(jwt) - 1; i >= 0; i-- {
+			viaJWT = jwt[i](viaJWT)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, ok := apiKeyFromHeader(r)
+			if !ok {
+				viaJWT.ServeHTTP(w, r)
+				return
+			}
+			client, err := keys.AuthenticateAPIKey(r.Context(), raw)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				w.Header().Set("WWW-Authenticate", APIKeyScheme)
+				problem.Error(w, r, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if err != nil {
+				log.Printf("api key lookup failed: %v", err)
+				problem.Error(w, r, http.StatusServiceUnavailable, "api key check unavailable")
+				return
+			}
+			ctx := tenant.WithID(context.WithValue(r.Context(), apiClientKey{}, client), client.TenantID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func apiKeyFromHeader(r *http.Request) (string, bool) {
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, APIKeyScheme) {
+		return "", false
+	}
+	return strings.TrimSpace(key), true
+}
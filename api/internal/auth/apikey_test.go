@@ -0,0 +1,73 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+)
+
+// fakeAPIKeys aceita as chaves mapeadas para seus escopos
+type fakeAPIKeys struct {
+	scopes map[string][]string
+	err    error
+}
+
+func (f fakeAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (auth.APIClient, error) {
+	if f.err != nil {
+		return auth.APIClient{}, f.err
+	}
+	scopes, ok := f.scopes[key]
+	if !ok {
+		return auth.APIClient{}, auth.ErrInvalidAPIKey
+	}
+	return auth.APIClient{KeyID: "k1", Name: "pos", Scopes: scopes}, nil
+}
+
+func TestAPIKeyOr(t *testing.T) {
+	ks := auth.NewKeySet()
+	if err := ks.Load([]auth.Key{generateKey(t, auth.AlgEdDSA, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewTokens(testConfig, ks)
+	jwt, err := tokens.Issue("u1", []string{"editor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := fakeAPIKeys{scopes: map[string][]string{"fsk_reader": {"fruits:read"}}}
+	resolver := fakeResolver{perms: map[string][]string{"editor": {"fruits:read", "fruits:write"}}}
+
+	cases := []struct {
+		name   string
+		header string
+		keys   fakeAPIKeys
+		perm   string
+		want   int
+	}{
+		{"chave com o escopo", "ApiKey fsk_reader", keys, "fruits:read", http.StatusOK},
+		{"chave sem o escopo", "ApiKey fsk_reader", keys, "fruits:write", http.StatusForbidden},
+		{"chave desconhecida", "ApiKey fsk_other", keys, "fruits:read", http.StatusUnauthorized},
+		{"falha ao consultar", "ApiKey fsk_reader", fakeAPIKeys{err: errors.New("db down")}, "fruits:read", http.StatusServiceUnavailable},
+		{"JWT continua aceito", "Bearer " + jwt, keys, "fruits:write", http.StatusOK},
+		{"sem credencial", "", keys, "fruits:read", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			h := auth.APIKeyOr(tc.keys, tokens.Verifier, auth.MustAuth)(auth.RequirePermission(resolver, tc.perm)(ok))
+			req := httptest.NewRequest(http.MethodGet, "/fruits", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("esperado %d, recebeu %d", tc.want, rec.Code)
+			}
+		})
+	}
+}
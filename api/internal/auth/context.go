@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// UserID devolve o ID do usuário autenticado (claim sub)
+func UserID(ctx context.Context) (uuid.UUID, bool) {
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	sub, _ := claims["sub"].(string)
+	id, err := uuid.Parse(sub)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// SessionID devolve a sessão do token autenticado (claim sid)
+func SessionID(ctx context.Context) (uuid.UUID, bool) {
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	sid, _ := claims["sid"].(string)
+	id, err := uuid.Parse(sid)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// TenantFromToken leva a loja do token (claim tid) ao contexto lido pelos repositórios;
+// deve vir depois de MustAuth. Tokens sem loja são recusados.
+func TenantFromToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, err := jwtauth.FromContext(r.Context())
+		tid, _ := claims["tid"].(string)
+		id, perr := uuid.Parse(tid)
+		if err != nil || perr != nil {
+			problem.Error(w, r, http.StatusUnauthorized, "token without tenant")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), id)))
+	})
+}
+
+// CurrentToken devolve o jti e a expiração do token autenticado
+func CurrentToken(ctx context.Context) (jti string, expiresAt time.Time, ok bool) {
+	token, _, err := jwtauth.FromContext(ctx)
+	if err != nil || token == nil {
+		return "", time.Time{}, false
+	}
+	return token.JwtID(), token.Expiration(), true
+}
+
+// Roles devolve os papéis do token autenticado (claim roles)
+func Roles(ctx context.Context) []string {
+	_, claims, err := jwtauth.FromContext(ctx)
+	if err != nil {
+		return nil
+	}
+	list, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			roles = append(roles, s)
+		}
+	}
+	return roles
+}
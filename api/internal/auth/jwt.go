@@ -1,28 +1,165 @@
 package auth
 
 import (
-	"os"
+	"errors"
+	"net/http"
 	"time"
 
+	"github.com/go-chi/jwtauth/v5"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	jwxt "github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/env"
 )
 
-var secretKey = []byte(os.Getenv("JWT_SECRET"))
+// iat, nbf e exp levam milissegundos, para o iat ser comparado com RevokeUser sem revogar o
+// token renovado no mesmo segundo. O jwx lê esses valores como float64, que erra na última casa
+// (.182 vira .18199…); por isso a leitura guarda microssegundos e IsRevoked arredonda.
+const (
+	numericDateFormatPrecision = 3
+	numericDateParsePrecision  = 6
+)
+
+// init vale para as duas bibliotecas: golang-jwt assina e jwx lê os tokens
+func init() {
+	jwt.TimePrecision = time.Millisecond
+	jwxt.Settings(
+		jwxt.WithNumericDateParsePrecision(numericDateParsePrecision),
+		jwxt.WithNumericDateFormatPrecision(numericDateFormatPrecision),
+	)
+}
+
+// Config reúne toda a configuração dos JWT; é lida uma única vez e injetada em Tokens
+type Config struct {
+	Issuer     string        // claim iss, exigida na verificação
+	Audience   string        // claim aud, exigida na verificação
+	Algorithm  string        // AlgEdDSA ou AlgRS256, usado nas chaves novas
+	AccessTTL  time.Duration // validade do access token
+	RefreshTTL time.Duration // validade do refresh token
+	Leeway     time.Duration // tolerância a relógios dessincronizados em exp, nbf e iat
+}
+
+// ConfigFromEnv lê JWT_ISSUER, JWT_AUDIENCE, JWT_ALG, ACCESS_TOKEN_TTL e REFRESH_TOKEN_TTL
+func ConfigFromEnv() (Config, error) {
+	c := Config{
+		Issuer:    env.String("JWT_ISSUER", "fruit-store-api"),
+		Audience:  env.String("JWT_AUDIENCE", "fruit-store"),
+		Algorithm: env.String("JWT_ALG", AlgEdDSA),
+		Leeway:    30 * time.Second,
+	}
+	var err error
+	if c.AccessTTL, err = env.Duration("ACCESS_TOKEN_TTL", 15*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if c.RefreshTTL, err = env.Duration("REFRESH_TOKEN_TTL", 30*24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// Validate rejeita configurações que deixariam os tokens sem verificação de origem
+func (c Config) Validate() error {
+	if c.Issuer == "" || c.Audience == "" {
+		return errors.New("jwt issuer and audience are required")
+	}
+	if _, err := signingMethod(c.Algorithm); err != nil {
+		return err
+	}
+	if c.AccessTTL <= 0 || c.RefreshTTL <= 0 {
+		return errors.New("jwt token TTLs must be positive")
+	}
+	return nil
+}
 
 type Claims struct {
-	Sub  string `json:"sub"`
-	Role string `json:"role"`
+	Sub   string   `json:"sub"`
+	Roles []string `json:"roles"`
+	// Tid é a loja (tenant) do usuário
+	Tid string `json:"tid,omitempty"`
+	// Sid é a sessão (família de refresh tokens) que emitiu o token
+	Sid string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID, role string) (string, error) {
+// Tokens emite e verifica os access tokens com uma única Config e um único KeySet
+type Tokens struct {
+	cfg  Config
+	keys *KeySet
+}
+
+func NewTokens(cfg Config, keys *KeySet) *Tokens {
+	return &Tokens{cfg: cfg, keys: keys}
+}
+
+func (t *Tokens) Config() Config { return t.cfg }
+func (t *Tokens) Keys() *KeySet  { return t.keys }
+
+// Issue emite um access token de curta duração (AccessTTL).
+// O jti identifica o token na denylist e o iat permite revogar todos os tokens de um usuário.
+// As permissões dos papéis são resolvidas a cada requisição por RequirePermission.
+func (t *Tokens) Issue(userID string, roles []string) (string, error) {
+	return t.IssueSubject(Subject{UserID: userID, Roles: roles})
+}
+
+// Subject é o titular de um access token
+type Subject struct {
+	UserID   string
+	TenantID string
+	// SessionID é a família de refresh tokens que emitiu o token
+	SessionID string
+	Roles     []string
+}
+
+// IssueSubject emite um access token com a loja (tid) e a sessão (sid) do titular
+func (t *Tokens) IssueSubject(s Subject) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		Sub:  userID,
-		Role: role,
+		Sub:   s.UserID,
+		Roles: s.Roles,
+		Tid:   s.TenantID,
+		Sid:   s.SessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        uuid.NewString(),
+			Issuer:    t.cfg.Issuer,
+			Audience:  jwt.ClaimStrings{t.cfg.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.cfg.AccessTTL)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+	return t.keys.sign(claims, now)
+}
+
+// Verifier substitui jwtauth.Verifier: escolhe a chave pelo kid do cabeçalho, exige
+// iss, aud e nbf e deixa o token (ou o erro) no contexto lido por jwtauth.FromContext
+func (t *Tokens) Verifier(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := t.verifyRequest(r)
+		next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+	})
+}
+
+func (t *Tokens) verifyRequest(r *http.Request) (jwxt.Token, error) {
+	raw := jwtauth.TokenFromHeader(r)
+	if raw == "" {
+		raw = jwtauth.TokenFromCookie(r)
+	}
+	if raw == "" {
+		return nil, jwtauth.ErrNoTokenFound
+	}
+	token, err := jwxt.Parse([]byte(raw), jwxt.WithKeySet(t.keys.publicSet()), jwxt.WithValidate(false))
+	if err != nil {
+		return nil, jwtauth.ErrorReason(err)
+	}
+	err = jwxt.Validate(token,
+		jwxt.WithIssuer(t.cfg.Issuer),
+		jwxt.WithAudience(t.cfg.Audience),
+		jwxt.WithRequiredClaim(jwxt.NotBeforeKey),
+		jwxt.WithAcceptableSkew(t.cfg.Leeway),
+	)
+	if err != nil {
+		return token, jwtauth.ErrorReason(err)
+	}
+	return token, nil
 }
@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+)
+
+// signWith assina claims arbitrárias com a chave k, como faria um emissor mal configurado
+func signWith(t *testing.T, k auth.Key, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = k.ID
+	s, err := token.SignedString(k.Private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestTokens_ValidatesIssuerAudienceAndNotBefore(t *testing.T) {
+	key := generateKey(t, auth.AlgEdDSA, time.Now())
+	ks := auth.NewKeySet()
+	if err := ks.Load([]auth.Key{key}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewTokens(testConfig, ks)
+
+	issued, err := tokens.Issue("u1", []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := verify(tokens, issued); code != http.StatusOK {
+		t.Fatalf("token emitido deveria ser aceito, recebeu %d", code)
+	}
+
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "u1", "roles": []string{"admin"}, "jti": "j1",
+			"iss": testConfig.Issuer, "aud": testConfig.Audience,
+			"iat": now.Unix(), "nbf": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+		}
+	}
+	cases := map[string]func(jwt.MapClaims){
+		"outro emissor":   func(c jwt.MapClaims) { c["iss"] = "someone-else" },
+		"outra audiência": func(c jwt.MapClaims) { c["aud"] = "other-api" },
+		"sem nbf":         func(c jwt.MapClaims) { delete(c, "nbf") },
+		"nbf no futuro":   func(c jwt.MapClaims) { c["nbf"] = now.Add(time.Hour).Unix() },
+		"expirado":        func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() },
+	}
+	for name, mutate := range cases {
+		claims := valid()
+		mutate(claims)
+		if code, _ := verify(tokens, signWith(t, key, claims)); code != http.StatusUnauthorized {
+			t.Errorf("%s: esperado 401, recebeu %d", name, code)
+		}
+	}
+	if code, _ := verify(tokens, signWith(t, key, valid())); code != http.StatusOK {
+		t.Errorf("claims válidas deveriam ser aceitas, recebeu %d", code)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := testConfig.Validate(); err != nil {
+		t.Fatalf("config de teste deveria ser válida: %v", err)
+	}
+	for name, mutate := range map[string]func(*auth.Config){
+		"sem emissor":     func(c *auth.Config) { c.Issuer = "" },
+		"sem audiência":   func(c *auth.Config) { c.Audience = "" },
+		"algoritmo HS256": func(c *auth.Config) { c.Algorithm = "HS256" },
+		"ttl zerado":      func(c *auth.Config) { c.AccessTTL = 0 },
+	} {
+		cfg := testConfig
+		mutate(&cfg)
+		if cfg.Validate() == nil {
+			t.Errorf("%s: esperado erro de validação", name)
+		}
+	}
+}
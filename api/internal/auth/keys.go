@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// Algoritmos de assinatura suportados
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+// JWKSMaxAge é por quanto tempo os consumidores podem manter o JWKS em cache;
+// uma chave nova precisa ser publicada com antecedência maior que isso antes de assinar
+const JWKSMaxAge = 5 * time.Minute
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// Key é uma chave de assinatura identificada pelo kid. Ela aparece no JWKS desde
+// que é carregada, mas só passa a assinar tokens a partir de ActivatesAt.
+type Key struct {
+	ID          string
+	Algorithm   string
+	Private     crypto.Signer
+	ActivatesAt time.Time
+}
+
+// GenerateKey cria uma chave nova do algoritmo informado; o kid é o thumbprint RFC 7638
+func GenerateKey(alg string, activatesAt time.Time) (Key, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return Key{}, fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	pub, err := jwk.FromRaw(priv.Public())
+	if err != nil {
+		return Key{}, err
+	}
+	thumb, err := pub.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return Key{}, err
+	}
+	kid := base64.RawURLEncoding.EncodeToString(thumb)
+	return Key{ID: kid, Algorithm: alg, Private: priv, ActivatesAt: activatesAt}, nil
+}
+
+// MarshalPrivateKey codifica a chave privada em PEM (PKCS #8) para persistência
+func MarshalPrivateKey(k Key) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParseKey reconstrói uma Key persistida com MarshalPrivateKey
+func ParseKey(id, alg string, privatePEM []byte, activatesAt time.Time) (Key, error) {
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: invalid PEM", id)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+	priv, ok := parsed.(crypto.Signer)
+	if !ok {
+		return Key{}, fmt.Errorf("key %s: unsupported key type %T", id, parsed)
+	}
+	if _, err := signingMethod(alg); err != nil {
+		return Key{}, err
+	}
+	return Key{ID: id, Algorithm: alg, Private: priv, ActivatesAt: activatesAt}, nil
+}
+
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	case AlgRS256:
+		return jwt.SigningMethodRS256, nil
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+}
+
+// KeySet guarda as chaves em uso: assina com a mais recente já ativa e aceita
+// tokens de qualquer chave carregada, o que permite a rotação sem derrubar sessões
+type KeySet struct {
+	mu     sync.RWMutex
+	keys   []Key // ordenadas por ActivatesAt
+	public jwk.Set
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{public: jwk.NewSet()}
+}
+
+// Load substitui as chaves do conjunto
+func (ks *KeySet) Load(keys []Key) error {
+	public := jwk.NewSet()
+	for _, k := range keys {
+		pub, err := jwk.FromRaw(k.Private.Public())
+		if err != nil {
+			return fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		pub.Set(jwk.KeyIDKey, k.ID)
+		pub.Set(jwk.AlgorithmKey, jwa.SignatureAlgorithm(k.Algorithm))
+		pub.Set(jwk.KeyUsageKey, jwk.ForSignature)
+		if err := public.AddKey(pub); err != nil {
+			return err
+		}
+	}
+	sorted := append([]Key(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ActivatesAt.Before(sorted[j].ActivatesAt) })
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys, ks.public = sorted, public
+	return nil
+}
+
+// signingKey devolve a chave ativa mais recente
+func (ks *KeySet) signingKey(now time.Time) (Key, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if !ks.keys[i].ActivatesAt.After(now) {
+			return ks.keys[i], nil
+		}
+	}
+	return Key{}, ErrNoSigningKey
+}
+
+// sign assina claims com a chave ativa mais recente, indicando-a no kid
+func (ks *KeySet) sign(claims jwt.Claims, now time.Time) (string, error) {
+	key, err := ks.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+func (ks *KeySet) publicSet() jwk.Set {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.public
+}
+
+// JWKS publica as chaves públicas em GET /.well-known/jwks.json
+func (ks *KeySet) JWKS(w http.ResponseWriter, r *http.Request) {
+	public := ks.publicSet()
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(JWKSMaxAge/time.Second)))
+	json.NewEncoder(w).Encode(public)
+}
@@ -0,0 +1,150 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+)
+
+func generateKey(t *testing.T, alg string, activatesAt time.Time) auth.Key {
+	t.Helper()
+	k, err := auth.GenerateKey(alg, activatesAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+var testConfig = auth.Config{
+	Issuer:     "fruit-store-test",
+	Audience:   "fruit-store",
+	Algorithm:  auth.AlgEdDSA,
+	AccessTTL:  15 * time.Minute,
+	RefreshTTL: time.Hour,
+}
+
+// verify passa o token pelo Verifier e devolve o status e o sub autenticado
+func verify(tokens *auth.Tokens, token string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/fruits", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	var sub string
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, claims, _ := jwtauth.FromContext(r.Context())
+		sub, _ = claims["sub"].(string)
+		w.WriteHeader(http.StatusOK)
+	})
+	tokens.Verifier(auth.MustAuth(ok)).ServeHTTP(rec, req)
+	return rec.Code, sub
+}
+
+func TestKeySet_RotationKeepsOldTokensValid(t *testing.T) {
+	now := time.Now()
+	for _, alg := range []string{auth.AlgEdDSA, auth.AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			oldKey := generateKey(t, alg, now.Add(-time.Hour))
+			ks := auth.NewKeySet()
+			tokens := auth.NewTokens(testConfig, ks)
+			if err := ks.Load([]auth.Key{oldKey}); err != nil {
+				t.Fatal(err)
+			}
+			oldToken, err := tokens.Issue("u1", []string{"user"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a chave nova é publicada antes de assinar; depois de ativa, a antiga só verifica
+			newKey := generateKey(t, alg, now.Add(-time.Second))
+			if err := ks.Load([]auth.Key{oldKey, newKey}); err != nil {
+				t.Fatal(err)
+			}
+			newToken, err := tokens.Issue("u2", []string{"user"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for token, sub := range map[string]string{oldToken: "u1", newToken: "u2"} {
+				if code, got := verify(tokens, token); code != http.StatusOK || got != sub {
+					t.Errorf("esperado 200 para %s, recebeu %d (%s)", sub, code, got)
+				}
+			}
+
+			// descartada a chave antiga, seus tokens deixam de valer
+			if err := ks.Load([]auth.Key{newKey}); err != nil {
+				t.Fatal(err)
+			}
+			if code, _ := verify(tokens, oldToken); code != http.StatusUnauthorized {
+				t.Errorf("esperado 401 para chave descartada, recebeu %d", code)
+			}
+		})
+	}
+}
+
+func TestKeySet_PendingKeyIsPublishedButNotUsed(t *testing.T) {
+	now := time.Now()
+	active := generateKey(t, auth.AlgEdDSA, now.Add(-time.Hour))
+	pending := generateKey(t, auth.AlgEdDSA, now.Add(time.Hour))
+	ks := auth.NewKeySet()
+	tokens := auth.NewTokens(testConfig, ks)
+	if err := ks.Load([]auth.Key{active, pending}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	ks.JWKS(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	kids := map[string]bool{}
+	for _, k := range set.Keys {
+		kids[k["kid"].(string)] = true
+		if _, private := k["d"]; private {
+			t.Fatal("JWKS não pode expor a chave privada")
+		}
+	}
+	if !kids[active.ID] || !kids[pending.ID] {
+		t.Fatalf("JWKS deveria publicar as duas chaves: %v", kids)
+	}
+
+	token, err := tokens.Issue("u1", []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// só a chave ativa assina; a pendente apenas verifica
+	if err := ks.Load([]auth.Key{active}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := verify(tokens, token); code != http.StatusOK {
+		t.Fatalf("token deveria ter sido assinado pela chave ativa, recebeu %d", code)
+	}
+}
+
+func TestKeySet_RejectsUnknownKeys(t *testing.T) {
+	other := auth.NewKeySet()
+	if err := other.Load([]auth.Key{generateKey(t, auth.AlgEdDSA, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	forged, err := auth.NewTokens(testConfig, other).Issue("u1", []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := auth.NewKeySet()
+	tokens := auth.NewTokens(testConfig, ks)
+	if err := ks.Load([]auth.Key{generateKey(t, auth.AlgEdDSA, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := verify(tokens, forged); code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 para kid desconhecido, recebeu %d", code)
+	}
+	if _, err := auth.NewTokens(testConfig, auth.NewKeySet()).Issue("u1", []string{"user"}); err != auth.ErrNoSigningKey {
+		t.Fatalf("esperado ErrNoSigningKey, recebeu %v", err)
+	}
+}
@@ -4,11 +4,22 @@ import (
 	"net/http"
 
 	"github.com/go-chi/jwtauth/v5"
-)
 
-var TokenAuth = jwtauth.New("HS256", secretKey, nil)
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+)
 
 // Middleware verifica e autentica o JWT
 func MustAuth(next http.Handler) http.Handler {
-	return jwtauth.Authenticator(TokenAuth)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _, err := jwtauth.FromContext(r.Context())
+		if err != nil {
+			problem.Error(w, r, http.StatusUnauthorized, jwtauth.ErrorReason(err).Error())
+			return
+		}
+		if token == nil {
+			problem.Error(w, r, http.StatusUnauthorized, "missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
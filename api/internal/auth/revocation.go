@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+)
+
+// Denylist guarda os access tokens revogados antes de expirarem
+type Denylist interface {
+	// Revoke invalida o token jti até until (sua expiração)
+	Revoke(ctx context.Context, jti string, until time.Time) error
+	// RevokeUser invalida todos os tokens do usuário emitidos antes de at (precisão de milissegundos)
+	RevokeUser(ctx context.Context, userID string, at time.Time) error
+	IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error)
+}
+
+// RedisDenylist implementa Denylist com chaves que expiram junto com os tokens
+type RedisDenylist struct {
+	rdb       *redis.Client
+	accessTTL time.Duration
+}
+
+// NewRedisDenylist recebe a validade dos access tokens, que limita por quanto tempo
+// uma revogação por usuário precisa ser lembrada
+func NewRedisDenylist(rdb *redis.Client, accessTTL time.Duration) *RedisDenylist {
+	return &RedisDenylist{rdb: rdb, accessTTL: accessTTL}
+}
+
+func jtiKey(jti string) string              { return "jwt:denylist:" + jti }
+func revokedBeforeKey(userID string) string { return "jwt:revoked_before:" + userID }
+
+func (d *RedisDenylist) Revoke(ctx context.Context, jti string, until time.Time) error {
+	ttl := time.Until(until)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return d.rdb.Set(ctx, jtiKey(jti), 1, ttl).Err()
+}
+
+func (d *RedisDenylist) RevokeUser(ctx context.Context, userID string, at time.Time) error {
+	// depois de accessTTL todos os tokens anteriores já expiraram sozinhos
+	return d.rdb.Set(ctx, revokedBeforeKey(userID), at.UnixMilli(), d.accessTTL).Err()
+}
+
+func (d *RedisDenylist) IsRevoked(ctx context.Context, jti, userID string, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		n, err := d.rdb.Exists(ctx, jtiKey(jti)).Result()
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	v, err := d.rdb.Get(ctx, revokedBeforeKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	before, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	// revogações gravadas antes da troca para milissegundos estão em segundos
+	if before < 1e11 {
+		before *= 1000
+	}
+	// o iat tem milissegundos (ver numericDateFormatPrecision): o token renovado logo depois da
+	// revogação continua válido, e os anteriores no mesmo segundo não. Tokens antigos, com iat
+	// em segundos, ficam com o início do segundo e são revogados. O arredondamento desfaz o
+	// erro de ponto flutuante da leitura do iat (ver numericDateParsePrecision).
+	return issuedAt.Round(time.Millisecond).UnixMilli() < before, nil
+}
+
+// NotRevoked rejeita tokens presentes na denylist; deve vir depois de MustAuth.
+// Se a denylist estiver indisponível a requisição é recusada (fail closed).
+func NotRevoked(dl Denylist) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, _, err := jwtauth.FromContext(r.Context())
+			if err != nil || token == nil {
+				problem.Error(w, r, http.StatusUnauthorized, "missing token")
+				return
+			}
+			revoked, err := dl.IsRevoked(r.Context(), token.JwtID(), token.Subject(), token.IssuedAt())
+			if err != nil {
+				log.Printf("denylist check error: %v", err)
+				problem.Error(w, r, http.StatusServiceUnavailable, "token revocation check unavailable")
+				return
+			}
+			if revoked {
+				problem.Error(w, r, http.StatusUnauthorized, "token revoked")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+)
+
+// newRedisDenylist devolve a RedisDenylist ligada a um Redis em memória
+func newRedisDenylist(t *testing.T) (*auth.RedisDenylist, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return auth.NewRedisDenylist(rdb, 15*time.Minute), mr
+}
+
+func serveWithToken(t *testing.T, dl auth.Denylist, claims map[string]interface{}) int {
+	t.Helper()
+	ja := jwtauth.New("HS256", []byte("test-secret"), nil)
+	token, _, err := ja.Encode(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/fruits", nil)
+	req = req.WithContext(jwtauth.NewContext(req.Context(), token, nil))
+	rec := httptest.NewRecorder()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	auth.NotRevoked(dl)(ok).ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestNotRevoked(t *testing.T) {
+	ctx := context.Background()
+	dl, _ := newRedisDenylist(t)
+	issued := time.Now().Add(-time.Minute)
+	claims := map[string]interface{}{"sub": "u1", "jti": "t1", "iat": issued}
+
+	if code := serveWithToken(t, dl, claims); code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d", code)
+	}
+
+	dl.Revoke(ctx, "t1", time.Now().Add(time.Hour))
+	if code := serveWithToken(t, dl, claims); code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 para jti revogado, recebeu %d", code)
+	}
+
+	// no mesmo segundo da revogação, vale o que foi emitido antes ou depois dela
+	second := time.Now().Truncate(time.Second)
+	dl.RevokeUser(ctx, "u1", second.Add(500*time.Millisecond))
+	cases := []struct {
+		name string
+		iat  any
+		want int
+	}{
+		{"emitido antes, em outro segundo", issued, http.StatusUnauthorized},
+		{"emitido antes, no mesmo segundo", second.Add(200 * time.Millisecond), http.StatusUnauthorized},
+		{"emitido depois, no mesmo segundo", second.Add(800 * time.Millisecond), http.StatusOK},
+		{"iat em segundos, do segundo da revogação", second.Unix(), http.StatusUnauthorized},
+		{"emitido no segundo seguinte", second.Add(time.Second), http.StatusOK},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := map[string]interface{}{"sub": "u1", "jti": "t" + strconv.Itoa(i+2), "iat": tc.iat}
+			if code := serveWithToken(t, dl, claims); code != tc.want {
+				t.Fatalf("esperado %d, recebeu %d", tc.want, code)
+			}
+		})
+	}
+}
+
+func TestRedisDenylist_ReadsRevocationsInSeconds(t *testing.T) {
+	dl, mr := newRedisDenylist(t)
+	// valor gravado antes da troca para milissegundos
+	at := time.Now()
+	mr.Set("jwt:revoked_before:u1", strconv.FormatInt(at.Unix(), 10))
+
+	if revoked, err := dl.IsRevoked(context.Background(), "", "u1", at.Add(-time.Second)); err != nil || !revoked {
+		t.Fatalf("token anterior: esperado revogado, recebeu %v, %v", revoked, err)
+	}
+	if revoked, err := dl.IsRevoked(context.Background(), "", "u1", at.Add(time.Second)); err != nil || revoked {
+		t.Fatalf("token posterior: esperado válido, recebeu %v, %v", revoked, err)
+	}
+}
+
+func TestRevokeUser_KeepsTokenIssuedRightAfter(t *testing.T) {
+	ctx := context.Background()
+	dl, _ := newRedisDenylist(t)
+	ks := auth.NewKeySet()
+	if err := ks.Load([]auth.Key{generateKey(t, auth.AlgEdDSA, time.Now().Add(-time.Hour))}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewTokens(testConfig, ks)
+	serve := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/fruits", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+		tokens.Verifier(auth.MustAuth(auth.NotRevoked(dl)(ok))).ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	old, err := tokens.Issue("u1", []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if err := dl.RevokeUser(ctx, "u1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := tokens.Issue("u1", []string{"user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := serve(old); code != http.StatusUnauthorized {
+		t.Fatalf("token anterior à revogação: esperado 401, recebeu %d", code)
+	}
+	if code := serve(renewed); code != http.StatusOK {
+		t.Fatalf("token emitido depois da revogação: esperado 200, recebeu %d", code)
+	}
+}
@@ -1,27 +1,48 @@
 package auth
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"slices"
 
-	"github.com/go-chi/jwtauth/v5"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
 )
 
-func RoleAuth(allowed ...string) func(http.Handler) http.Handler {
+// PermissionResolver traduz os papéis do token em permissões, consultando o banco
+type PermissionResolver interface {
+	HasPermission(ctx context.Context, roles []string, perm string) (bool, error)
+}
+
+// RequirePermission exige que algum papel do token autenticado conceda perm;
+// para clientes autenticados por chave de API, perm precisa estar entre os escopos da chave
+func RequirePermission(resolver PermissionResolver, perm string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			_, claims, _ := jwtauth.FromContext(r.Context())
-			role, ok := claims["role"].(string)
-			if !ok {
-				http.Error(w, "missing role", http.StatusUnauthorized)
-				return
-			}
-			for _, a := range allowed {
-				if a == role {
-					next.ServeHTTP(w, r)
+			if client, ok := CurrentAPIClient(r.Context()); ok {
+				if !slices.Contains(client.Scopes, perm) {
+					problem.Error(w, r, http.StatusForbidden, "api key lacks scope "+perm)
 					return
 				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			roles := Roles(r.Context())
+			if len(roles) == 0 {
+				problem.Error(w, r, http.StatusForbidden, "missing permission "+perm)
+				return
+			}
+			ok, err := resolver.HasPermission(r.Context(), roles, perm)
+			if err != nil {
+				log.Printf("permission lookup failed: %v", err)
+				problem.Error(w, r, http.StatusServiceUnavailable, "permission check unavailable")
+				return
+			}
+			if !ok {
+				problem.Error(w, r, http.StatusForbidden, "missing permission "+perm)
+				return
 			}
-			http.Error(w, "forbidden", http.StatusForbidden)
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,74 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+)
+
+// fakeResolver concede as permissões mapeadas por papel
+type fakeResolver struct {
+	perms map[string][]string
+	err   error
+}
+
+func (f fakeResolver) HasPermission(ctx context.Context, roles []string, perm string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, role := range roles {
+		for _, p := range f.perms[role] {
+			if p == perm {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func TestRequirePermission(t *testing.T) {
+	ks := auth.NewKeySet()
+	if err := ks.Load([]auth.Key{generateKey(t, auth.AlgEdDSA, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewTokens(testConfig, ks)
+	resolver := fakeResolver{perms: map[string][]string{
+		"user":   {"fruits:read"},
+		"editor": {"fruits:read", "fruits:write"},
+	}}
+
+	cases := []struct {
+		name     string
+		roles    []string
+		resolver fakeResolver
+		want     int
+	}{
+		{"papel com a permissão", []string{"editor"}, resolver, http.StatusOK},
+		{"qualquer papel basta", []string{"user", "editor"}, resolver, http.StatusOK},
+		{"papel sem a permissão", []string{"user"}, resolver, http.StatusForbidden},
+		{"sem papéis", nil, resolver, http.StatusForbidden},
+		{"falha ao consultar", []string{"editor"}, fakeResolver{err: errors.New("db down")}, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := tokens.Issue("u1", tc.roles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			h := tokens.Verifier(auth.MustAuth(auth.RequirePermission(tc.resolver, "fruits:write")(ok)))
+			req := httptest.NewRequest(http.MethodPost, "/fruits", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("esperado %d, recebeu %d", tc.want, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package env lê a configuração das variáveis de ambiente. Variável ausente usa o padrão;
+// valor inválido é erro, para a aplicação não subir com uma configuração diferente da pedida.
+package env
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// String lê key, usando def se ausente
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Int lê um inteiro positivo de key, usando def se ausente
+func Int(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", key, v)
+	}
+	return n, nil
+}
+
+// Duration lê uma duração positiva (ex.: "720h") de key, usando def se ausente; zero ou
+// negativa derrubaria os tickers dos workers
+func Duration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, got %q", key, v)
+	}
+	return d, nil
+}
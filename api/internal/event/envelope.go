@@ -0,0 +1,58 @@
+// Package event define o envelope dos eventos publicados pela API. O user-service
+// mantém uma cópia do mesmo formato; mudanças incompatíveis sobem SchemaVersion.
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaVersion é a versão do formato do envelope e dos dados publicados
+const SchemaVersion = 1
+
+// Producer identifica a API como origem dos eventos
+const Producer = "fruit-store-api"
+
+// Tipos dos eventos de usuário
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	UserDeleted = "user.deleted"
+)
+
+// Actor é quem fez a alteração; ausente quando não há usuário autenticado (ex.: login OIDC)
+type Actor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Envelope é o corpo das mensagens publicadas. ID é fixado quando o evento é gravado,
+// então se repete nas novas tentativas e serve para o consumidor descartar duplicatas.
+type Envelope struct {
+	ID            uuid.UUID `json:"id"`
+	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schema_version"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Producer      string    `json:"producer"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Actor         *Actor    `json:"actor,omitempty"`
+	// TenantID é a loja do usuário, a mesma que vem nos dados
+	TenantID uuid.UUID `json:"tenant_id"`
+	// Action e Data (em "user") mantêm os campos do formato antigo {"action","user"},
+	// lidos pelos consumidores que ainda não conhecem o envelope
+	Action string          `json:"action"`
+	Data   json.RawMessage `json:"user"`
+}
+
+// TypeOf devolve o tipo do evento de usuário correspondente a action (create, update, delete)
+func TypeOf(action string) string {
+	switch action {
+	case "create":
+		return UserCreated
+	case "delete":
+		return UserDeleted
+	}
+	return UserUpdated
+}
@@ -0,0 +1,23 @@
+package event
+
+import "context"
+
+// Metadata é o contexto da alteração gravado junto com o evento: a requisição que a
+// originou e quem a fez. A camada HTTP preenche; o repositório só lê.
+type Metadata struct {
+	CorrelationID string
+	Actor         *Actor
+}
+
+type metadataKey struct{}
+
+// WithMetadata devolve ctx carregando m para os eventos gravados a partir dele
+func WithMetadata(ctx context.Context, m Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, m)
+}
+
+// MetadataFrom devolve os metadados de ctx; sem eles, o evento vai sem correlação nem ator
+func MetadataFrom(ctx context.Context) Metadata {
+	m, _ := ctx.Value(metadataKey{}).(Metadata)
+	return m
+}
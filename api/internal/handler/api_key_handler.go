@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// APIKeyHandler gerencia as chaves de API dos clientes máquina a máquina
+type APIKeyHandler struct {
+	svc service.APIKeyService
+}
+
+// NewAPIKeyHandler recebe o mesmo APIKeyService que autentica as chaves nas rotas
+func NewAPIKeyHandler(svc service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{svc: svc}
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.svc.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	k, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, k)
+}
+
+// Create emite uma chave; o campo key só aparece nesta resposta
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var in model.APIKeyInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	userID, _ := auth.UserID(r.Context())
+	k, err := h.svc.Create(r.Context(), userID, in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/api-keys/"+k.ID.String())
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, k)
+}
+
+// Revoke invalida a chave imediatamente; o registro é mantido para auditoria
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.Revoke(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -2,9 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mfa"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,37 +24,285 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest permite encerrar também a sessão de refresh; o corpo é opcional
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// VerifyMFARequest responde ao desafio do login com um código TOTP ou de recuperação
+type VerifyMFARequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// ChangePasswordRequest responde ao desafio de troca obrigatória de senha do login
+type ChangePasswordRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Password       string `json:"password"`
+}
+
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	// RecoveryCodes só aparece no login que conclui o cadastro obrigatório do TOTP
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// MFAChallengeResponse substitui os tokens quando o login exige o segundo fator.
+// Com enrollment_required, secret e otpauth_uri trazem o TOTP a ser cadastrado.
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	ChallengeToken     string `json:"challenge_token"`
+	ExpiresIn          int    `json:"expires_in"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	Secret             string `json:"secret,omitempty"`
+	OTPAuthURI         string `json:"otpauth_uri,omitempty"`
+}
+
+// PasswordChangeResponse substitui os tokens quando a senha precisa ser trocada antes do login
+type PasswordChangeResponse struct {
+	PasswordChangeRequired bool   `json:"password_change_required"`
+	ChallengeToken         string `json:"challenge_token"`
+	ExpiresIn              int    `json:"expires_in"`
+}
+
+// OIDCProviderResponse anuncia um provedor OIDC e a rota que inicia o login nele
+type OIDCProviderResponse struct {
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
 }
 
 type LoginHandler struct {
-	svc service.UserService
+	svc  service.AuthService
+	oidc service.OIDCService
 }
 
-func NewLoginHandler(db *pgxpool.Pool) *LoginHandler {
-	svc := service.NewUserService(repository.NewUserRepository(db))
+func NewLoginHandler(
+	db *pgxpool.Pool,
+	tokens *auth.Tokens,
+	denylist auth.Denylist,
+	guard *loginguard.Guard,
+	challenges mfa.ChallengeStore,
+	policy password.Policy,
+	roles auth.PermissionResolver,
+) *LoginHandler {
+	svc := service.NewAuthService(
+		repository.NewUserRepository(db),
+		repository.NewRefreshTokenRepository(db),
+		repository.NewTOTPRepository(db),
+		tokens,
+		denylist,
+		guard,
+		challenges,
+		policy,
+		roles,
+	)
 	return &LoginHandler{svc: svc}
 }
 
+func (h *LoginHandler) WithService(svc service.AuthService) *LoginHandler {
+	h.svc = svc
+	return h
+}
+
+// WithOIDC habilita o login pelos provedores OIDC
+func (h *LoginHandler) WithOIDC(svc service.OIDCService) *LoginHandler {
+	h.oidc = svc
+	return h
+}
+
 func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	res, err := h.svc.Login(r.Context(), req.Username, req.Password, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeLoginResult(w, res)
+}
+
+// VerifyMFA conclui o login em duas etapas trocando o desafio e o código pelos tokens
+func (h *LoginHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req VerifyMFARequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	res, err := h.svc.VerifyMFA(r.Context(), req.ChallengeToken, req.Code, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeLoginResult(w, res)
+}
+
+// ChangePassword conclui a troca obrigatória de senha e continua o login
+func (h *LoginHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	res, err := h.svc.ChangePassword(r.Context(), req.ChallengeToken, req.Password, clientInfo(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeLoginResult(w, res)
+}
+
+// OIDCProviders lista os provedores de identidade aceitos no login
+func (h *LoginHandler) OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	list := []OIDCProviderResponse{}
+	for _, name := range h.oidc.Providers() {
+		list = append(list, OIDCProviderResponse{Name: name, LoginURL: "/auth/oidc/" + name + "/login"})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// OIDCLogin redireciona o navegador para a autorização no provedor {provider}
+func (h *LoginHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	target, err := h.oidc.Begin(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback recebe o retorno do provedor e conclui o login como em Login: tokens da
+// API ou o desafio do segundo fator
+func (h *LoginHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		problem.Error(w, r, http.StatusUnauthorized, "identity provider error: "+e)
 		return
 	}
-	user, err := h.svc.Authenticate(r.Context(), req.Username, req.Password)
+	res, err := h.oidc.Complete(r.Context(), chi.URLParam(r, "provider"), q.Get("state"), q.Get("code"), clientInfo(r))
 	if err != nil {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		writeError(w, r, err)
 		return
 	}
+	writeLoginResult(w, res)
+}
 
-	token, err := auth.GenerateToken(user.ID.String(), user.Role)
+// Refresh troca o refresh token por um novo par; o token apresentado deixa de valer
+func (h *LoginHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	pair, err := h.svc.Refresh(r.Context(), req.RefreshToken, clientInfo(r))
 	if err != nil {
-		http.Error(w, "could not generate token", http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	writeTokenPair(w, pair)
+}
+
+// Logout revoga o access token usado na requisição até sua expiração
+func (h *LoginHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req LogoutRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, _ := auth.UserID(r.Context())
+	jti, exp, ok := auth.CurrentToken(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, "missing token")
 		return
 	}
+	if err := h.svc.Logout(r.Context(), userID, jti, exp, req.RefreshToken); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+// RevokeUserTokens (admin) invalida todas as sessões do usuário {id}
+func (h *LoginHandler) RevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
+		return
+	}
+	if err := h.svc.RevokeUserTokens(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser (admin) remove o bloqueio de login do usuário {id}
+func (h *LoginHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
+		return
+	}
+	actor, _ := auth.UserID(r.Context())
+	if err := h.svc.UnlockUser(r.Context(), id, actor.String()); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTokenPair(w http.ResponseWriter, pair service.TokenPair) {
+	writeLoginResult(w, service.LoginResult{Tokens: pair})
+}
+
+func writeLoginResult(w http.ResponseWriter, res service.LoginResult) {
+	if c := res.PasswordChange; c != nil {
+		writeNoStore(w, PasswordChangeResponse{
+			PasswordChangeRequired: true,
+			ChallengeToken:         c.Token,
+			ExpiresIn:              int(c.ExpiresIn.Seconds()),
+		})
+		return
+	}
+	if c := res.Challenge; c != nil {
+		resp := MFAChallengeResponse{
+			MFARequired:        true,
+			ChallengeToken:     c.Token,
+			ExpiresIn:          int(c.ExpiresIn.Seconds()),
+			EnrollmentRequired: c.Enrollment != nil,
+		}
+		if c.Enrollment != nil {
+			resp.Secret, resp.OTPAuthURI = c.Enrollment.Secret, c.Enrollment.URI
+		}
+		writeNoStore(w, resp)
+		return
+	}
+	writeNoStore(w, LoginResponse{
+		Token:         res.Tokens.AccessToken,
+		RefreshToken:  res.Tokens.RefreshToken,
+		TokenType:     "Bearer",
+		ExpiresIn:     int(res.Tokens.ExpiresIn.Seconds()),
+		RecoveryCodes: res.RecoveryCodes,
+	})
+}
+
+// writeNoStore responde JSON com segredos, que não devem ficar em cache
+func writeNoStore(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(LoginResponse{Token: token})
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+// clientInfo extrai o user agent e o IP de origem da requisição
+func clientInfo(r *http.Request) model.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return model.ClientInfo{UserAgent: r.UserAgent(), IP: ip}
 }
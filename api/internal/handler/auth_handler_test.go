@@ -0,0 +1,559 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/audit"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mfa"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// memUserRepo é um UserRepository em memória; com uma loja no contexto, como nas
+// rotas autenticadas, só enxerga os usuários dela. Como o repositório real, grava
+// os eventos de cada alteração na outbox.
+type memUserRepo struct {
+	users  map[uuid.UUID]model.User
+	outbox *memOutbox
+}
+
+// visible informa se u pertence à loja do contexto, quando houver
+func visible(ctx context.Context, u model.User) bool {
+	id, ok := tenant.FromContext(ctx)
+	return !ok || u.TenantID == id
+}
+
+func newMemUserRepo(t *testing.T, username, password, role string) (*memUserRepo, model.User) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := model.User{ID: uuid.New(), TenantID: tenant.Default, Username: username, PasswordHash: string(hash), Roles: []string{role}}
+	return &memUserRepo{users: map[uuid.UUID]model.User{u.ID: u}, outbox: &memOutbox{}}, u
+}
+
+func (m *memUserRepo) Create(ctx context.Context, u *model.User) error {
+	u.ID = uuid.New()
+	u.TenantID, _ = tenant.FromContext(ctx)
+	m.users[u.ID] = *u
+	m.outbox.add(ctx, "create", *u)
+	return nil
+}
+func (m *memUserRepo) List(ctx context.Context, f model.UserFilter) ([]model.User, int, error) {
+	q := strings.ToLower(f.Query)
+	list := []model.User{}
+	for _, u := range m.users {
+		text := strings.ToLower(u.Username + " " + u.DisplayName + " " + u.Email)
+		if visible(ctx, u) && strings.Contains(text, q) && (f.Role == "" || u.HasRole(f.Role)) {
+			list = append(list, u)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	total := len(list)
+	list = list[min(f.Offset, total):min(f.Offset+f.Limit, total)]
+	return list, total, nil
+}
+func (m *memUserRepo) CountActiveWithRole(ctx context.Context, role string, except uuid.UUID) (int, error) {
+	n := 0
+	for _, u := range m.users {
+		if visible(ctx, u) && u.ID != except && u.HasRole(role) && !u.Disabled() {
+			n++
+		}
+	}
+	return n, nil
+}
+func (m *memUserRepo) GetByID(ctx context.Context, id uuid.UUID) (model.User, error) {
+	u, ok := m.users[id]
+	if !ok || !visible(ctx, u) {
+		return u, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+func (m *memUserRepo) Update(ctx context.Context, u *model.User) error {
+	cur, ok := m.users[u.ID]
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+	cur.Username, cur.Roles, cur.DisabledAt = u.Username, u.Roles, u.DisabledAt
+	m.users[u.ID] = cur
+	m.outbox.add(ctx, "update", cur)
+	return nil
+}
+func (m *memUserRepo) UpdateProfile(ctx context.Context, u *model.User) error {
+	cur, ok := m.users[u.ID]
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+	cur.DisplayName, cur.Email = u.DisplayName, u.Email
+	m.users[u.ID] = cur
+	m.outbox.add(ctx, "update", cur)
+	return nil
+}
+func (m *memUserRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+	delete(m.users, id)
+	m.outbox.add(ctx, "delete", u)
+	return nil
+}
+func (m *memUserRepo) UpdatePassword(ctx context.Context, id uuid.UUID, hash string, mustChange bool) error {
+	u, ok := m.users[id]
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+	u.PasswordHash, u.MustChangePassword = hash, mustChange
+	m.users[id] = u
+	return nil
+}
+func (m *memUserRepo) GetByUsername(ctx context.Context, username string) (model.User, error) {
+	for _, u := range m.users {
+		if u.Username == username && visible(ctx, u) {
+			return u, nil
+		}
+	}
+	return model.User{}, repository.ErrUserNotFound
+}
+
+// memTokenRepo é um RefreshTokenRepository em memória
+type memTokenRepo struct {
+	tokens map[uuid.UUID]*model.RefreshToken
+}
+
+func newMemTokenRepo() *memTokenRepo {
+	return &memTokenRepo{tokens: map[uuid.UUID]*model.RefreshToken{}}
+}
+
+func (m *memTokenRepo) Create(ctx context.Context, t *model.RefreshToken) error {
+	t.ID = uuid.New()
+	t.TenantID, _ = tenant.FromContext(ctx)
+	t.CreatedAt = time.Now()
+	cp := *t
+	m.tokens[t.ID] = &cp
+	return nil
+}
+func (m *memTokenRepo) GetByHash(ctx context.Context, hash string) (model.RefreshToken, error) {
+	for _, t := range m.tokens {
+		if t.TokenHash == hash {
+			return *t, nil
+		}
+	}
+	return model.RefreshToken{}, repository.ErrRefreshTokenNotFound
+}
+func (m *memTokenRepo) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	t := m.tokens[id]
+	if t.UsedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	t.UsedAt = &now
+	return true, nil
+}
+func (m *memTokenRepo) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memTokenRepo) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memTokenRepo) ListSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]model.Session, error) {
+	var sessions []model.Session
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt) {
+			sessions = append(sessions, model.Session{ID: t.FamilyID, CreatedAt: t.CreatedAt, LastUsedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt})
+		}
+	}
+	return sessions, nil
+}
+func (m *memTokenRepo) RevokeSession(ctx context.Context, userID, familyID uuid.UUID) error {
+	revoked := false
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.FamilyID == familyID && t.RevokedAt == nil {
+			now := time.Now()
+			t.RevokedAt, revoked = &now, true
+		}
+	}
+	if !revoked {
+		return repository.ErrSessionNotFound
+	}
+	return nil
+}
+func (m *memTokenRepo) RevokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error {
+	now := time.Now()
+	for _, t := range m.tokens {
+		if t.UserID == userID && t.FamilyID != keep && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// nopDenylist é uma denylist que nunca revoga nada
+type nopDenylist struct{}
+
+func (nopDenylist) Revoke(ctx context.Context, jti string, until time.Time) error     { return nil }
+func (nopDenylist) RevokeUser(ctx context.Context, userID string, at time.Time) error { return nil }
+func (nopDenylist) IsRevoked(ctx context.Context, jti, userID string, iat time.Time) (bool, error) {
+	return false, nil
+}
+
+// memStore é um loginguard.Store em memória
+type memStore struct {
+	counts  map[string]int64
+	expires map[string]time.Time
+}
+
+func newMemStore() *memStore {
+	return &memStore{counts: map[string]int64{}, expires: map[string]time.Time{}}
+}
+
+func (m *memStore) live(key string) bool {
+	exp, ok := m.expires[key]
+	if ok && time.Now().After(exp) {
+		delete(m.counts, key)
+		delete(m.expires, key)
+		return false
+	}
+	return ok
+}
+func (m *memStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if !m.live(key) {
+		m.expires[key] = time.Now().Add(ttl)
+	}
+	m.counts[key]++
+	return m.counts[key], nil
+}
+func (m *memStore) Set(ctx context.Context, key string, ttl time.Duration) error {
+	m.counts[key], m.expires[key] = 1, time.Now().Add(ttl)
+	return nil
+}
+func (m *memStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if !m.live(key) {
+		return 0, nil
+	}
+	return time.Until(m.expires[key]), nil
+}
+func (m *memStore) Del(ctx context.Context, keys ...string) error {
+	for _, k := range keys {
+		delete(m.counts, k)
+		delete(m.expires, k)
+	}
+	return nil
+}
+
+// memTOTPRepo é um TOTPRepository em memória
+type memTOTPRepo struct {
+	totps map[uuid.UUID]*model.TOTP
+	codes map[uuid.UUID]map[string]bool // hash -> usado
+}
+
+func newMemTOTPRepo() *memTOTPRepo {
+	return &memTOTPRepo{totps: map[uuid.UUID]*model.TOTP{}, codes: map[uuid.UUID]map[string]bool{}}
+}
+
+func (m *memTOTPRepo) Get(ctx context.Context, userID uuid.UUID) (model.TOTP, error) {
+	t, ok := m.totps[userID]
+	if !ok {
+		return model.TOTP{}, repository.ErrTOTPNotFound
+	}
+	return *t, nil
+}
+func (m *memTOTPRepo) SavePending(ctx context.Context, userID uuid.UUID, secret string) error {
+	if t, ok := m.totps[userID]; ok && t.Enabled() {
+		return repository.ErrTOTPAlreadyEnabled
+	}
+	m.totps[userID] = &model.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+func (m *memTOTPRepo) Enable(ctx context.Context, userID uuid.UUID, step int64, hashes []string) error {
+	t := m.totps[userID]
+	now := time.Now()
+	t.EnabledAt, t.LastStep = &now, step
+	return m.ReplaceRecoveryCodes(ctx, userID, hashes)
+}
+func (m *memTOTPRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	t := m.totps[userID]
+	if t.LastStep >= step {
+		return false, nil
+	}
+	t.LastStep = step
+	return true, nil
+}
+func (m *memTOTPRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, hashes []string) error {
+	m.codes[userID] = map[string]bool{}
+	for _, h := range hashes {
+		m.codes[userID][h] = false
+	}
+	return nil
+}
+func (m *memTOTPRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) (bool, error) {
+	used, ok := m.codes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	m.codes[userID][hash] = true
+	return true, nil
+}
+
+// memChallenges é um mfa.ChallengeStore em memória, sem expiração
+type memChallenges map[string]mfa.Challenge
+
+func (m memChallenges) Save(ctx context.Context, id string, c mfa.Challenge, ttl time.Duration) error {
+	m[id] = c
+	return nil
+}
+func (m memChallenges) Get(ctx context.Context, id string) (mfa.Challenge, bool, error) {
+	c, ok := m[id]
+	return c, ok, nil
+}
+func (m memChallenges) Delete(ctx context.Context, id string) error {
+	delete(m, id)
+	return nil
+}
+
+type nopAudit struct{}
+
+func (nopAudit) Record(ctx context.Context, e audit.Event) {}
+
+// newGuard bloqueia após 3 falhas, sem atraso progressivo entre elas
+func newGuard() *loginguard.Guard {
+	return loginguard.New(newMemStore(), loginguard.Policy{
+		MaxUserFailures: 3,
+		MaxIPFailures:   100,
+		Window:          time.Minute,
+		Lockout:         time.Minute,
+	}, nopAudit{})
+}
+
+// newTokens injeta uma chave gerada no teste, sem banco nem variáveis de ambiente
+func newTokens(t *testing.T) *auth.Tokens {
+	t.Helper()
+	k, err := auth.GenerateKey(auth.AlgEdDSA, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := auth.NewKeySet()
+	if err := ks.Load([]auth.Key{k}); err != nil {
+		t.Fatal(err)
+	}
+	return auth.NewTokens(auth.Config{
+		Issuer:     "fruit-store-test",
+		Audience:   "fruit-store",
+		Algorithm:  auth.AlgEdDSA,
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: time.Hour,
+	}, ks)
+}
+
+// staticRoles resolve as permissões por um mapa fixo de papel para permissões
+type staticRoles map[string][]string
+
+func (r staticRoles) HasPermission(ctx context.Context, roles []string, perm string) (bool, error) {
+	for _, role := range roles {
+		if slices.Contains(r[role], perm) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// testRoles espelha os papéis semeados nas migrations
+var testRoles = staticRoles{
+	model.RoleAdmin: {model.PermFruitsRead, model.PermFruitsWrite, model.PermUsersManage, model.PermReportsView, model.PermTenantsManage},
+	"user":          {model.PermFruitsRead},
+}
+
+// testPolicy é a política padrão com o custo mínimo do bcrypt, para os testes não ficarem lentos
+var testPolicy = password.Policy{MinLength: 12, MinClasses: 3, Cost: bcrypt.MinCost, Breached: password.DefaultBreachList()}
+
+func newLoginHandler(t *testing.T, users repository.UserRepository, guard *loginguard.Guard) *handler.LoginHandler {
+	svc := service.NewAuthService(users, newMemTokenRepo(), newMemTOTPRepo(), newTokens(t), nopDenylist{}, guard, memChallenges{}, testPolicy, testRoles)
+	return handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(svc)
+}
+
+func postJSON(h http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func decodeLogin(t *testing.T, rec *httptest.ResponseRecorder) handler.LoginResponse {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp handler.LoginResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("falha ao decodificar: %v", err)
+	}
+	return resp
+}
+
+func TestRefresh_RotationAndReuseDetection(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "s3cret-pass", "user")
+	h := newLoginHandler(t, users, newGuard())
+
+	login := decodeLogin(t, postJSON(h.Login, "/auth/login", `{"username":"ana","password":"s3cret-pass"}`))
+	if login.Token == "" || login.RefreshToken == "" {
+		t.Fatalf("tokens ausentes: %#v", login)
+	}
+
+	rotated := decodeLogin(t, postJSON(h.Refresh, "/auth/refresh", `{"refresh_token":"`+login.RefreshToken+`"}`))
+	if rotated.RefreshToken == login.RefreshToken {
+		t.Fatal("refresh token deveria ser rotacionado")
+	}
+
+	// reapresentar o token antigo revoga a família inteira
+	if rec := postJSON(h.Refresh, "/auth/refresh", `{"refresh_token":"`+login.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 no reuso, recebeu %d", rec.Code)
+	}
+	if rec := postJSON(h.Refresh, "/auth/refresh", `{"refresh_token":"`+rotated.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 após revogação da família, recebeu %d", rec.Code)
+	}
+}
+
+func TestLogin_InvalidCredentials(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "s3cret-pass", "user")
+	h := newLoginHandler(t, users, newGuard())
+
+	if rec := postJSON(h.Login, "/auth/login", `{"username":"ana","password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401, recebeu %d", rec.Code)
+	}
+}
+
+func TestLogin_LockoutIsIndistinguishableForUnknownUsers(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "s3cret-pass", "user")
+	h := newLoginHandler(t, users, newGuard())
+
+	for _, username := range []string{"ana", "ghost"} {
+		body := `{"username":"` + username + `","password":"wrong"}`
+		for i := 0; i < 3; i++ {
+			if rec := postJSON(h.Login, "/auth/login", body); rec.Code != http.StatusUnauthorized {
+				t.Fatalf("%s tentativa %d: esperado 401, recebeu %d", username, i+1, rec.Code)
+			}
+		}
+		rec := postJSON(h.Login, "/auth/login", body)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s: esperado 429 após bloqueio, recebeu %d", username, rec.Code)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: esperado cabeçalho Retry-After", username)
+		}
+	}
+
+	// nem a senha correta passa durante o bloqueio
+	if rec := postJSON(h.Login, "/auth/login", `{"username":"ana","password":"s3cret-pass"}`); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("esperado 429 durante o bloqueio, recebeu %d", rec.Code)
+	}
+}
+
+func decodeChallenge(t *testing.T, rec *httptest.ResponseRecorder) handler.MFAChallengeResponse {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp handler.MFAChallengeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("falha ao decodificar: %v", err)
+	}
+	if !resp.MFARequired || resp.ChallengeToken == "" {
+		t.Fatalf("esperado desafio de segundo fator: %#v", resp)
+	}
+	return resp
+}
+
+func verifyBody(challenge, code string) string {
+	return `{"challenge_token":"` + challenge + `","code":"` + code + `"}`
+}
+
+func TestLogin_AdminMustEnrollAndVerifyTOTP(t *testing.T) {
+	users, _ := newMemUserRepo(t, "root", "s3cret-pass", "admin")
+	h := newLoginHandler(t, users, newGuard())
+	creds := `{"username":"root","password":"s3cret-pass"}`
+
+	// primeiro login: a política obriga o cadastro antes de emitir tokens
+	enroll := decodeChallenge(t, postJSON(h.Login, "/auth/login", creds))
+	if !enroll.EnrollmentRequired || enroll.Secret == "" || enroll.OTPAuthURI == "" {
+		t.Fatalf("esperado cadastro obrigatório com segredo: %#v", enroll)
+	}
+	if rec := postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(enroll.ChallengeToken, "000000")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 com código errado, recebeu %d", rec.Code)
+	}
+	// a confirmação usa o passo anterior para que o próximo login possa usar o atual
+	code, _ := mfa.Code(enroll.Secret, mfa.Step(time.Now())-1)
+	first := decodeLogin(t, postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(enroll.ChallengeToken, code)))
+	if first.Token == "" || len(first.RecoveryCodes) != 10 {
+		t.Fatalf("esperado tokens e 10 códigos de recuperação: %#v", first)
+	}
+	if rec := postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(enroll.ChallengeToken, code)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("desafio já concluído não deveria ser aceito, recebeu %d", rec.Code)
+	}
+
+	// logins seguintes pedem o código do autenticador, que não pode ser reutilizado
+	ch := decodeChallenge(t, postJSON(h.Login, "/auth/login", creds))
+	if ch.EnrollmentRequired || ch.Secret != "" {
+		t.Fatalf("segredo não deveria ser reenviado: %#v", ch)
+	}
+	if rec := postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(ch.ChallengeToken, code)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 ao reutilizar o código, recebeu %d", rec.Code)
+	}
+	code, _ = mfa.Code(enroll.Secret, mfa.Step(time.Now()))
+	if resp := decodeLogin(t, postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(ch.ChallengeToken, code))); resp.RecoveryCodes != nil {
+		t.Fatal("códigos de recuperação só devem ser exibidos no cadastro")
+	}
+
+	// códigos de recuperação valem uma única vez
+	recovery := first.RecoveryCodes[0]
+	ch = decodeChallenge(t, postJSON(h.Login, "/auth/login", creds))
+	decodeLogin(t, postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(ch.ChallengeToken, recovery)))
+	ch = decodeChallenge(t, postJSON(h.Login, "/auth/login", creds))
+	if rec := postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(ch.ChallengeToken, recovery)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 ao reutilizar código de recuperação, recebeu %d", rec.Code)
+	}
+}
+
+func TestLogin_PrivilegedCustomRoleMustEnrollTOTP(t *testing.T) {
+	users, _ := newMemUserRepo(t, "edu", "s3cret-pass", "editor")
+	roles := staticRoles{"editor": {model.PermFruitsRead, model.PermFruitsWrite}}
+	svc := service.NewAuthService(users, newMemTokenRepo(), newMemTOTPRepo(), newTokens(t), nopDenylist{}, newGuard(), memChallenges{}, testPolicy, roles)
+	h := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(svc)
+
+	enroll := decodeChallenge(t, postJSON(h.Login, "/auth/login", `{"username":"edu","password":"s3cret-pass"}`))
+	if !enroll.EnrollmentRequired {
+		t.Fatalf("fruits:write exige TOTP mesmo fora do papel admin: %#v", enroll)
+	}
+}
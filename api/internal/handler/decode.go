@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+)
+
+// maxBodyBytes limita o tamanho dos corpos JSON aceitos
+const maxBodyBytes = 1 << 20
+
+// decodeJSON decodifica o corpo em dst rejeitando campos desconhecidos e dados extras.
+// Em caso de erro já responde com um problem+json e devolve false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("body must contain a single JSON object")
+	}
+	if err == nil {
+		return true
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &typeErr):
+		problem.Write(w, r, problem.Validation("invalid JSON body", []problem.InvalidParam{
+			{Name: typeErr.Field, Reason: "must be of type " + typeErr.Type.String()},
+		}))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		problem.Write(w, r, problem.Validation("invalid JSON body", []problem.InvalidParam{
+			{Name: field, Reason: "unknown field"},
+		}))
+	case errors.As(err, &maxErr):
+		problem.Error(w, r, http.StatusRequestEntityTooLarge, "request body too large")
+	default:
+		problem.Error(w, r, http.StatusBadRequest, "invalid JSON body")
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// statusFor traduz os erros de domínio dos repositórios e serviços em status HTTP
+func statusFor(err error) int {
+	var ve *service.ValidationError
+	var tooMany *service.TooManyAttemptsError
+	switch {
+	case errors.As(err, &tooMany):
+		return http.StatusTooManyRequests
+	case errors.As(err, &ve), errors.Is(err, repository.ErrInvalid), errors.Is(err, service.ErrInvalidResetToken):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrInvalidCredentials),
+		errors.Is(err, service.ErrInvalidRefreshToken),
+		errors.Is(err, service.ErrRefreshTokenReused),
+		errors.Is(err, service.ErrInvalidMFACode),
+		errors.Is(err, service.ErrInvalidMFAChallenge),
+		errors.Is(err, service.ErrInvalidPasswordChallenge),
+		errors.Is(err, service.ErrInvalidOIDCState),
+		errors.Is(err, service.ErrOIDCLoginFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrUserDisabled), errors.Is(err, service.ErrNoMappedRole):
+		return http.StatusForbidden
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, repository.ErrConflict), errors.Is(err, service.ErrProtectedRole),
+		errors.Is(err, service.ErrSelfLockout), errors.Is(err, service.ErrLastAdmin):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError responde com um problem+json; erros internos são logados e não expostos
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var ve *service.ValidationError
+	if errors.As(err, &ve) {
+		params := make([]problem.InvalidParam, 0, len(ve.Fields))
+		for _, f := range ve.Fields {
+			params = append(params, problem.InvalidParam{Name: f.Field, Reason: f.Message})
+		}
+		problem.Write(w, r, problem.Validation(ve.Error(), params))
+		return
+	}
+
+	var tooMany *service.TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		// arredonda para cima para o cliente não tentar antes do fim do bloqueio
+		secs := int((tooMany.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
+
+	status := statusFor(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		problem.Error(w, r, status, "")
+		return
+	}
+	problem.Error(w, r, status, err.Error())
+}
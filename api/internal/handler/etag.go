@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+)
+
+var (
+	errMissingIfMatch = errors.New("If-Match header required")
+	errInvalidIfMatch = errors.New("invalid If-Match header")
+)
+
+// versionETag formata a versão de um recurso como ETag forte
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseETag devolve a versão contida em uma ETag, aceitando o prefixo W/
+func parseETag(tag string) (int, bool) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	v, err := strconv.Atoi(tag[1 : len(tag)-1])
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// ifMatchVersion extrai a versão esperada do cabeçalho If-Match
+func ifMatchVersion(r *http.Request) (int, error) {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		return 0, errMissingIfMatch
+	}
+	v, ok := parseETag(h)
+	if !ok {
+		return 0, errInvalidIfMatch
+	}
+	return v, nil
+}
+
+// ifNoneMatch informa se alguma ETag do cabeçalho If-None-Match corresponde à versão
+func ifNoneMatch(r *http.Request, version int) bool {
+	h := r.Header.Get("If-None-Match")
+	if h == "" {
+		return false
+	}
+	for _, tag := range strings.Split(h, ",") {
+		if strings.TrimSpace(tag) == "*" {
+			return true
+		}
+		if v, ok := parseETag(tag); ok && v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// writePreconditionError traduz erros de If-Match em 428 ou 412
+func writePreconditionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errMissingIfMatch) {
+		problem.Error(w, r, http.StatusPreconditionRequired, err.Error())
+		return
+	}
+	problem.Error(w, r, http.StatusPreconditionFailed, err.Error())
+}
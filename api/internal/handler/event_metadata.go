@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+)
+
+// EventMetadata anexa à requisição o correlation ID e o ator dos eventos que ela gerar.
+// Nas rotas autenticadas deve vir depois do Verifier, para enxergar o usuário do token.
+func EventMetadata(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := event.Metadata{CorrelationID: middleware.GetReqID(r.Context())}
+		if id, ok := auth.UserID(r.Context()); ok {
+			m.Actor = &event.Actor{Type: "user", ID: id.String()}
+		}
+		next.ServeHTTP(w, r.WithContext(event.WithMetadata(r.Context(), m)))
+	})
+}
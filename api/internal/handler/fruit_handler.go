@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
 	"time"
 
@@ -10,9 +13,13 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
 )
 
 // FruitHandler agrupa as dependências
@@ -33,30 +40,72 @@ func (h *FruitHandler) WithService(svc service.FruitService) *FruitHandler {
 	return h
 }
 
+// fruitsCacheKey devolve a chave da listagem em cache da loja do contexto; sem loja não há cache
+func fruitsCacheKey(ctx context.Context) (string, bool) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return tenant.Key(id, "fruits:all"), true
+}
+
+// invalidate descarta a listagem em cache da loja após uma escrita
+func (h *FruitHandler) invalidate(ctx context.Context) {
+	if key, ok := fruitsCacheKey(ctx); ok {
+		h.cache.Del(ctx, key)
+	}
+}
+
 // List godoc
 // @Summary      Lista todas as frutas
-// @Description  Retorna todas as frutas, usando cache
+// @Description  Retorna todas as frutas fora da lixeira, usando cache
 // @Tags         fruits
 // @Produce      json
 // @Success      200  {array}   model.Fruit
-// @Failure      500  {object}  map[string]string
+// @Failure      500  {object}  problem.Problem
 // @Security     ApiKeyAuth
 // @Router       /fruits [get]
 func (h *FruitHandler) List(w http.ResponseWriter, r *http.Request) {
 
-	if data, err := h.cache.Get(r.Context(), "fruits:all").Result(); err == nil {
-		w.Write([]byte(data))
-		return
+	key, cached := fruitsCacheKey(r.Context())
+	if cached {
+		if data, err := h.cache.Get(r.Context(), key).Result(); err == nil {
+			w.Write([]byte(data))
+			return
+		}
 	}
 
 	fruits, err := h.svc.ListFruits(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	jsonData, _ := json.Marshal(fruits)
-	h.cache.Set(r.Context(), "fruits:all", jsonData, time.Minute*5)
+	if cached {
+		jsonData, _ := json.Marshal(fruits)
+		h.cache.Set(r.Context(), key, jsonData, time.Minute*5)
+	}
+	if fruits == nil {
+		fruits = make([]model.Fruit, 0)
+	}
+	json.NewEncoder(w).Encode(fruits)
+}
+
+// Trash godoc
+// @Summary      Lista a lixeira de frutas
+// @Description  Retorna as frutas removidas que ainda não foram expurgadas
+// @Tags         fruits
+// @Produce      json
+// @Success      200  {array}   model.Fruit
+// @Failure      500  {object}  problem.Problem
+// @Security     ApiKeyAuth
+// @Router       /fruits/trash [get]
+func (h *FruitHandler) Trash(w http.ResponseWriter, r *http.Request) {
+	fruits, err := h.svc.ListDeletedFruits(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	if fruits == nil {
 		fruits = make([]model.Fruit, 0)
 	}
@@ -65,26 +114,34 @@ func (h *FruitHandler) List(w http.ResponseWriter, r *http.Request) {
 
 // Get godoc
 // @Summary     Obtém detalhes de uma fruta
-// @Description Retorna os dados de uma fruta a partir do ID informado
+// @Description Retorna os dados de uma fruta a partir do ID informado, com a versão atual no cabeçalho ETag
 // @Tags        fruits
 // @Produce     json
-// @Param       id   path     string true "ID da fruta" Format(UUID)
+// @Param       id            path     string true  "ID da fruta" Format(UUID)
+// @Param       If-None-Match header   string false "ETag já conhecida pelo cliente"
 // @Success     200  {object} model.Fruit
-// @Failure     400  {object} map[string]string
-// @Failure     404  {object} map[string]string
-// @Failure     500  {object} map[string]string
+// @Header      200  {string} ETag "Versão atual da fruta"
+// @Success     304  {string} string "Not Modified"
+// @Failure     400  {object} problem.Problem
+// @Failure     404  {object} problem.Problem
+// @Failure     500  {object} problem.Problem
 // @Security    ApiKeyAuth
 // @Router      /fruits/{id} [get]
 func (h *FruitHandler) Get(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
 		return
 	}
 	fruit, err := h.svc.GetFruit(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(fruit.Version))
+	if ifNoneMatch(r, fruit.Version) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	json.NewEncoder(w).Encode(fruit)
@@ -96,84 +153,200 @@ func (h *FruitHandler) Get(w http.ResponseWriter, r *http.Request) {
 // @Tags        fruits
 // @Accept      json
 // @Produce     json
-// @Param       fruit body     model.Fruit true "Dados da fruta"
+// @Param       fruit body     model.FruitInput true "Dados da fruta"
 // @Success     201   {object} model.Fruit
-// @Failure     400   {object} map[string]string
-// @Failure     500   {object} map[string]string
+// @Failure     400   {object} problem.Problem
+// @Failure     500   {object} problem.Problem
 // @Security    ApiKeyAuth
 // @Router      /fruits [post]
 func (h *FruitHandler) Create(w http.ResponseWriter, r *http.Request) {
-	var f model.Fruit
-	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	var in model.FruitInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	f, err := service.FruitFromInput(in)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 	if err := h.svc.CreateFruit(r.Context(), &f); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	h.cache.Del(r.Context(), "fruits:all")
+	h.invalidate(r.Context())
 
+	w.Header().Set("ETag", versionETag(f.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(f)
 }
 
 // Update godoc
 // @Summary     Atualiza uma fruta existente
-// @Description Atualiza os campos de uma fruta com o ID informado e invalida o cache
+// @Description Substitui todos os campos de uma fruta com o ID informado e invalida o cache.
+// @Description Exige If-Match com a ETag da versão atual e rejeita corpos sem name, quantity ou price.
 // @Tags        fruits
 // @Accept      json
 // @Produce     json
-// @Param       id    path     string      true "ID da fruta" Format(UUID)
-// @Param       fruit body     model.Fruit true "Dados atualizados da fruta"
+// @Param       id       path     string           true "ID da fruta" Format(UUID)
+// @Param       If-Match header   string           true "ETag da versão atual"
+// @Param       fruit    body     model.FruitInput true "Dados atualizados da fruta"
 // @Success     200   {object}  model.Fruit
-// @Failure     400   {object}  map[string]string
-// @Failure     404   {object}  map[string]string
-// @Failure     500   {object}  map[string]string
+// @Header      200   {string}  ETag "Nova versão da fruta"
+// @Failure     400   {object}  problem.Problem
+// @Failure     404   {object}  problem.Problem
+// @Failure     412   {object}  problem.Problem
+// @Failure     428   {object}  problem.Problem
+// @Failure     500   {object}  problem.Problem
 // @Security    ApiKeyAuth
 // @Router      /fruits/{id} [put]
 func (h *FruitHandler) Update(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writePreconditionError(w, r, err)
 		return
 	}
-	var f model.Fruit
-	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	var in model.FruitInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	f, err := service.FruitFromInput(in)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 	f.ID = id
+	f.Version = version
 	if err := h.svc.UpdateFruit(r.Context(), &f); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	h.cache.Del(r.Context(), "fruits:all")
+	h.invalidate(r.Context())
+	w.Header().Set("ETag", versionETag(f.Version))
+	json.NewEncoder(w).Encode(f)
+}
+
+// Patch godoc
+// @Summary     Atualiza parcialmente uma fruta
+// @Description Aplica um JSON Merge Patch (RFC 7396) alterando apenas os campos enviados e invalida o cache.
+// @Description Exige If-Match com a ETag da versão atual.
+// @Tags        fruits
+// @Accept      application/merge-patch+json
+// @Produce     json
+// @Param       id       path     string           true "ID da fruta" Format(UUID)
+// @Param       If-Match header   string           true "ETag da versão atual"
+// @Param       patch    body     model.FruitInput true "Campos a alterar"
+// @Success     200   {object}  model.Fruit
+// @Header      200   {string}  ETag "Nova versão da fruta"
+// @Failure     400   {object}  problem.Problem
+// @Failure     404   {object}  problem.Problem
+// @Failure     412   {object}  problem.Problem
+// @Failure     415   {object}  problem.Problem
+// @Failure     428   {object}  problem.Problem
+// @Failure     500   {object}  problem.Problem
+// @Security    ApiKeyAuth
+// @Router      /fruits/{id} [patch]
+func (h *FruitHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idParam)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mergepatch.ContentType {
+		problem.Error(w, r, http.StatusUnsupportedMediaType, "content type must be "+mergepatch.ContentType)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writePreconditionError(w, r, err)
+		return
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "could not read request body")
+		return
+	}
+	f, err := h.svc.PatchFruit(r.Context(), id, version, patch)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.invalidate(r.Context())
+	w.Header().Set("ETag", versionETag(f.Version))
 	json.NewEncoder(w).Encode(f)
 }
 
 // Delete godoc
 // @Summary     Remove uma fruta
-// @Description Exclui a fruta com o ID informado e invalida o cache
+// @Description Move a fruta com o ID informado para a lixeira e invalida o cache.
+// @Description Exige If-Match com a ETag da versão atual.
 // @Tags        fruits
-// @Param       id path string true "ID da fruta" Format(UUID)
+// @Param       id       path   string true "ID da fruta" Format(UUID)
+// @Param       If-Match header string true "ETag da versão atual"
 // @Success     204 {string} string "No Content"
-// @Failure     400 {object} map[string]string
-// @Failure     404 {object} map[string]string
-// @Failure     500 {object} map[string]string
+// @Failure     400 {object} problem.Problem
+// @Failure     404 {object} problem.Problem
+// @Failure     412 {object} problem.Problem
+// @Failure     428 {object} problem.Problem
+// @Failure     500 {object} problem.Problem
 // @Security    ApiKeyAuth
 // @Router      /fruits/{id} [delete]
 func (h *FruitHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	idParam := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idParam)
 	if err != nil {
-		http.Error(w, "invalid id", http.StatusBadRequest)
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
 		return
 	}
-	if err := h.svc.DeleteFruit(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		writePreconditionError(w, r, err)
 		return
 	}
+	var deletedBy *uuid.UUID
+	if uid, ok := auth.UserID(r.Context()); ok {
+		deletedBy = &uid
+	}
+	if err := h.svc.DeleteFruit(r.Context(), id, version, deletedBy); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.invalidate(r.Context())
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Restore godoc
+// @Summary     Restaura uma fruta da lixeira
+// @Description Tira da lixeira a fruta com o ID informado e invalida o cache
+// @Tags        fruits
+// @Produce     json
+// @Param       id  path     string true "ID da fruta" Format(UUID)
+// @Success     200 {object} model.Fruit
+// @Header      200 {string} ETag "Nova versão da fruta"
+// @Failure     400 {object} problem.Problem
+// @Failure     404 {object} problem.Problem
+// @Failure     500 {object} problem.Problem
+// @Security    ApiKeyAuth
+// @Router      /fruits/{id}/restore [post]
+func (h *FruitHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idParam)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid id")
+		return
+	}
+	f, err := h.svc.RestoreFruit(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.invalidate(r.Context())
+	w.Header().Set("ETag", versionETag(f.Version))
+	json.NewEncoder(w).Encode(f)
+}
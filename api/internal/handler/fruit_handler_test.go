@@ -8,12 +8,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
 )
 
@@ -26,6 +29,9 @@ type mockService struct {
 	getErr   error
 
 	createErr error
+
+	updateErr error
+	deleteErr error
 }
 
 func (m *mockService) ListFruits(ctx context.Context) ([]model.Fruit, error) {
@@ -39,8 +45,28 @@ func (m *mockService) CreateFruit(ctx context.Context, f *model.Fruit) error {
 	f.ID = uuid.New()
 	return m.createErr
 }
-func (m *mockService) UpdateFruit(ctx context.Context, f *model.Fruit) error { return nil }
-func (m *mockService) DeleteFruit(ctx context.Context, id uuid.UUID) error   { return nil }
+func (m *mockService) UpdateFruit(ctx context.Context, f *model.Fruit) error {
+	if m.updateErr != nil {
+		return m.updateErr
+	}
+	f.Version++
+	return nil
+}
+func (m *mockService) PatchFruit(ctx context.Context, id uuid.UUID, version int, patch []byte) (model.Fruit, error) {
+	return m.getFruit, m.updateErr
+}
+func (m *mockService) DeleteFruit(ctx context.Context, id uuid.UUID, version int, deletedBy *uuid.UUID) error {
+	return m.deleteErr
+}
+func (m *mockService) ListDeletedFruits(ctx context.Context) ([]model.Fruit, error) {
+	return m.listFruits, m.listErr
+}
+func (m *mockService) RestoreFruit(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
+	return m.getFruit, m.getErr
+}
+func (m *mockService) PurgeDeletedFruits(ctx context.Context, retention time.Duration) (int64, error) {
+	return 0, nil
+}
 
 // newHandler monta um FruitHandler usando o mockService e um Redis que sempre falha (para pular cache)
 func newHandler(ms service.FruitService) *handler.FruitHandler {
@@ -126,7 +152,7 @@ func TestGetFruit_BadID(t *testing.T) {
 }
 
 func TestCreateFruit_Success(t *testing.T) {
-	body := `{"name":"Laranja","price":3.21,"quantity_in_stock":7}`
+	body := `{"name":"Laranja","price":3.21,"quantity":7}`
 	h := newHandler(&mockService{})
 
 	req := httptest.NewRequest(http.MethodPost, "/fruits", bytes.NewBufferString(body))
@@ -156,3 +182,295 @@ func TestCreateFruit_BadRequest(t *testing.T) {
 		t.Fatalf("esperado 400, recebeu %d", rec.Code)
 	}
 }
+
+// withID injeta o parâmetro de rota id na request
+func withID(req *http.Request, id string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestGetFruit_NotModified(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{getFruit: model.Fruit{ID: id, Name: "Uva", Version: 3}})
+
+	req := withID(httptest.NewRequest(http.MethodGet, "/fruits/"+id.String(), nil), id.String())
+	req.Header.Set("If-None-Match", `"3"`)
+	rec := httptest.NewRecorder()
+
+	h.Get(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("esperado 304, recebeu %d", rec.Code)
+	}
+	if got := rec.Header().Get("ETag"); got != `"3"` {
+		t.Errorf("esperado ETag \"3\", recebeu %s", got)
+	}
+}
+
+func TestUpdateFruit_MissingIfMatch(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{})
+	body := `{"name":"Uva","price":4.5,"quantity":3}`
+	req := withID(httptest.NewRequest(http.MethodPut, "/fruits/"+id.String(), bytes.NewBufferString(body)), id.String())
+	rec := httptest.NewRecorder()
+
+	h.Update(rec, req)
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("esperado 428, recebeu %d", rec.Code)
+	}
+}
+
+func TestUpdateFruit_Success(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{})
+	body := `{"name":"Uva","price":4.5,"quantity":3}`
+	req := withID(httptest.NewRequest(http.MethodPut, "/fruits/"+id.String(), bytes.NewBufferString(body)), id.String())
+	req.Header.Set("If-Match", `"2"`)
+	rec := httptest.NewRecorder()
+
+	h.Update(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d", rec.Code)
+	}
+	if got := rec.Header().Get("ETag"); got != `"3"` {
+		t.Errorf("esperado ETag \"3\", recebeu %s", got)
+	}
+}
+
+func TestUpdateFruit_VersionConflict(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{updateErr: repository.ErrVersionConflict})
+	body := `{"name":"Uva","price":4.5,"quantity":3}`
+	req := withID(httptest.NewRequest(http.MethodPut, "/fruits/"+id.String(), bytes.NewBufferString(body)), id.String())
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	h.Update(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("esperado 412, recebeu %d", rec.Code)
+	}
+}
+
+func TestDeleteFruit_NotFound(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{deleteErr: repository.ErrFruitNotFound})
+	req := withID(httptest.NewRequest(http.MethodDelete, "/fruits/"+id.String(), nil), id.String())
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	h.Delete(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("esperado 404, recebeu %d", rec.Code)
+	}
+}
+
+func TestUpdateFruit_IncompleteBody(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{})
+	body := `{"name":"Uva","quantity":3}`
+	req := withID(httptest.NewRequest(http.MethodPut, "/fruits/"+id.String(), bytes.NewBufferString(body)), id.String())
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	h.Update(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("esperado 400, recebeu %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("esperado %s, recebeu %s", problem.ContentType, ct)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("falha ao decodificar: %v", err)
+	}
+	if p.Type != problem.TypeValidation || p.Instance != "/fruits/"+id.String() {
+		t.Errorf("problema inesperado: %#v", p)
+	}
+	if len(p.InvalidParams) != 1 || p.InvalidParams[0].Name != "price" {
+		t.Errorf("esperado price em invalid_params, recebeu %#v", p.InvalidParams)
+	}
+}
+
+func TestPatchFruit_UnsupportedMediaType(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{})
+	req := withID(httptest.NewRequest(http.MethodPatch, "/fruits/"+id.String(), bytes.NewBufferString(`{"price":5}`)), id.String())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	h.Patch(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("esperado 415, recebeu %d", rec.Code)
+	}
+}
+
+// memRepo é um FruitRepository em memória para exercitar o FruitService real
+type memRepo struct {
+	fruit model.Fruit
+}
+
+func (m *memRepo) GetAll(ctx context.Context) ([]model.Fruit, error) {
+	return []model.Fruit{m.fruit}, nil
+}
+func (m *memRepo) GetDeleted(ctx context.Context) ([]model.Fruit, error) { return nil, nil }
+func (m *memRepo) GetByID(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
+	if id != m.fruit.ID {
+		return model.Fruit{}, repository.ErrFruitNotFound
+	}
+	return m.fruit, nil
+}
+func (m *memRepo) Create(ctx context.Context, f *model.Fruit) error { return nil }
+func (m *memRepo) Update(ctx context.Context, f *model.Fruit) error {
+	if f.Version != m.fruit.Version {
+		return repository.ErrVersionConflict
+	}
+	f.Version++
+	m.fruit = *f
+	return nil
+}
+func (m *memRepo) Delete(ctx context.Context, id uuid.UUID, version int, deletedBy *uuid.UUID) error {
+	return nil
+}
+func (m *memRepo) Restore(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
+	return m.fruit, nil
+}
+func (m *memRepo) Purge(ctx context.Context, before time.Time) (int64, error) { return 0, nil }
+
+func TestPatchFruit_OnlyChangesProvidedFields(t *testing.T) {
+	id := uuid.New()
+	repo := &memRepo{fruit: model.Fruit{ID: id, Name: "Kiwi", Quantity: 8, Price: 6.5, Version: 1}}
+	h := newHandler(service.NewFruitService(repo))
+
+	req := withID(httptest.NewRequest(http.MethodPatch, "/fruits/"+id.String(), bytes.NewBufferString(`{"quantity":2}`)), id.String())
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	h.Patch(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if repo.fruit.Quantity != 2 || repo.fruit.Price != 6.5 || repo.fruit.Name != "Kiwi" {
+		t.Errorf("fruta inesperada após patch: %#v", repo.fruit)
+	}
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("esperado ETag \"2\", recebeu %s", got)
+	}
+}
+
+func TestPatchFruit_NullRequiredField(t *testing.T) {
+	id := uuid.New()
+	repo := &memRepo{fruit: model.Fruit{ID: id, Name: "Kiwi", Quantity: 8, Price: 6.5, Version: 1}}
+	h := newHandler(service.NewFruitService(repo))
+
+	req := withID(httptest.NewRequest(http.MethodPatch, "/fruits/"+id.String(), bytes.NewBufferString(`{"price":null}`)), id.String())
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	rec := httptest.NewRecorder()
+
+	h.Patch(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("esperado 400, recebeu %d", rec.Code)
+	}
+	if repo.fruit.Price != 6.5 {
+		t.Errorf("preço não deveria mudar, recebeu %v", repo.fruit.Price)
+	}
+}
+
+func TestTrash_EmptyList(t *testing.T) {
+	h := newHandler(&mockService{})
+	req := httptest.NewRequest(http.MethodGet, "/fruits/trash", nil)
+	rec := httptest.NewRecorder()
+
+	h.Trash(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d", rec.Code)
+	}
+	if got := bytes.TrimSpace(rec.Body.Bytes()); string(got) != "[]" {
+		t.Errorf("esperado [], recebeu %s", got)
+	}
+}
+
+func TestRestoreFruit_NotInTrash(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{getErr: repository.ErrFruitNotFound})
+	req := withID(httptest.NewRequest(http.MethodPost, "/fruits/"+id.String()+"/restore", nil), id.String())
+	rec := httptest.NewRecorder()
+
+	h.Restore(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("esperado 404, recebeu %d", rec.Code)
+	}
+}
+
+func TestGetFruit_NotFound(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{getErr: repository.ErrFruitNotFound})
+	req := withID(httptest.NewRequest(http.MethodGet, "/fruits/"+id.String(), nil), id.String())
+	rec := httptest.NewRecorder()
+
+	h.Get(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("esperado 404, recebeu %d", rec.Code)
+	}
+}
+
+func TestGetFruit_InternalError(t *testing.T) {
+	id := uuid.New()
+	h := newHandler(&mockService{getErr: errors.New("conn refused")})
+	req := withID(httptest.NewRequest(http.MethodGet, "/fruits/"+id.String(), nil), id.String())
+	rec := httptest.NewRecorder()
+
+	h.Get(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("esperado 500, recebeu %d", rec.Code)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("conn refused")) {
+		t.Errorf("detalhe interno não deveria vazar: %s", rec.Body.String())
+	}
+}
+
+func TestCreateFruit_UnknownField(t *testing.T) {
+	h := newHandler(&mockService{})
+	body := `{"name":"Laranja","price":3.21,"quantity_in_stock":7}`
+	req := httptest.NewRequest(http.MethodPost, "/fruits", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+
+	h.Create(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("esperado 400, recebeu %d", rec.Code)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("falha ao decodificar: %v", err)
+	}
+	if len(p.InvalidParams) != 1 || p.InvalidParams[0].Name != "quantity_in_stock" {
+		t.Errorf("esperado quantity_in_stock em invalid_params, recebeu %#v", p.InvalidParams)
+	}
+}
+
+func TestCreateFruit_ValidationErrors(t *testing.T) {
+	h := newHandler(service.NewFruitService(&memRepo{}))
+	body := `{"name":"  ","price":-1,"quantity":-3}`
+	req := httptest.NewRequest(http.MethodPost, "/fruits", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+
+	h.Create(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("esperado 400, recebeu %d", rec.Code)
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+		t.Fatalf("falha ao decodificar: %v", err)
+	}
+	got := map[string]bool{}
+	for _, ip := range p.InvalidParams {
+		got[ip.Name] = true
+	}
+	for _, field := range []string{"name", "price", "quantity"} {
+		if !got[field] {
+			t.Errorf("esperado %s em invalid_params, recebeu %#v", field, p.InvalidParams)
+		}
+	}
+}
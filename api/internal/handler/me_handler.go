@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ProfileResponse é a conta vista pelo próprio usuário em /me
+type ProfileResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email,omitempty"`
+	Roles       []string  `json:"roles"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func newProfileResponse(u model.User) ProfileResponse {
+	return ProfileResponse{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+		Roles:       u.Roles,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+	}
+}
+
+// MeHandler atende o próprio usuário, identificado pelo sub do access token
+type MeHandler struct {
+	svc service.AccountService
+}
+
+func NewMeHandler(db *pgxpool.Pool, denylist auth.Denylist, guard *loginguard.Guard, policy password.Policy) *MeHandler {
+	svc := service.NewAccountService(
+		repository.NewUserRepository(db),
+		repository.NewRefreshTokenRepository(db),
+		denylist,
+		guard,
+		policy,
+	)
+	return &MeHandler{svc: svc}
+}
+
+func (h *MeHandler) WithService(svc service.AccountService) *MeHandler {
+	h.svc = svc
+	return h
+}
+
+func (h *MeHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	u, err := h.svc.Profile(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newProfileResponse(u))
+}
+
+// Patch aplica um JSON Merge Patch sobre display_name e email; trocar o email exige current_password
+func (h *MeHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mergepatch.ContentType {
+		problem.Error(w, r, http.StatusUnsupportedMediaType, "content type must be "+mergepatch.ContentType)
+		return
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "could not read request body")
+		return
+	}
+	u, err := h.svc.PatchProfile(r.Context(), userID, patch, clientInfo(r).IP)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newProfileResponse(u))
+}
+
+// ChangePassword troca a senha conferindo a atual; as demais sessões são encerradas
+func (h *MeHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	var in model.PasswordChangeInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	session, _ := auth.SessionID(r.Context())
+	if err := h.svc.ChangePassword(r.Context(), userID, session, in, clientInfo(r).IP); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *MeHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	session, _ := auth.SessionID(r.Context())
+	sessions, err := h.svc.Sessions(r.Context(), userID, session)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession encerra a sessão {id}; ela não renova mais o access token
+func (h *MeHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.RevokeSession(r.Context(), userID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentUser lê o sub do token; tokens sem um usuário válido não chegam às rotas de /me
+func currentUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, ok := auth.UserID(r.Context())
+	if !ok {
+		problem.Error(w, r, http.StatusUnauthorized, "missing token")
+	}
+	return id, ok
+}
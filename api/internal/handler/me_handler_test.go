@@ -0,0 +1,251 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// meRouter monta /me como no servidor, autenticando pelo access token
+func meRouter(tokens *auth.Tokens, h *handler.MeHandler) http.Handler {
+	r := chi.NewRouter()
+	r.Use(tokens.Verifier, auth.MustAuth, auth.TenantFromToken)
+	r.Get("/me", h.Get)
+	r.Patch("/me", h.Patch)
+	r.Post("/me/password", h.ChangePassword)
+	r.Get("/me/sessions", h.Sessions)
+	r.Delete("/me/sessions/{id}", h.RevokeSession)
+	return r
+}
+
+func callAs(router http.Handler, access, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+access)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMe_PasswordChangeKeepsOnlyCurrentSession(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	refresh := newMemTokenRepo()
+	tokens := newTokens(t)
+	authSvc := service.NewAuthService(users, refresh, newMemTOTPRepo(), tokens, nopDenylist{}, newGuard(), memChallenges{}, testPolicy, testRoles)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(authSvc)
+	me := meRouter(tokens, handler.NewMeHandler(nil, nil, nil, testPolicy).WithService(
+		service.NewAccountService(users, refresh, nopDenylist{}, newGuard(), testPolicy)))
+
+	laptop := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`))
+	phone := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`))
+
+	rec := callAs(me, laptop.Token, http.MethodGet, "/me/sessions", "", "")
+	var sessions []model.Session
+	if err := json.NewDecoder(rec.Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	current := 0
+	for _, s := range sessions {
+		if s.Current {
+			current++
+		}
+	}
+	if len(sessions) != 2 || current != 1 {
+		t.Fatalf("esperadas 2 sessões, 1 delas a atual; recebeu %+v", sessions)
+	}
+
+	wrong := `{"current_password":"not-my-password","new_password":"Fresh-Start-42"}`
+	if rec := callAs(me, laptop.Token, http.MethodPost, "/me/password", "application/json", wrong); rec.Code != http.StatusBadRequest {
+		t.Fatalf("senha atual errada: esperado 400, recebeu %d", rec.Code)
+	}
+	ok := `{"current_password":"Ripe-Mango-2025","new_password":"Fresh-Start-42"}`
+	if rec := callAs(me, laptop.Token, http.MethodPost, "/me/password", "application/json", ok); rec.Code != http.StatusNoContent {
+		t.Fatalf("esperado 204, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := postJSON(login.Refresh, "/auth/refresh", `{"refresh_token":"`+phone.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("a outra sessão deveria ter sido encerrada: esperado 401, recebeu %d", rec.Code)
+	}
+	if rec := postJSON(login.Refresh, "/auth/refresh", `{"refresh_token":"`+laptop.RefreshToken+`"}`); rec.Code != http.StatusOK {
+		t.Fatalf("a sessão atual continua: esperado 200, recebeu %d", rec.Code)
+	}
+}
+
+func TestMe_RevokeSession(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	other, _ := newMemUserRepo(t, "bia", "Ripe-Mango-2025", "user")
+	for id, u := range other.users {
+		users.users[id] = u
+	}
+	refresh := newMemTokenRepo()
+	tokens := newTokens(t)
+	authSvc := service.NewAuthService(users, refresh, newMemTOTPRepo(), tokens, nopDenylist{}, newGuard(), memChallenges{}, testPolicy, testRoles)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(authSvc)
+	me := meRouter(tokens, handler.NewMeHandler(nil, nil, nil, testPolicy).WithService(
+		service.NewAccountService(users, refresh, nopDenylist{}, newGuard(), testPolicy)))
+
+	ana := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`))
+	bia := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"bia","password":"Ripe-Mango-2025"}`))
+
+	var sessions []model.Session
+	json.NewDecoder(callAs(me, bia.Token, http.MethodGet, "/me/sessions", "", "").Body).Decode(&sessions)
+	if len(sessions) != 1 {
+		t.Fatalf("esperada 1 sessão, recebeu %+v", sessions)
+	}
+	path := "/me/sessions/" + sessions[0].ID.String()
+
+	if rec := callAs(me, ana.Token, http.MethodDelete, path, "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("sessão de outro usuário: esperado 404, recebeu %d", rec.Code)
+	}
+	if rec := callAs(me, bia.Token, http.MethodDelete, path, "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("esperado 204, recebeu %d", rec.Code)
+	}
+	if rec := postJSON(login.Refresh, "/auth/refresh", `{"refresh_token":"`+bia.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("sessão encerrada: esperado 401, recebeu %d", rec.Code)
+	}
+}
+
+func TestMe_PatchProfile(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	tokens := newTokens(t)
+	me := meRouter(tokens, handler.NewMeHandler(nil, nil, nil, testPolicy).WithService(
+		service.NewAccountService(users, newMemTokenRepo(), nopDenylist{}, newGuard(), testPolicy)))
+	access, err := tokens.IssueSubject(auth.Subject{UserID: u.ID.String(), TenantID: u.TenantID.String(), Roles: u.Roles})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// trocar o e-mail, destino da redefinição de senha, exige a senha atual
+	for name, body := range map[string]string{
+		"sem senha":    `{"email":"ana@example.com"}`,
+		"senha errada": `{"email":"ana@example.com","current_password":"not-my-password"}`,
+	} {
+		if rec := callAs(me, access, http.MethodPatch, "/me", mergepatch.ContentType, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: esperado 400, recebeu %d", name, rec.Code)
+		}
+	}
+	if users.users[u.ID].Email != "" {
+		t.Fatal("o e-mail não pode mudar sem a senha atual")
+	}
+
+	rec := callAs(me, access, http.MethodPatch, "/me", mergepatch.ContentType,
+		`{"display_name":" Ana Lima ","email":"ana@example.com","current_password":"Ripe-Mango-2025"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var got handler.ProfileResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.DisplayName != "Ana Lima" || got.Email != "ana@example.com" || got.Username != "ana" {
+		t.Errorf("perfil inesperado: %+v", got)
+	}
+	ev := users.outbox.events()
+	if len(ev) != 1 || ev[0].action != "update" {
+		t.Errorf("esperado um evento update, recebeu %+v", ev)
+	}
+
+	for name, body := range map[string]string{
+		"e-mail inválido":  `{"email":"Ana <ana@example.com>"}`,
+		"campo do admin":   `{"roles":["admin"]}`,
+		"patch malformado": `{`,
+	} {
+		if rec := callAs(me, access, http.MethodPatch, "/me", mergepatch.ContentType, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: esperado 400, recebeu %d", name, rec.Code)
+		}
+	}
+	if rec := callAs(me, access, http.MethodPatch, "/me", "application/json", `{}`); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("content type errado: esperado 415, recebeu %d", rec.Code)
+	}
+	// só o nome de exibição não pede senha
+	if rec := callAs(me, access, http.MethodPatch, "/me", mergepatch.ContentType, `{"display_name":"Ana"}`); rec.Code != http.StatusOK {
+		t.Errorf("nome de exibição: esperado 200, recebeu %d", rec.Code)
+	}
+}
+
+func TestMe_PatchProfile_PasswordlessAccount(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	// conta criada no login OIDC, sem senha local
+	sso := users.users[u.ID]
+	sso.PasswordHash = ""
+	users.users[u.ID] = sso
+	tokens := newTokens(t)
+	me := meRouter(tokens, handler.NewMeHandler(nil, nil, nil, testPolicy).WithService(
+		service.NewAccountService(users, newMemTokenRepo(), nopDenylist{}, newGuard(), testPolicy)))
+	access, err := tokens.IssueSubject(auth.Subject{UserID: u.ID.String(), TenantID: u.TenantID.String(), Roles: u.Roles})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := callAs(me, access, http.MethodPatch, "/me", mergepatch.ContentType, `{"email":"ana@example.com"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if users.users[u.ID].Email != "ana@example.com" {
+		t.Fatal("o e-mail deveria ter mudado")
+	}
+}
+
+// revokedUsers é um auth.Denylist que registra os usuários revogados
+type revokedUsers map[string]bool
+
+func (d revokedUsers) Revoke(ctx context.Context, jti string, until time.Time) error { return nil }
+func (d revokedUsers) RevokeUser(ctx context.Context, userID string, at time.Time) error {
+	d[userID] = true
+	return nil
+}
+func (d revokedUsers) IsRevoked(ctx context.Context, jti, userID string, iat time.Time) (bool, error) {
+	return false, nil
+}
+
+func TestMe_PasswordChangeLocksOutAndRevokesTokens(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	refresh := newMemTokenRepo()
+	tokens := newTokens(t)
+	guard, denied := newGuard(), revokedUsers{}
+	authSvc := service.NewAuthService(users, refresh, newMemTOTPRepo(), tokens, nopDenylist{}, guard, memChallenges{}, testPolicy, testRoles)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(authSvc)
+	me := meRouter(tokens, handler.NewMeHandler(nil, nil, nil, testPolicy).WithService(
+		service.NewAccountService(users, refresh, denied, guard, testPolicy)))
+	session := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`))
+
+	ok := `{"current_password":"Ripe-Mango-2025","new_password":"Fresh-Start-42"}`
+	if rec := callAs(me, session.Token, http.MethodPost, "/me/password", "application/json", ok); rec.Code != http.StatusNoContent {
+		t.Fatalf("esperado 204, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if !denied[u.ID.String()] {
+		t.Fatal("os access tokens já emitidos deveriam ser negados")
+	}
+
+	// as falhas contam no mesmo loginguard do login e bloqueiam o username
+	wrong := `{"current_password":"not-my-password","new_password":"Other-Start-42"}`
+	for i := 0; i < 3; i++ {
+		callAs(me, session.Token, http.MethodPost, "/me/password", "application/json", wrong)
+	}
+	retry := `{"current_password":"Fresh-Start-42","new_password":"Other-Start-42"}`
+	if rec := callAs(me, session.Token, http.MethodPost, "/me/password", "application/json", retry); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("após o bloqueio: esperado 429, recebeu %d", rec.Code)
+	}
+	// no servidor o login recebe a loja pelo X-Tenant, que dá a mesma chave do bloqueio
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"username":"ana","password":"Fresh-Start-42"}`))
+	rec := httptest.NewRecorder()
+	login.Login(rec, req.WithContext(tenant.WithID(req.Context(), u.TenantID)))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("o login também fica bloqueado: esperado 429, recebeu %d", rec.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MFACodeRequest carrega um código do aplicativo autenticador
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type EnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAHandler gerencia o TOTP do usuário autenticado
+type MFAHandler struct {
+	svc service.MFAService
+}
+
+func NewMFAHandler(db *pgxpool.Pool) *MFAHandler {
+	svc := service.NewMFAService(repository.NewUserRepository(db), repository.NewTOTPRepository(db))
+	return &MFAHandler{svc: svc}
+}
+
+func (h *MFAHandler) WithService(svc service.MFAService) *MFAHandler {
+	h.svc = svc
+	return h
+}
+
+// Enroll gera um novo segredo TOTP pendente de confirmação
+func (h *MFAHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	userID, _ := auth.UserID(r.Context())
+	enr, err := h.svc.StartEnrollment(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeNoStore(w, EnrollmentResponse{Secret: enr.Secret, OTPAuthURI: enr.URI})
+}
+
+// Confirm ativa o TOTP e devolve os códigos de recuperação, exibidos só desta vez
+func (h *MFAHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, _ := auth.UserID(r.Context())
+	codes, err := h.svc.ConfirmEnrollment(r.Context(), userID, req.Code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeNoStore(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes substitui todos os códigos de recuperação
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, _ := auth.UserID(r.Context())
+	codes, err := h.svc.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeNoStore(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
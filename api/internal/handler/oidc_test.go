@@ -0,0 +1,358 @@
+package handler_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	jwxt "github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/oidc"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// idpUser é quem está "logado" no provedor de teste
+type idpUser struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// pendingCode é um código de autorização emitido e ainda não trocado
+type pendingCode struct {
+	user      idpUser
+	nonce     string
+	challenge string
+	redirect  string
+}
+
+// fakeIdP é um provedor OIDC mínimo: descoberta, autorização, token e JWKS
+type fakeIdP struct {
+	*httptest.Server
+	key jwk.Key
+
+	mu    sync.Mutex
+	user  idpUser
+	codes map[string]pendingCode
+	// nonce, se preenchido, substitui o nonce recebido no ID token emitido
+	nonce string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.Set(jwk.KeyIDKey, "idp-key-1")
+	key.Set(jwk.AlgorithmKey, jwa.RS256)
+	idp := &fakeIdP{key: key, codes: map[string]pendingCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		pub, _ := idp.key.PublicKey()
+		set := jwk.NewSet()
+		set.AddKey(pub)
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) login(u idpUser) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.user = u
+}
+
+func (idp *fakeIdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != "fruit-store" || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+	idp.mu.Lock()
+	code := uuid.NewString()
+	idp.codes[code] = pendingCode{user: idp.user, nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), redirect: q.Get("redirect_uri")}
+	idp.mu.Unlock()
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != "fruit-store" || secret != "idp-secret" || r.PostFormValue("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	idp.mu.Lock()
+	pending, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	nonce := idp.nonce
+	idp.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || pending.redirect != r.PostFormValue("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	if nonce == "" {
+		nonce = pending.nonce
+	}
+
+	now := time.Now()
+	tok, _ := jwxt.NewBuilder().
+		Issuer(idp.URL).
+		Audience([]string{"fruit-store"}).
+		Subject(pending.user.Subject).
+		IssuedAt(now).
+		Expiration(now.Add(5*time.Minute)).
+		Claim("nonce", nonce).
+		Claim("preferred_username", pending.user.Username).
+		Claim("email", pending.user.Email).
+		Claim("groups", pending.user.Groups).
+		Build()
+	signed, err := jwxt.Sign(tok, jwxt.WithKey(jwa.RS256, idp.key))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": string(signed)})
+}
+
+// memIdentityRepo é um IdentityRepository em memória sobre o memUserRepo
+type memIdentityRepo struct {
+	users *memUserRepo
+	links map[string]uuid.UUID
+}
+
+func identityKey(ctx context.Context, provider, subject string) string {
+	tid, _ := tenant.FromContext(ctx)
+	return tid.String() + "|" + provider + "|" + subject
+}
+
+func (m *memIdentityRepo) UserID(ctx context.Context, provider, subject string) (uuid.UUID, error) {
+	id, ok := m.links[identityKey(ctx, provider, subject)]
+	if !ok {
+		return uuid.Nil, repository.ErrIdentityNotFound
+	}
+	return id, nil
+}
+func (m *memIdentityRepo) Provision(ctx context.Context, u *model.User, provider, subject string) error {
+	if _, err := m.users.GetByUsername(ctx, u.Username); err == nil {
+		return repository.ErrUsernameTaken
+	}
+	if err := m.users.Create(ctx, u); err != nil {
+		return err
+	}
+	m.links[identityKey(ctx, provider, subject)] = u.ID
+	return nil
+}
+
+// memStates é um oidc.StateStore em memória
+type memStates map[string]oidc.LoginState
+
+func (m memStates) Save(ctx context.Context, id string, s oidc.LoginState, ttl time.Duration) error {
+	m[id] = s
+	return nil
+}
+func (m memStates) Take(ctx context.Context, id string) (oidc.LoginState, bool, error) {
+	s, ok := m[id]
+	delete(m, id)
+	return s, ok, nil
+}
+
+const oidcCallback = "http://api.test/auth/oidc/empresa/callback"
+
+// oidcRouter monta as rotas de OIDC da API contra o provedor idp e /users/{id} autenticado
+func oidcRouter(t *testing.T, idp *fakeIdP, users *memUserRepo, denylist auth.Denylist) http.Handler {
+	cfg := oidc.Config{
+		Name:         "empresa",
+		Issuer:       idp.URL,
+		ClientID:     "fruit-store",
+		ClientSecret: "idp-secret",
+		RedirectURL:  oidcCallback,
+		Roles:        map[string][]string{"staff": {"user"}, "ti": {"admin", "user"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tokens := newTokens(t)
+	svc := service.NewOIDCService(
+		[]*oidc.Provider{oidc.NewProvider(cfg, idp.Client())},
+		memStates{},
+		newMemTenantRepo(),
+		users,
+		&memIdentityRepo{users: users, links: map[string]uuid.UUID{}},
+		service.NewAuthService(users, newMemTokenRepo(), newMemTOTPRepo(), tokens, nopDenylist{}, newGuard(), memChallenges{}, testPolicy, testRoles),
+		denylist,
+	)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithOIDC(svc)
+	userHandler := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+
+	r := chi.NewRouter()
+	r.Get("/auth/oidc", login.OIDCProviders)
+	r.Get("/auth/oidc/{provider}/login", login.OIDCLogin)
+	r.Get("/auth/oidc/{provider}/callback", login.OIDCCallback)
+	r.With(tokens.Verifier, auth.MustAuth, auth.TenantFromToken).Get("/users/{id}", userHandler.Get)
+	return r
+}
+
+// oidcAuthorize percorre o login como o navegador faria e devolve a URL do callback
+func oidcAuthorize(t *testing.T, router http.Handler, idp *fakeIdP) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/empresa/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("esperado 302 para o provedor, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("provedor recusou a autorização: %s", resp.Status)
+	}
+	return resp.Header.Get("Location")
+}
+
+func oidcCallbackAt(router http.Handler, callback string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, callback, nil))
+	return rec
+}
+
+func TestOIDC_LoginProvisionsUserAndSyncsRolesFromGroups(t *testing.T) {
+	idp := newFakeIdP(t)
+	users, _ := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	denied := revokedUsers{}
+	router := oidcRouter(t, idp, users, denied)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc", nil))
+	var providers []handler.OIDCProviderResponse
+	if err := json.NewDecoder(rec.Body).Decode(&providers); err != nil || len(providers) != 1 || providers[0].Name != "empresa" {
+		t.Fatalf("esperado o provedor empresa, recebeu %s", rec.Body.String())
+	}
+
+	idp.login(idpUser{Subject: "idp|42", Username: "maria.silva", Email: "maria@empresa.test", Groups: []string{"staff", "outros"}})
+	callback := oidcAuthorize(t, router, idp)
+	session := decodeLogin(t, oidcCallbackAt(router, callback))
+	ev := users.outbox.events()
+	if len(ev) != 1 || ev[0].action != "create" || ev[0].user.Username != "maria.silva" {
+		t.Fatalf("esperado um evento create de maria.silva, recebeu %+v", ev)
+	}
+	maria, err := users.GetByUsername(context.Background(), "maria.silva")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maria.PasswordHash != "" || maria.Email != "maria@empresa.test" || !slices.Equal(maria.Roles, []string{"user"}) {
+		t.Fatalf("usuário provisionado inesperado: %+v", maria)
+	}
+	if rec := callAs(router, session.Token, http.MethodGet, "/users/"+maria.ID.String(), "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("token do login OIDC: esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// o state só vale uma vez
+	if rec := oidcCallbackAt(router, callback); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("callback repetido: esperado 401, recebeu %d", rec.Code)
+	}
+
+	// no login seguinte os papéis acompanham os grupos, sem criar outro usuário; o papel
+	// admin é privilegiado, então o login segue para o cadastro obrigatório do TOTP
+	idp.login(idpUser{Subject: "idp|42", Username: "maria.silva", Groups: []string{"ti"}})
+	if c := decodeChallenge(t, oidcCallbackAt(router, oidcAuthorize(t, router, idp))); !c.EnrollmentRequired {
+		t.Fatalf("esperado o cadastro obrigatório do TOTP, recebeu %+v", c)
+	}
+	if !denied[maria.ID.String()] {
+		t.Fatal("os access tokens com os papéis antigos deveriam ser negados")
+	}
+	if len(users.users) != 2 {
+		t.Fatalf("esperado 2 usuários, recebeu %d", len(users.users))
+	}
+	maria, _ = users.GetByID(context.Background(), maria.ID)
+	if !slices.Equal(maria.Roles, []string{"admin", "user"}) {
+		t.Fatalf("papéis não sincronizados: %v", maria.Roles)
+	}
+	ev = users.outbox.events()
+	if len(ev) != 2 || ev[1].action != "update" {
+		t.Fatalf("esperado um evento update, recebeu %+v", ev)
+	}
+	delete(denied, maria.ID.String())
+	decodeChallenge(t, oidcCallbackAt(router, oidcAuthorize(t, router, idp)))
+	if ev := users.outbox.events(); len(ev) != 2 || denied[maria.ID.String()] {
+		t.Fatalf("login sem mudança de papéis não deveria gerar evento nem revogar tokens, recebeu %+v", ev)
+	}
+}
+
+func TestOIDC_RejectsForgedNonceUnmappedGroupsAndProviderErrors(t *testing.T) {
+	idp := newFakeIdP(t)
+	users, _ := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	router := oidcRouter(t, idp, users, nopDenylist{})
+
+	idp.login(idpUser{Subject: "idp|7", Username: "ana", Groups: []string{"staff"}})
+	if rec := oidcCallbackAt(router, oidcAuthorize(t, router, idp)); rec.Code != http.StatusConflict {
+		t.Fatalf("username local já usado: esperado 409, recebeu %d", rec.Code)
+	}
+
+	idp.login(idpUser{Subject: "idp|8", Username: "bruno", Groups: []string{"visitantes"}})
+	if rec := oidcCallbackAt(router, oidcAuthorize(t, router, idp)); rec.Code != http.StatusForbidden {
+		t.Fatalf("grupo sem papel: esperado 403, recebeu %d", rec.Code)
+	}
+
+	idp.login(idpUser{Subject: "idp|8", Username: "bruno", Groups: []string{"staff"}})
+	idp.nonce = "replayed-nonce"
+	if rec := oidcCallbackAt(router, oidcAuthorize(t, router, idp)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("nonce trocado: esperado 401, recebeu %d", rec.Code)
+	}
+	if ev := users.outbox.events(); len(users.users) != 1 || len(ev) != 0 {
+		t.Fatalf("nenhum usuário deveria ter sido criado: %d usuários, eventos %+v", len(users.users), ev)
+	}
+
+	if rec := oidcCallbackAt(router, "/auth/oidc/empresa/callback?error=access_denied"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("erro do provedor: esperado 401, recebeu %d", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/outro/login", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("provedor desconhecido: esperado 404, recebeu %d", rec.Code)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PasswordHandler atende a redefinição de senha por token de uso único
+type PasswordHandler struct {
+	svc service.PasswordResetService
+}
+
+func NewPasswordHandler(db *pgxpool.Pool, denylist auth.Denylist, policy password.Policy, limiter *loginguard.Limiter) *PasswordHandler {
+	svc := service.NewPasswordResetService(
+		repository.NewUserRepository(db),
+		repository.NewPasswordResetRepository(db),
+		repository.NewRefreshTokenRepository(db),
+		denylist,
+		policy,
+		limiter,
+	)
+	return &PasswordHandler{svc: svc}
+}
+
+func (h *PasswordHandler) WithService(svc service.PasswordResetService) *PasswordHandler {
+	h.svc = svc
+	return h
+}
+
+// Forgot responde 202 mesmo para usernames desconhecidos; o token segue em segundo plano
+func (h *PasswordHandler) Forgot(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := h.svc.Forgot(r.Context(), req.Username, clientInfo(r).IP); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Reset troca a senha e encerra as sessões existentes do usuário
+func (h *PasswordHandler) Reset(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := h.svc.Reset(r.Context(), req.Token, req.Password); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,289 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/notify"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// memResetRepo é um PasswordResetRepository em memória que altera a senha em users
+type memResetRepo struct {
+	users    *memUserRepo
+	tokens   map[string]*memResetToken
+	requests []repository.ResetRequest
+}
+
+type memResetToken struct {
+	userID    uuid.UUID
+	tenantID  uuid.UUID
+	expiresAt time.Time
+	used      bool
+}
+
+func (m *memResetRepo) Request(ctx context.Context, username string) error {
+	tid, _ := tenant.FromContext(ctx)
+	m.requests = append(m.requests, repository.ResetRequest{ID: int64(len(m.requests) + 1), TenantID: tid, Username: username})
+	return nil
+}
+
+func (m *memResetRepo) ClaimRequests(ctx context.Context, limit int) ([]repository.ResetRequest, error) {
+	n := min(limit, len(m.requests))
+	claimed := m.requests[:n:n]
+	m.requests = m.requests[n:]
+	return claimed, nil
+}
+
+func (m *memResetRepo) Create(ctx context.Context, userID uuid.UUID, hash string, expiresAt time.Time) error {
+	for h, t := range m.tokens {
+		if t.userID == userID && !t.used {
+			delete(m.tokens, h)
+		}
+	}
+	tid, _ := tenant.FromContext(ctx)
+	m.tokens[hash] = &memResetToken{userID: userID, tenantID: tid, expiresAt: expiresAt}
+	return nil
+}
+
+func (m *memResetRepo) Owner(ctx context.Context, hash string, now time.Time) (uuid.UUID, uuid.UUID, error) {
+	t, ok := m.tokens[hash]
+	if !ok || t.used || !now.Before(t.expiresAt) {
+		return uuid.Nil, uuid.Nil, repository.ErrResetTokenNotFound
+	}
+	return t.userID, t.tenantID, nil
+}
+
+func (m *memResetRepo) Consume(ctx context.Context, hash, passwordHash string, now time.Time) (uuid.UUID, error) {
+	t, ok := m.tokens[hash]
+	if !ok || t.used || !now.Before(t.expiresAt) {
+		return uuid.Nil, repository.ErrResetTokenNotFound
+	}
+	t.used = true
+	u := m.users.users[t.userID]
+	u.PasswordHash, u.MustChangePassword = passwordHash, false
+	m.users.users[t.userID] = u
+	return t.userID, nil
+}
+
+// outbox recebe as mensagens em vez de enviá-las
+type outbox chan notify.Message
+
+func newOutbox() outbox {
+	return make(outbox, 10)
+}
+
+func (o outbox) Notify(ctx context.Context, m notify.Message) error {
+	o <- m
+	return nil
+}
+
+// next devolve a próxima mensagem entregue
+func (o outbox) next(t *testing.T) notify.Message {
+	t.Helper()
+	select {
+	case m := <-o:
+		return m
+	default:
+		t.Fatal("nenhuma mensagem entregue")
+		return notify.Message{}
+	}
+}
+
+// newPasswordHandler monta o handler sobre resets e o sender que entrega as mensagens em sent
+func newPasswordHandler(users *memUserRepo, resets *memResetRepo, refresh repository.RefreshTokenRepository, sent outbox) (*handler.PasswordHandler, service.PasswordResetSender) {
+	h := handler.NewPasswordHandler(nil, nil, testPolicy, nil).WithService(
+		service.NewPasswordResetService(users, resets, refresh, nopDenylist{}, testPolicy, newForgotLimiter()))
+	return h, service.NewPasswordResetSender(users, resets, sent)
+}
+
+// sendPending faz o papel do worker e atende os pedidos pendentes
+func sendPending(t *testing.T, sender service.PasswordResetSender) {
+	t.Helper()
+	if _, err := sender.SendPending(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newForgotLimiter() *loginguard.Limiter {
+	return loginguard.NewLimiter(newMemStore(), "forgot", loginguard.LimitPolicy{PerUser: 3, PerIP: 10, Window: time.Minute})
+}
+
+// resetToken extrai o token do corpo da mensagem, que fica sozinho numa linha
+func resetToken(t *testing.T, m notify.Message) string {
+	t.Helper()
+	lines := strings.Split(m.Body, "\n")
+	if len(lines) < 3 || lines[2] == "" {
+		t.Fatalf("token ausente na mensagem: %q", m.Body)
+	}
+	return lines[2]
+}
+
+func TestPasswordReset_SingleUseAndEndsSessions(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "old-pass", "user")
+	refresh := newMemTokenRepo()
+	resets := &memResetRepo{users: users, tokens: map[string]*memResetToken{}}
+	sent := newOutbox()
+	h, sender := newPasswordHandler(users, resets, refresh, sent)
+	authSvc := service.NewAuthService(users, refresh, newMemTOTPRepo(), newTokens(t), nopDenylist{}, newGuard(), memChallenges{}, testPolicy, testRoles)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(authSvc)
+
+	session := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"ana","password":"old-pass"}`))
+
+	// usernames desconhecidos recebem a mesma resposta e nenhuma mensagem; os pedidos
+	// são atendidos em ordem, então a mensagem de ana só chega depois do ghost
+	for _, name := range []string{"ghost", "ana"} {
+		if rec := postJSON(h.Forgot, "/auth/password/forgot", `{"username":"`+name+`"}`); rec.Code != http.StatusAccepted {
+			t.Fatalf("%s: esperado 202, recebeu %d", name, rec.Code)
+		}
+	}
+	sendPending(t, sender)
+	msg := sent.next(t)
+	if msg.To != "ana" || len(sent) != 0 {
+		t.Fatalf("esperada uma única mensagem para ana, recebeu %q e mais %d", msg.To, len(sent))
+	}
+	token := resetToken(t, msg)
+	if len(msg.Secrets) != 1 || msg.Secrets[0] != token {
+		t.Fatal("o token deve ser marcado como segredo para não aparecer no log")
+	}
+	for hash := range resets.tokens {
+		if hash == token {
+			t.Fatal("o token não pode ser guardado em claro")
+		}
+	}
+
+	body := `{"token":"` + token + `","password":"Fresh-Start-42"}`
+	if rec := postJSON(h.Reset, "/auth/password/reset", body); rec.Code != http.StatusNoContent {
+		t.Fatalf("esperado 204, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(users.users[u.ID].PasswordHash), []byte("Fresh-Start-42")); err != nil {
+		t.Fatal("a senha deveria ter sido trocada")
+	}
+	if rec := postJSON(h.Reset, "/auth/password/reset", body); rec.Code != http.StatusBadRequest {
+		t.Fatalf("o token é de uso único: esperado 400, recebeu %d", rec.Code)
+	}
+	// as sessões abertas com a senha antiga foram encerradas
+	if rec := postJSON(login.Refresh, "/auth/refresh", `{"refresh_token":"`+session.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 no refresh após a redefinição, recebeu %d", rec.Code)
+	}
+}
+
+func TestPasswordReset_NewRequestReplacesPrevious(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "old-pass", "user")
+	resets := &memResetRepo{users: users, tokens: map[string]*memResetToken{}}
+	sent := newOutbox()
+	h, sender := newPasswordHandler(users, resets, newMemTokenRepo(), sent)
+
+	postJSON(h.Forgot, "/auth/password/forgot", `{"username":"ana"}`)
+	postJSON(h.Forgot, "/auth/password/forgot", `{"username":"ana"}`)
+	sendPending(t, sender)
+	first, second := resetToken(t, sent.next(t)), resetToken(t, sent.next(t))
+
+	if rec := postJSON(h.Reset, "/auth/password/reset", `{"token":"`+first+`","password":"Fresh-Start-42"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("o pedido anterior deveria ter sido descartado: esperado 400, recebeu %d", rec.Code)
+	}
+	if rec := postJSON(h.Reset, "/auth/password/reset", `{"token":"`+second+`","password":""}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("senha vazia: esperado 400, recebeu %d", rec.Code)
+	}
+	if rec := postJSON(h.Reset, "/auth/password/reset", `{"token":"`+second+`","password":"Fresh-Start-42"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("esperado 204, recebeu %d", rec.Code)
+	}
+}
+
+func TestPasswordForgot_RateLimited(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "old-pass", "user")
+	resets := &memResetRepo{users: users, tokens: map[string]*memResetToken{}}
+	sent := newOutbox()
+	h, sender := newPasswordHandler(users, resets, newMemTokenRepo(), sent)
+
+	// acima do limite por username a resposta continua 202, para que ninguém bloqueie
+	// a redefinição de outra conta, e vale igualmente para usernames existentes e desconhecidos
+	for _, name := range []string{"ana", "ghost"} {
+		for i := 0; i < 5; i++ {
+			if rec := postJSON(h.Forgot, "/auth/password/forgot", `{"username":"`+name+`"}`); rec.Code != http.StatusAccepted {
+				t.Fatalf("%s, pedido %d: esperado 202, recebeu %d", name, i+1, rec.Code)
+			}
+		}
+	}
+	sendPending(t, sender)
+	for i := 0; i < 3; i++ {
+		if msg := sent.next(t); msg.To != "ana" {
+			t.Fatalf("esperada mensagem para ana, recebeu %q", msg.To)
+		}
+	}
+	if len(sent) != 0 {
+		t.Fatalf("os pedidos acima do limite por username deveriam ser descartados, recebeu mais %d", len(sent))
+	}
+
+	// só o limite por IP responde 429
+	rec := postJSON(h.Forgot, "/auth/password/forgot", `{"username":"bob"}`)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("esperado 429 com Retry-After, recebeu %d", rec.Code)
+	}
+}
+
+func TestLogin_SeededAccountMustChangePassword(t *testing.T) {
+	users, u := newMemUserRepo(t, "seed", "adminpass", "user")
+	seeded := users.users[u.ID]
+	seeded.MustChangePassword = true
+	users.users[u.ID] = seeded
+	h := newLoginHandler(t, users, newGuard())
+
+	rec := postJSON(h.Login, "/auth/login", `{"username":"seed","password":"adminpass"}`)
+	var challenge handler.PasswordChangeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&challenge); err != nil || !challenge.PasswordChangeRequired {
+		t.Fatalf("esperado desafio de troca de senha, recebeu %d: %v", rec.Code, err)
+	}
+	// o desafio de troca não vale como segundo fator
+	if rec := postJSON(h.VerifyMFA, "/auth/2fa/verify", verifyBody(challenge.ChallengeToken, "123456")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("esperado 401 ao usar o desafio no 2FA, recebeu %d", rec.Code)
+	}
+
+	change := func(pw string) *httptest.ResponseRecorder {
+		return postJSON(h.ChangePassword, "/auth/password/change",
+			`{"challenge_token":"`+challenge.ChallengeToken+`","password":"`+pw+`"}`)
+	}
+	for _, weak := range []string{"adminpass", "Qwerty123!", "short1A!"} {
+		if rec := change(weak); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%q deveria ser rejeitada, recebeu %d", weak, rec.Code)
+		}
+	}
+	login := decodeLogin(t, change("Ripe-Mango-2025"))
+	if login.Token == "" {
+		t.Fatal("a troca deveria concluir o login")
+	}
+	if users.users[u.ID].MustChangePassword {
+		t.Fatal("a troca obrigatória deveria ter sido concluída")
+	}
+	if rec := change("Other-Mango-2025"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("o desafio é de uso único: esperado 401, recebeu %d", rec.Code)
+	}
+	decodeLogin(t, postJSON(h.Login, "/auth/login", `{"username":"seed","password":"Ripe-Mango-2025"}`))
+}
+
+func TestLogin_RehashesWhenCostIsRaised(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "s3cret-pass", "user")
+	policy := testPolicy
+	policy.Cost = bcrypt.MinCost + 1
+	svc := service.NewAuthService(users, newMemTokenRepo(), newMemTOTPRepo(), newTokens(t), nopDenylist{}, newGuard(), memChallenges{}, policy, testRoles)
+	h := handler.NewLoginHandler(nil, nil, nil, nil, nil, policy, nil).WithService(svc)
+
+	decodeLogin(t, postJSON(h.Login, "/auth/login", `{"username":"ana","password":"s3cret-pass"}`))
+	cost, err := bcrypt.Cost([]byte(users.users[u.ID].PasswordHash))
+	if err != nil || cost != policy.Cost {
+		t.Fatalf("esperado hash refeito com custo %d, recebeu %d (%v)", policy.Cost, cost, err)
+	}
+	decodeLogin(t, postJSON(h.Login, "/auth/login", `{"username":"ana","password":"s3cret-pass"}`))
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// RoleHandler gerencia papéis e permissões
+type RoleHandler struct {
+	svc service.RoleService
+}
+
+// NewRoleHandler recebe o mesmo RoleService usado por auth.RequirePermission,
+// para que as alterações limpem o cache de permissões desta instância
+func NewRoleHandler(svc service.RoleService) *RoleHandler {
+	return &RoleHandler{svc: svc}
+}
+
+func (h *RoleHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	perms, err := h.svc.ListPermissions(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, perms)
+}
+
+func (h *RoleHandler) List(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.svc.ListRoles(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, roles)
+}
+
+func (h *RoleHandler) Get(w http.ResponseWriter, r *http.Request) {
+	role, err := h.svc.GetRole(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+func (h *RoleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var in model.RoleInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	role, err := h.svc.CreateRole(r.Context(), in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/roles/"+role.Name)
+	writeJSON(w, http.StatusCreated, role)
+}
+
+// Update substitui a descrição e as permissões do papel {name}
+func (h *RoleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var in model.RoleInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	if in.Name != "" && in.Name != chi.URLParam(r, "name") {
+		problem.Error(w, r, http.StatusBadRequest, "role name cannot be changed")
+		return
+	}
+	role, err := h.svc.UpdateRole(r.Context(), chi.URLParam(r, "name"), in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, role)
+}
+
+func (h *RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeleteRole(r.Context(), chi.URLParam(r, "name")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
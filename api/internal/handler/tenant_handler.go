@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// TenantResponse é a loja criada junto com o seu primeiro administrador
+type TenantResponse struct {
+	model.Tenant
+	Admin UserResponse `json:"admin"`
+}
+
+// TenantHandler gerencia as lojas hospedadas na implantação
+type TenantHandler struct {
+	svc service.TenantService
+}
+
+func NewTenantHandler(db *pgxpool.Pool, policy password.Policy) *TenantHandler {
+	svc := service.NewTenantService(repository.NewTenantRepository(db), repository.NewUserRepository(db), policy)
+	return &TenantHandler{svc: svc}
+}
+
+func (h *TenantHandler) WithService(svc service.TenantService) *TenantHandler {
+	h.svc = svc
+	return h
+}
+
+func (h *TenantHandler) List(w http.ResponseWriter, r *http.Request) {
+	tenants, err := h.svc.ListTenants(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tenants)
+}
+
+func (h *TenantHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var in model.TenantInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	t, admin, err := h.svc.CreateTenant(r.Context(), in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, TenantResponse{Tenant: t, Admin: newUserResponse(admin)})
+}
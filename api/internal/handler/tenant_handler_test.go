@@ -0,0 +1,175 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// memTenantRepo é um TenantRepository em memória, já com a loja padrão
+type memTenantRepo struct {
+	tenants map[uuid.UUID]model.Tenant
+}
+
+func newMemTenantRepo() *memTenantRepo {
+	d := model.Tenant{ID: tenant.Default, Slug: "default", Name: "Fruit Store"}
+	return &memTenantRepo{tenants: map[uuid.UUID]model.Tenant{d.ID: d}}
+}
+
+func (m *memTenantRepo) Create(ctx context.Context, t *model.Tenant) error {
+	if _, err := m.ResolveTenant(ctx, t.Slug); err == nil {
+		return repository.ErrSlugTaken
+	}
+	t.ID, t.CreatedAt = uuid.New(), time.Now()
+	m.tenants[t.ID] = *t
+	return nil
+}
+func (m *memTenantRepo) List(ctx context.Context) ([]model.Tenant, error) {
+	list := []model.Tenant{}
+	for _, t := range m.tenants {
+		list = append(list, t)
+	}
+	return list, nil
+}
+func (m *memTenantRepo) ResolveTenant(ctx context.Context, slug string) (uuid.UUID, error) {
+	for _, t := range m.tenants {
+		if t.Slug == slug {
+			return t.ID, nil
+		}
+	}
+	return uuid.Nil, tenant.ErrUnknown
+}
+func (m *memTenantRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(m.tenants, id)
+	return nil
+}
+
+// tenantRouter monta login, /users e /tenants com os middlewares de loja do servidor
+func tenantRouter(t *testing.T, tenants *memTenantRepo, users *memUserRepo) (http.Handler, *auth.Tokens) {
+	tokens := newTokens(t)
+	authSvc := service.NewAuthService(users, newMemTokenRepo(), newMemTOTPRepo(), tokens, nopDenylist{}, newGuard(), memChallenges{}, testPolicy, testRoles)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(authSvc)
+	userHandler := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+	tenantHandler := handler.NewTenantHandler(nil, testPolicy).WithService(
+		service.NewTenantService(tenants, users, testPolicy))
+
+	r := chi.NewRouter()
+	r.With(tenant.FromHeader(tenants)).Post("/auth/login", login.Login)
+	r.Group(func(r chi.Router) {
+		r.Use(tokens.Verifier, auth.MustAuth, auth.TenantFromToken)
+		r.Get("/users", userHandler.List)
+		r.Get("/users/{id}", userHandler.Get)
+		r.With(tenant.RequireOperator, auth.RequirePermission(testRoles, model.PermTenantsManage)).Post("/tenants", tenantHandler.Create)
+	})
+	return r, tokens
+}
+
+// loginAt autentica username na loja slug ("" usa a loja padrão)
+func loginAt(router http.Handler, slug, username, password string) *httptest.ResponseRecorder {
+	body := `{"username":"` + username + `","password":"` + password + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(body))
+	if slug != "" {
+		req.Header.Set(tenant.Header, slug)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTenants_UsersAndLockoutsDoNotCrossStores(t *testing.T) {
+	users, defaultAna := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	tenants := newMemTenantRepo()
+	router, tokens := tenantRouter(t, tenants, users)
+
+	newTenant := `{"slug":"pomar","name":"Pomar do Zé","admin_username":"gerente","admin_password":"Green-Apple-2025"}`
+	// na loja padrão, criar lojas ainda exige a permissão tenants:manage
+	plain := decodeLogin(t, loginAt(router, "", "ana", "Ripe-Mango-2025"))
+	if rec := callAs(router, plain.Token, http.MethodPost, "/tenants", "application/json", newTenant); rec.Code != http.StatusForbidden {
+		t.Fatalf("operador sem tenants:manage: esperado 403, recebeu %d", rec.Code)
+	}
+	operator, err := tokens.IssueSubject(auth.Subject{UserID: uuid.NewString(), TenantID: tenant.Default.String(), Roles: []string{model.RoleAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := callAs(router, operator, http.MethodPost, "/tenants", "application/json", newTenant)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("esperado 201 ao criar a loja, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var created handler.TenantResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	ev := users.outbox.events()
+	if len(ev) != 1 || ev[0].action != "create" || ev[0].user.TenantID != created.ID {
+		t.Fatalf("esperado um evento create do administrador da nova loja, recebeu %+v", ev)
+	}
+
+	// o mesmo username existe nas duas lojas, cada um com a sua senha
+	hash, err := testPolicy.Hash("Green-Apple-2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pomarAna := model.User{Username: "ana", PasswordHash: hash, Roles: []string{"user"}}
+	if err := users.Create(tenant.WithID(context.Background(), created.ID), &pomarAna); err != nil {
+		t.Fatal(err)
+	}
+	if rec := loginAt(router, "pomar", "ana", "Ripe-Mango-2025"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("senha de outra loja: esperado 401, recebeu %d", rec.Code)
+	}
+	session := decodeLogin(t, loginAt(router, "pomar", "ana", "Green-Apple-2025"))
+	if rec := loginAt(router, "nope", "ana", "Green-Apple-2025"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("loja desconhecida: esperado 400, recebeu %d", rec.Code)
+	}
+
+	if rec := callAs(router, session.Token, http.MethodGet, "/users/"+defaultAna.ID.String(), "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("usuário de outra loja: esperado 404, recebeu %d", rec.Code)
+	}
+	rec = callAs(router, session.Token, http.MethodGet, "/users", "", "")
+	var page handler.UserListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 {
+		t.Fatalf("esperado só os 2 usuários da nova loja, recebeu %+v", page)
+	}
+	for _, u := range page.Items {
+		if u.ID == defaultAna.ID {
+			t.Fatalf("listagem vazou um usuário da loja padrão: %+v", page)
+		}
+	}
+	if rec := callAs(router, session.Token, http.MethodPost, "/tenants", "application/json", `{}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("loja comum criando lojas: esperado 403, recebeu %d", rec.Code)
+	}
+
+	// bloquear ana em uma loja não bloqueia a ana da outra
+	for i := 0; i < 3; i++ {
+		loginAt(router, "pomar", "ana", "wrong")
+	}
+	if rec := loginAt(router, "pomar", "ana", "Green-Apple-2025"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("esperado 429 após o bloqueio, recebeu %d", rec.Code)
+	}
+	decodeLogin(t, loginAt(router, "", "ana", "Ripe-Mango-2025"))
+
+	legacy, err := tokens.Issue(defaultAna.ID.String(), defaultAna.Roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := callAs(router, legacy, http.MethodGet, "/users", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("token sem loja: esperado 401, recebeu %d", rec.Code)
+	}
+}
@@ -1,75 +1,224 @@
 package handler
 
 import (
-	"encoding/json"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
-	"github.com/hsalmeida/fruit-store-monorepo/api/internal/publisher"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// UserResponse é o usuário visto pelos administradores em /users
+type UserResponse struct {
+	ID                 uuid.UUID  `json:"id"`
+	Username           string     `json:"username"`
+	DisplayName        string     `json:"display_name"`
+	Email              string     `json:"email,omitempty"`
+	Roles              []string   `json:"roles"`
+	Disabled           bool       `json:"disabled"`
+	DisabledAt         *time.Time `json:"disabled_at,omitempty"`
+	MustChangePassword bool       `json:"must_change_password"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+func newUserResponse(u model.User) UserResponse {
+	return UserResponse{
+		ID:                 u.ID,
+		Username:           u.Username,
+		DisplayName:        u.DisplayName,
+		Email:              u.Email,
+		Roles:              u.Roles,
+		Disabled:           u.Disabled(),
+		DisabledAt:         u.DisabledAt,
+		MustChangePassword: u.MustChangePassword,
+		CreatedAt:          u.CreatedAt,
+		UpdatedAt:          u.UpdatedAt,
+	}
+}
+
+// UserListResponse é uma página de GET /users; total conta todos os usuários do filtro
+type UserListResponse struct {
+	Items  []UserResponse `json:"items"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// UserHandler gerencia os usuários da loja; os eventos da fila user.queue saem pela
+// outbox gravada junto com cada alteração
 type UserHandler struct {
 	svc service.UserService
-	pub publisher.EventPublisher
 }
 
-func NewUserHandler(db *pgxpool.Pool, pub publisher.EventPublisher) *UserHandler {
+func NewUserHandler(db *pgxpool.Pool, denylist auth.Denylist, policy password.Policy) *UserHandler {
 	repo := repository.NewUserRepository(db)
-	svc := service.NewUserService(repo)
-	return &UserHandler{svc: svc, pub: pub}
+	svc := service.NewUserService(repo, repository.NewRefreshTokenRepository(db), denylist, policy)
+	return &UserHandler{svc: svc}
+}
+
+func (h *UserHandler) WithService(svc service.UserService) *UserHandler {
+	h.svc = svc
+	return h
 }
 
 func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
+	var req model.NewUser
+	if !decodeJSON(w, r, &req) {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+
+	if _, err := h.svc.CreateUser(r.Context(), req); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	hash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	u := model.User{
-		Username:     req.Username,
-		PasswordHash: string(hash),
-		Role:         req.Role,
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// List aceita ?q= (busca em username, nome e e-mail), ?role=, ?limit= e ?offset=
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := model.UserFilter{Query: q.Get("q"), Role: q.Get("role")}
+	for name, dst := range map[string]*int{"limit": &f.Limit, "offset": &f.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				problem.Error(w, r, http.StatusBadRequest, name+" must be an integer")
+				return
+			}
+			*dst = n
+		}
 	}
 
-	if err := h.svc.CreateUser(r.Context(), &u); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	page, err := h.svc.ListUsers(r.Context(), f)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	su := model.SimpleUser{
-		Username:  u.Username,
-		Role:      u.Role,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+	resp := UserListResponse{
+		Items:  make([]UserResponse, 0, len(page.Users)),
+		Total:  page.Total,
+		Limit:  page.Limit,
+		Offset: page.Offset,
 	}
+	for _, u := range page.Users {
+		resp.Items = append(resp.Items, newUserResponse(u))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	if err := h.pub.Publish("create", su); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+func (h *UserHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	u, err := h.svc.GetUser(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, newUserResponse(u))
+}
 
-	w.WriteHeader(http.StatusAccepted)
+// Update substitui username, papéis e estado da conta do usuário {id}
+func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	var in model.UserInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	actor, _ := auth.UserID(r.Context())
+	u, err := h.svc.UpdateUser(r.Context(), actor, id, in)
+	h.updated(w, r, u, err)
 }
 
-func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
-	users, err := h.svc.GetAllUsers()
+// Patch aplica um JSON Merge Patch sobre username, roles e disabled do usuário {id}
+func (h *UserHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != mergepatch.ContentType {
+		problem.Error(w, r, http.StatusUnsupportedMediaType, "content type must be "+mergepatch.ContentType)
+		return
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, http.StatusBadRequest, "could not read request body")
+		return
+	}
+	actor, _ := auth.UserID(r.Context())
+	u, err := h.svc.PatchUser(r.Context(), actor, id, patch)
+	h.updated(w, r, u, err)
+}
+
+// SetRoles substitui os papéis do usuário {id}
+func (h *UserHandler) SetRoles(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	var in model.UserRolesInput
+	if !decodeJSON(w, r, &in) {
+		return
+	}
+	actor, _ := auth.UserID(r.Context())
+	u, err := h.svc.SetRoles(r.Context(), actor, id, in.Roles)
+	h.updated(w, r, u, err)
+}
+
+// Disable desativa a conta {id}: o login é recusado e os tokens emitidos deixam de valer
+func (h *UserHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// Enable reativa a conta {id}
+func (h *UserHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	actor, _ := auth.UserID(r.Context())
+	if err := h.svc.DeleteUser(r.Context(), actor, id); err != nil {
+		writeError(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(users); err != nil {
-		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+func (h *UserHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	actor, _ := auth.UserID(r.Context())
+	u, err := h.svc.SetDisabled(r.Context(), actor, id, disabled)
+	h.updated(w, r, u, err)
+}
+
+// updated responde com o usuário alterado
+func (h *UserHandler) updated(w http.ResponseWriter, r *http.Request, u model.User, err error) {
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, newUserResponse(u))
 }
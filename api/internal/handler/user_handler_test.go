@@ -0,0 +1,495 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// userEvent é uma mensagem publicada no lugar da fila
+type userEvent struct {
+	event.Envelope
+	action string
+	user   model.SimpleUser
+}
+
+// memPublisher guarda os eventos em vez de publicá-los; down simula o broker fora do ar
+type memPublisher struct {
+	events []userEvent
+	down   bool
+}
+
+func (p *memPublisher) Publish(e event.Envelope) error {
+	if p.down {
+		return errors.New("broker unavailable")
+	}
+	var u model.SimpleUser
+	if err := json.Unmarshal(e.Data, &u); err != nil {
+		return err
+	}
+	p.events = append(p.events, userEvent{Envelope: e, action: e.Action, user: u})
+	return nil
+}
+
+// outboxRow é uma linha da outbox em memória
+type outboxRow struct {
+	model.OutboxEvent
+	next   time.Time
+	sent   bool
+	sentAt time.Time
+}
+
+// memOutbox é um OutboxRepository em memória, preenchido pelo memUserRepo
+type memOutbox struct {
+	rows   []*outboxRow
+	lastID int64
+}
+
+func (o *memOutbox) nextID() int64 {
+	o.lastID++
+	return o.lastID
+}
+
+// add grava o evento com os metadados de ctx, como o enqueueUserEvent do repositório
+func (o *memOutbox) add(ctx context.Context, action string, u model.User) {
+	payload, _ := json.Marshal(model.NewSimpleUser(u))
+	meta := event.MetadataFrom(ctx)
+	o.rows = append(o.rows, &outboxRow{OutboxEvent: model.OutboxEvent{
+		ID: o.nextID(), Action: action, Payload: payload, CreatedAt: time.Now(), EventID: uuid.New(),
+		CorrelationID: meta.CorrelationID, Actor: meta.Actor,
+	}})
+}
+
+// events devolve tudo o que foi gravado na outbox, enviado ou não
+func (o *memOutbox) events() []userEvent {
+	list := []userEvent{}
+	for _, r := range o.rows {
+		var u model.SimpleUser
+		json.Unmarshal(r.Payload, &u)
+		list = append(list, userEvent{action: r.Action, user: u})
+	}
+	return list
+}
+
+func (o *memOutbox) find(id int64) *outboxRow {
+	for _, r := range o.rows {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (o *memOutbox) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	now := time.Now()
+	list := []model.OutboxEvent{}
+	for _, r := range o.rows {
+		if len(list) < limit && !r.sent && !r.next.After(now) {
+			r.next = now.Add(lease)
+			list = append(list, r.OutboxEvent)
+		}
+	}
+	return list, nil
+}
+func (o *memOutbox) MarkSent(ctx context.Context, id int64) error {
+	r := o.find(id)
+	r.sent, r.sentAt = true, time.Now()
+	return nil
+}
+func (o *memOutbox) Fail(ctx context.Context, id int64, at time.Time, lastErr string) error {
+	r := o.find(id)
+	r.Attempts++
+	r.next = at
+	return nil
+}
+func (o *memOutbox) Postpone(ctx context.Context, ids []int64, at time.Time) error {
+	for _, id := range ids {
+		o.find(id).next = at
+	}
+	return nil
+}
+
+func (o *memOutbox) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	kept := o.rows[:0]
+	for _, r := range o.rows {
+		if !r.sent || !r.sentAt.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	n := int64(len(o.rows) - len(kept))
+	o.rows = kept
+	return n, nil
+}
+
+// retryNow antecipa as próximas tentativas, simulando o fim do backoff
+func (o *memOutbox) retryNow() {
+	for _, r := range o.rows {
+		r.next = time.Time{}
+	}
+}
+
+func TestCreateUser_EventSurvivesBrokerOutage(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "admin")
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+	broker := &memPublisher{down: true}
+	relay := service.NewOutboxService(users.outbox, broker)
+
+	for _, name := range []string{"bia", "caio"} {
+		rec := postJSON(h.Create, "/users", `{"username":"`+name+`","password":"Green-Apple-2025","roles":["user"]}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("o cadastro não depende do broker: esperado 202, recebeu %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if n, err := relay.Relay(context.Background(), 10); err == nil || n != 0 {
+		t.Fatalf("broker fora do ar: esperado erro e nenhum envio, recebeu %d, %v", n, err)
+	}
+	if n, err := relay.Relay(context.Background(), 10); err != nil || n != 0 {
+		t.Fatalf("durante o backoff nada deveria ser tentado, recebeu %d, %v", n, err)
+	}
+	if users.outbox.rows[0].Attempts != 1 || users.outbox.rows[1].Attempts != 0 {
+		t.Fatalf("só o primeiro evento foi tentado: %+v %+v", users.outbox.rows[0], users.outbox.rows[1])
+	}
+
+	broker.down = false
+	users.outbox.retryNow()
+	if n, err := relay.Relay(context.Background(), 10); err != nil || n != 2 {
+		t.Fatalf("broker de volta: esperado 2 envios, recebeu %d, %v", n, err)
+	}
+	if len(broker.events) != 2 || broker.events[0].user.Username != "bia" || broker.events[1].user.Username != "caio" {
+		t.Fatalf("esperados os eventos create na ordem da outbox, recebeu %+v", broker.events)
+	}
+	if e := broker.events[0]; e.ID != users.outbox.rows[0].EventID || e.Type != event.UserCreated ||
+		e.SchemaVersion != event.SchemaVersion || e.Producer != event.Producer {
+		t.Fatalf("o envelope reenviado deve manter o ID gravado na outbox, recebeu %+v", e.Envelope)
+	}
+	if n, _ := relay.Relay(context.Background(), 10); n != 0 || len(broker.events) != 2 {
+		t.Fatalf("eventos enviados não devem ser reenviados, recebeu %d", n)
+	}
+}
+
+func TestDisableUser_BlocksLoginAndRefresh(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	refresh := newMemTokenRepo()
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, refresh, nopDenylist{}, testPolicy))
+	authSvc := service.NewAuthService(users, refresh, newMemTOTPRepo(), newTokens(t), nopDenylist{}, newGuard(), memChallenges{}, testPolicy, testRoles)
+	login := handler.NewLoginHandler(nil, nil, nil, nil, nil, testPolicy, nil).WithService(authSvc)
+
+	session := decodeLogin(t, postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`))
+
+	req := withID(httptest.NewRequest(http.MethodPost, "/users/"+u.ID.String()+"/disable", nil), u.ID.String())
+	rec := httptest.NewRecorder()
+	h.Disable(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	ev := users.outbox.events()
+	if len(ev) != 1 || ev[0].action != "update" || !ev[0].user.Disabled {
+		t.Fatalf("esperado um evento update com disabled=true, recebeu %+v", ev)
+	}
+
+	if rec := postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("conta desativada: esperado 403 no login, recebeu %d", rec.Code)
+	}
+	if rec := postJSON(login.Refresh, "/auth/refresh", `{"refresh_token":"`+session.RefreshToken+`"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("conta desativada: esperado 401 no refresh, recebeu %d", rec.Code)
+	}
+
+	req = withID(httptest.NewRequest(http.MethodPost, "/users/"+u.ID.String()+"/enable", nil), u.ID.String())
+	h.Enable(httptest.NewRecorder(), req)
+	if rec := postJSON(login.Login, "/auth/login", `{"username":"ana","password":"Ripe-Mango-2025"}`); rec.Code != http.StatusOK {
+		t.Fatalf("conta reativada: esperado 200 no login, recebeu %d", rec.Code)
+	}
+}
+
+func TestPatchUser_ChangesRolesAndPublishesUpdate(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := withID(httptest.NewRequest(http.MethodPatch, "/users/"+u.ID.String(), bytes.NewBufferString(body)), u.ID.String())
+		req.Header.Set("Content-Type", mergepatch.ContentType)
+		rec := httptest.NewRecorder()
+		h.Patch(rec, req)
+		return rec
+	}
+
+	rec := patch(`{"roles":["admin","user"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	var got handler.UserResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Username != "ana" || len(got.Roles) != 2 || got.Roles[0] != "admin" {
+		t.Errorf("o patch deveria manter o username e trocar os papéis, recebeu %+v", got)
+	}
+	ev := users.outbox.events()
+	if len(ev) != 1 || ev[0].action != "update" || ev[0].user.ID != u.ID {
+		t.Fatalf("esperado um evento update do usuário, recebeu %+v", ev)
+	}
+
+	if rec := patch(`{"roles":[]}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("sem papéis: esperado 400, recebeu %d", rec.Code)
+	}
+	if ev := users.outbox.events(); len(ev) != 1 {
+		t.Fatalf("alterações rejeitadas não geram eventos, recebeu %+v", ev)
+	}
+}
+
+func TestDeleteUser_PublishesDelete(t *testing.T) {
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+
+	req := withID(httptest.NewRequest(http.MethodDelete, "/users/"+u.ID.String(), nil), u.ID.String())
+	rec := httptest.NewRecorder()
+	h.Delete(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("esperado 204, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := users.users[u.ID]; ok {
+		t.Error("o usuário deveria ter sido removido")
+	}
+	ev := users.outbox.events()
+	if len(ev) != 1 || ev[0].action != "delete" || ev[0].user.Username != "ana" {
+		t.Fatalf("esperado um evento delete do usuário, recebeu %+v", ev)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Delete(rec, withID(httptest.NewRequest(http.MethodDelete, "/users/"+u.ID.String(), nil), u.ID.String()))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("esperado 404, recebeu %d", rec.Code)
+	}
+}
+
+func TestListUsers_PaginatesAndSearches(t *testing.T) {
+	users, _ := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "user")
+	for _, name := range []string{"bia", "caio", "diana", "joana"} {
+		u := model.User{ID: uuid.New(), Username: name, Roles: []string{"user"}}
+		users.users[u.ID] = u
+	}
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+
+	list := func(query string) (int, handler.UserListResponse) {
+		rec := httptest.NewRecorder()
+		h.List(rec, httptest.NewRequest(http.MethodGet, "/users"+query, nil))
+		var page handler.UserListResponse
+		json.NewDecoder(rec.Body).Decode(&page)
+		return rec.Code, page
+	}
+
+	code, page := list("?q=AN&limit=2")
+	if code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d", code)
+	}
+	if page.Total != 3 || page.Limit != 2 || len(page.Items) != 2 || page.Items[0].Username != "ana" || page.Items[1].Username != "diana" {
+		t.Fatalf("primeira página inesperada: %+v", page)
+	}
+	if _, page := list("?q=an&limit=2&offset=2"); len(page.Items) != 1 || page.Items[0].Username != "joana" {
+		t.Fatalf("segunda página inesperada: %+v", page)
+	}
+	if _, page := list(""); page.Total != 5 || page.Limit != 50 {
+		t.Fatalf("sem filtro: esperados 5 usuários e o limite padrão, recebeu %+v", page)
+	}
+	for _, query := range []string{"?limit=500", "?offset=-1", "?limit=dez"} {
+		if code, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("%s: esperado 400, recebeu %d", query, code)
+		}
+	}
+}
+
+// secret é o valor gravado nos campos sigilosos; ele não pode aparecer em nenhum JSON
+const secret = "s3cr3t-sentinel"
+
+func TestResponses_NeverSerializeSecrets(t *testing.T) {
+	now := time.Now()
+	models := map[string]interface{}{
+		"User":         model.User{ID: uuid.New(), Username: "ana", PasswordHash: secret},
+		"APIKey":       model.APIKey{ID: uuid.New(), KeyHash: secret},
+		"TOTP":         model.TOTP{UserID: uuid.New(), Secret: secret},
+		"RefreshToken": model.RefreshToken{ID: uuid.New(), TokenHash: secret, ExpiresAt: now},
+		"SigningKey":   model.SigningKey{ID: "k1", PrivateKey: []byte(secret)},
+	}
+	for name, v := range models {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// []byte sai em base64: "czNjcjN0" é o início de secret codificado
+		if strings.Contains(string(b), secret) || strings.Contains(string(b), "czNjcjN0") {
+			t.Errorf("model.%s serializa um campo sigiloso: %s", name, b)
+		}
+	}
+
+	hash := "$2a$04$" + secret
+	users, u := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "admin")
+	stored := users.users[u.ID]
+	stored.PasswordHash = hash
+	users.users[u.ID] = stored
+	tokens := newTokens(t)
+	userHandler := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+	me := meRouter(tokens, handler.NewMeHandler(nil, nil, nil, testPolicy).WithService(
+		service.NewAccountService(users, newMemTokenRepo(), nopDenylist{}, newGuard(), testPolicy)))
+	access, err := tokens.IssueSubject(auth.Subject{UserID: u.ID.String(), TenantID: u.TenantID.String(), Roles: u.Roles})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string]*httptest.ResponseRecorder{
+		"GET /me": callAs(me, access, http.MethodGet, "/me", "", ""),
+	}
+	rec := httptest.NewRecorder()
+	userHandler.List(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	responses["GET /users"] = rec
+	rec = httptest.NewRecorder()
+	userHandler.Get(rec, withID(httptest.NewRequest(http.MethodGet, "/users/"+u.ID.String(), nil), u.ID.String()))
+	responses["GET /users/{id}"] = rec
+	rec = httptest.NewRecorder()
+	userHandler.Update(rec, withID(httptest.NewRequest(http.MethodPut, "/users/"+u.ID.String(),
+		bytes.NewBufferString(`{"username":"ana","roles":["admin"]}`)), u.ID.String()))
+	responses["PUT /users/{id}"] = rec
+
+	for name, rec := range responses {
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: esperado 200, recebeu %d: %s", name, rec.Code, body)
+		}
+		if strings.Contains(body, secret) || strings.Contains(body, "password_hash") {
+			t.Errorf("%s expõe o hash da senha: %s", name, body)
+		}
+	}
+}
+
+func TestSetRoles_KeepsLastAdmin(t *testing.T) {
+	users, ana := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "admin")
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+	setRoles := func(id uuid.UUID) int {
+		req := withID(httptest.NewRequest(http.MethodPut, "/users/"+id.String()+"/roles",
+			bytes.NewBufferString(`{"roles":["user"]}`)), id.String())
+		rec := httptest.NewRecorder()
+		h.SetRoles(rec, req)
+		return rec.Code
+	}
+
+	if code := setRoles(ana.ID); code != http.StatusConflict {
+		t.Fatalf("o último administrador não pode perder o papel: esperado 409, recebeu %d", code)
+	}
+
+	bia := model.User{ID: uuid.New(), Username: "bia", Roles: []string{"admin"}}
+	users.users[bia.ID] = bia
+	if code := setRoles(ana.ID); code != http.StatusOK {
+		t.Fatalf("com outro administrador ativo: esperado 200, recebeu %d", code)
+	}
+	if code := setRoles(bia.ID); code != http.StatusConflict {
+		t.Fatalf("bia ficou como única administradora: esperado 409, recebeu %d", code)
+	}
+}
+
+// asActor autentica req como o usuário id, como faria o Verifier
+func asActor(t *testing.T, req *http.Request, id uuid.UUID) *http.Request {
+	t.Helper()
+	token, _, err := jwtauth.New("HS256", []byte("test-secret"), nil).Encode(map[string]interface{}{"sub": id.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req.WithContext(jwtauth.NewContext(req.Context(), token, nil))
+}
+
+func TestUpdateUser_KeepsStateAndBlocksSelfLockout(t *testing.T) {
+	users, ana := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "admin")
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+	disabledAt := time.Now()
+	bob := model.User{ID: uuid.New(), Username: "bob", Roles: []string{"user"}, DisabledAt: &disabledAt}
+	bia := model.User{ID: uuid.New(), Username: "bia", Roles: []string{"admin"}}
+	users.users[bob.ID], users.users[bia.ID] = bob, bia
+	put := func(id uuid.UUID, body string) int {
+		req := withID(httptest.NewRequest(http.MethodPut, "/users/"+id.String(), bytes.NewBufferString(body)), id.String())
+		rec := httptest.NewRecorder()
+		h.Update(rec, asActor(t, req, ana.ID))
+		return rec.Code
+	}
+
+	// sem disabled no corpo, a conta desativada continua desativada
+	if code := put(bob.ID, `{"username":"bob","roles":["user","admin"]}`); code != http.StatusOK {
+		t.Fatalf("esperado 200, recebeu %d", code)
+	}
+	if !users.users[bob.ID].Disabled() {
+		t.Fatal("PUT sem disabled não pode reativar a conta")
+	}
+	if code := put(bob.ID, `{"username":"bob","roles":["user"],"disabled":false}`); code != http.StatusOK || users.users[bob.ID].Disabled() {
+		t.Fatalf("disabled=false explícito deveria reativar a conta, recebeu %d", code)
+	}
+
+	// mesmo com bia como outra administradora, ana não tira de si o papel admin
+	if code := put(ana.ID, `{"username":"ana","roles":["user"]}`); code != http.StatusConflict {
+		t.Fatalf("remover o próprio papel admin: esperado 409, recebeu %d", code)
+	}
+	if code := put(ana.ID, `{"username":"ana","roles":["admin"],"disabled":true}`); code != http.StatusConflict {
+		t.Fatalf("desativar a própria conta: esperado 409, recebeu %d", code)
+	}
+	if code := put(ana.ID, `{"username":"ana.admin","roles":["admin"]}`); code != http.StatusOK {
+		t.Fatalf("alterar o próprio username: esperado 200, recebeu %d", code)
+	}
+}
+
+func TestCreateUser_EventCarriesRequestMetadata(t *testing.T) {
+	users, ana := newMemUserRepo(t, "ana", "Ripe-Mango-2025", "admin")
+	h := handler.NewUserHandler(nil, nil, testPolicy).WithService(
+		service.NewUserService(users, newMemTokenRepo(), nopDenylist{}, testPolicy))
+	broker := &memPublisher{}
+	relay := service.NewOutboxService(users.outbox, broker)
+
+	req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"username":"bia","password":"Green-Apple-2025","roles":["user"]}`))
+	req.Header.Set("X-Request-Id", "req-123")
+	rec := httptest.NewRecorder()
+	middleware.RequestID(handler.EventMetadata(http.HandlerFunc(h.Create))).ServeHTTP(rec, asActor(t, req, ana.ID))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("esperado 202, recebeu %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if n, err := relay.Relay(context.Background(), 10); err != nil || n != 1 {
+		t.Fatalf("esperado 1 evento enviado, recebeu %d, %v", n, err)
+	}
+	e := broker.events[0]
+	if e.CorrelationID != "req-123" {
+		t.Fatalf("correlation ID: esperado req-123, recebeu %q", e.CorrelationID)
+	}
+	if e.Actor == nil || e.Actor.ID != ana.ID.String() {
+		t.Fatalf("ator: esperado %s, recebeu %+v", ana.ID, e.Actor)
+	}
+
+	// só os eventos já publicados saem no expurgo
+	users.outbox.add(context.Background(), "update", users.users[ana.ID])
+	if n, err := relay.PurgeSent(context.Background(), 0); err != nil || n != 1 {
+		t.Fatalf("esperado 1 evento expurgado, recebeu %d, %v", n, err)
+	}
+	if len(users.outbox.rows) != 1 || users.outbox.rows[0].sent {
+		t.Fatalf("o evento pendente deveria continuar na outbox: %+v", users.outbox.rows)
+	}
+}
@@ -0,0 +1,53 @@
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ContentType é o media type de um JSON Merge Patch
+const ContentType = "application/merge-patch+json"
+
+// Apply aplica um JSON Merge Patch (RFC 7396) sobre o documento doc
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, p))
+}
+
+// merge segue o pseudocódigo da seção 2 da RFC 7396
+func merge(target, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = map[string]interface{}{}
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+			continue
+		}
+		tm[k] = merge(tm[k], v)
+	}
+	return tm
+}
+
+// decode preserva os números como json.Number para não perder precisão
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,71 @@
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// Challenge é um login que já passou pela senha e aguarda o segundo fator
+// ou, com ChangePassword, a troca obrigatória da senha
+type Challenge struct {
+	UserID   uuid.UUID `json:"user_id"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	Username string    `json:"username"`
+	// Enroll indica que o usuário ainda precisa confirmar o cadastro do TOTP
+	Enroll bool `json:"enroll"`
+	// ChangePassword indica que o desafio só serve para trocar a senha
+	ChangePassword bool `json:"change_password,omitempty"`
+}
+
+// ChallengeStore guarda desafios pendentes com expiração; id é o hash do token entregue ao cliente
+type ChallengeStore interface {
+	Save(ctx context.Context, id string, c Challenge, ttl time.Duration) error
+	// Get devolve false se o desafio não existir ou tiver expirado
+	Get(ctx context.Context, id string) (Challenge, bool, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// RedisChallengeStore implementa ChallengeStore no Redis
+type RedisChallengeStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisChallengeStore(rdb *redis.Client) *RedisChallengeStore {
+	return &RedisChallengeStore{rdb: rdb}
+}
+
+func challengeKey(id string) string {
+	return "mfa:challenge:" + id
+}
+
+func (s *RedisChallengeStore) Save(ctx context.Context, id string, c Challenge, ttl time.Duration) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, challengeKey(id), b, ttl).Err()
+}
+
+func (s *RedisChallengeStore) Get(ctx context.Context, id string) (Challenge, bool, error) {
+	var c Challenge
+	b, err := s.rdb.Get(ctx, challengeKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return c, false, nil
+	}
+	if err != nil {
+		return c, false, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, false, err
+	}
+	return c, true, nil
+}
+
+func (s *RedisChallengeStore) Delete(ctx context.Context, id string) error {
+	return s.rdb.Del(ctx, challengeKey(id)).Err()
+}
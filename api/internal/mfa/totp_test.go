@@ -0,0 +1,68 @@
+package mfa
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// vetores do apêndice B da RFC 6238 (SHA1), truncados para 6 dígitos
+func TestCode_RFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, c := range cases {
+		got, err := Code(secret, Step(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("T=%d: esperado %s, recebeu %s", c.unix, c.want, got)
+		}
+	}
+}
+
+func TestValidate_AcceptsAdjacentStepsOnly(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, offset := range []int64{-1, 0, 1} {
+		code, _ := Code(secret, Step(now)+offset)
+		step, ok := Validate(secret, code, now)
+		if !ok || step != Step(now)+offset {
+			t.Errorf("passo %+d deveria ser aceito", offset)
+		}
+	}
+	old, _ := Code(secret, Step(now)-3)
+	if _, ok := Validate(secret, old, now); ok {
+		t.Error("código de passo antigo não deveria ser aceito")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Error("código com tamanho errado não deveria ser aceito")
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	u, err := url.Parse(KeyURI("ana", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Fatalf("URI inesperada: %s", u)
+	}
+	if u.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || u.Query().Get("issuer") != Issuer {
+		t.Errorf("parâmetros inesperados: %s", u.RawQuery)
+	}
+}
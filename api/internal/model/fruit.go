@@ -6,10 +6,21 @@ import (
 )
 
 type Fruit struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uuid.UUID  `json:"id"`
+	TenantID  uuid.UUID  `json:"tenant_id"`
+	Name      string     `json:"name"`
+	Quantity  int        `json:"quantity"`
+	Price     float64    `json:"price"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy *uuid.UUID `json:"deleted_by,omitempty"`
+}
+
+// FruitInput é o corpo de escrita de uma fruta; ponteiros distinguem campos ausentes de zero
+type FruitInput struct {
+	Name     *string  `json:"name"`
+	Quantity *int     `json:"quantity"`
+	Price    *float64 `json:"price"`
 }
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+)
+
+// OutboxEvent é um evento gravado junto com a alteração que o originou, aguardando
+// a publicação pelo relay
+type OutboxEvent struct {
+	ID     int64
+	Action string
+	// Payload é o corpo do evento já serializado (ex.: um SimpleUser)
+	Payload json.RawMessage
+	// Attempts conta as publicações que falharam
+	Attempts  int
+	CreatedAt time.Time
+	// EventID, CorrelationID, Actor e TenantID vão para o envelope publicado
+	EventID       uuid.UUID
+	CorrelationID string
+	Actor         *event.Actor
+	TenantID      uuid.UUID
+}
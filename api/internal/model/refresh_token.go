@@ -0,0 +1,42 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken é um refresh token opaco; apenas o hash SHA-256 é persistido.
+// Tokens rotacionados a partir do mesmo login compartilham o FamilyID.
+type RefreshToken struct {
+	ID        uuid.UUID
+	FamilyID  uuid.UUID
+	UserID    uuid.UUID
+	TenantID  uuid.UUID
+	TokenHash string `json:"-"`
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// ClientInfo identifica o cliente que abriu uma sessão
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// Session é um login ativo: a família de refresh tokens, descrita pelo token mais recente
+type Session struct {
+	ID        uuid.UUID `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	// CreatedAt é o login; LastUsedAt, a última renovação
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marca a sessão do token usado na requisição
+	Current bool `json:"current"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Permissões verificadas pelas rotas; a lista completa fica na tabela permissions
+const (
+	PermFruitsRead  = "fruits:read"
+	PermFruitsWrite = "fruits:write"
+	PermUsersManage = "users:manage"
+	PermReportsView = "reports:view"
+	// PermTenantsManage só vale para os usuários da loja padrão
+	PermTenantsManage = "tenants:manage"
+)
+
+// Papéis criados em cada loja; RoleAdmin não pode ser removido nem perder users:manage
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Role agrupa permissões e é atribuído aos usuários
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// RoleInput é o corpo de criação e alteração de um papel
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UserRolesInput substitui os papéis de um usuário
+type UserRolesInput struct {
+	Roles []string `json:"roles"`
+}
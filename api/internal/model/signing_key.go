@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// SigningKey é uma chave de assinatura de JWT persistida; ID é o kid publicado no JWKS
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	PrivateKey  []byte `json:"-"`
+	CreatedAt   time.Time
+	ActivatesAt time.Time
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tenant é uma loja independente; usuários, frutas e credenciais pertencem a uma única loja
+type Tenant struct {
+	ID        uuid.UUID `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TenantInput é o corpo de POST /tenants: a loja e o seu primeiro administrador
+type TenantInput struct {
+	Slug          string `json:"slug"`
+	Name          string `json:"name"`
+	AdminUsername string `json:"admin_username"`
+	AdminPassword string `json:"admin_password"`
+}
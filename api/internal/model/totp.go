@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TOTP é o segundo fator de um usuário; o cadastro só vale após EnabledAt ser preenchido
+type TOTP struct {
+	UserID    uuid.UUID
+	Secret    string `json:"-"`
+	LastStep  int64
+	CreatedAt time.Time
+	EnabledAt *time.Time
+}
+
+func (t TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
@@ -6,18 +6,113 @@ import (
 	"github.com/google/uuid"
 )
 
+// User é o registro interno do usuário; as respostas da API usam DTOs próprios
+// e PasswordHash nunca é serializado
 type User struct {
 	ID           uuid.UUID `json:"id"`
+	TenantID     uuid.UUID `json:"tenant_id"`
 	Username     string    `json:"username"`
-	PasswordHash string    `json:"password_hash"`
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	DisplayName  string    `json:"display_name"`
+	Email        string    `json:"email,omitempty"`
+	PasswordHash string    `json:"-"`
+	Roles        []string  `json:"roles"`
+	// MustChangePassword obriga a troca da senha antes de concluir o próximo login
+	MustChangePassword bool `json:"must_change_password"`
+	// DisabledAt marca a conta desativada, que não faz login nem renova tokens
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
+// Disabled informa se a conta está desativada
+func (u User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// HasRole informa se o usuário tem o papel informado
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// SimpleUser é o usuário publicado nos eventos da fila user.queue
 type SimpleUser struct {
-	Username  string    `json:"username"`
+	ID       uuid.UUID `json:"id"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	Username string    `json:"username"`
+	// Role é o primeiro dos Roles, mantido para consumidores que esperam um papel único
 	Role      string    `json:"role"`
+	Roles     []string  `json:"roles"`
+	Disabled  bool      `json:"disabled"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// NewSimpleUser monta a representação pública de u
+func NewSimpleUser(u User) SimpleUser {
+	su := SimpleUser{
+		ID:        u.ID,
+		TenantID:  u.TenantID,
+		Username:  u.Username,
+		Roles:     u.Roles,
+		Disabled:  u.Disabled(),
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+	if len(u.Roles) > 0 {
+		su.Role = u.Roles[0]
+	}
+	return su
+}
+
+// NewUser é o corpo de criação de um usuário
+type NewUser struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+	// Role é aceito como atalho para um único papel
+	Role string `json:"role,omitempty"`
+}
+
+// UserInput é o corpo de PUT /users/{id}; o PATCH aplica um JSON Merge Patch sobre ele.
+// Disabled ausente mantém o estado atual da conta.
+type UserInput struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	Disabled *bool    `json:"disabled,omitempty"`
+}
+
+// ProfileInput são os campos que o próprio usuário altera em PATCH /me.
+// Trocar o e-mail, que recebe a redefinição de senha, exige CurrentPassword.
+type ProfileInput struct {
+	DisplayName     string `json:"display_name"`
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password,omitempty"`
+}
+
+// PasswordChangeInput é o corpo de POST /me/password
+type PasswordChangeInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// UserFilter seleciona uma página da listagem de usuários
+type UserFilter struct {
+	// Query busca, sem diferenciar maiúsculas, em username, nome de exibição e e-mail
+	Query  string
+	Role   string
+	Limit  int
+	Offset int
+}
+
+// UserPage é uma página da listagem; Limit e Offset são os efetivamente aplicados
+type UserPage struct {
+	Users  []User
+	Total  int
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,91 @@
+// Package notify entrega mensagens aos usuários. Enquanto não há envio de e-mail,
+// as implementações registram a mensagem no log ou em arquivos.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message é uma notificação endereçada a um usuário
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	// Secrets são trechos do corpo, como tokens, que Redacted esconde
+	Secrets []string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
+// FromEnv escolhe o Notifier por NOTIFIER: "log" (padrão) ou "file", que grava em NOTIFY_DIR
+func FromEnv() (Notifier, error) {
+	switch kind := os.Getenv("NOTIFIER"); kind {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "file":
+		dir := os.Getenv("NOTIFY_DIR")
+		if dir == "" {
+			dir = "notifications"
+		}
+		return NewFileNotifier(dir)
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q", kind)
+	}
+}
+
+// Redacted devolve o corpo com os Secrets mascarados, para as demais linhas de log
+func (m Message) Redacted() string {
+	body := m.Body
+	for _, secret := range m.Secrets {
+		if secret != "" {
+			body = strings.ReplaceAll(body, secret, "[redacted]")
+		}
+	}
+	return body
+}
+
+// LogNotifier escreve a mensagem inteira no log da aplicação, Secrets inclusive, para que
+// o fluxo possa ser concluído sem e-mail; serve só para desenvolvimento
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, m Message) error {
+	log.Printf("notify to=%s subject=%q\n%s", m.To, m.Subject, m.Body)
+	return nil
+}
+
+// FileNotifier grava cada mensagem num arquivo próprio dentro de dir
+type FileNotifier struct {
+	dir string
+}
+
+func NewFileNotifier(dir string) (*FileNotifier, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileNotifier{dir: dir}, nil
+}
+
+func (f *FileNotifier) Notify(ctx context.Context, m Message) error {
+	name := fmt.Sprintf("%s-%s.txt", time.Now().UTC().Format("20060102T150405.000000000"), safeName(m.To))
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", m.To, m.Subject, m.Body)
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0o600)
+}
+
+// safeName evita que o destinatário escape do diretório ou gere nomes inválidos
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,101 @@
+// Package oidc implementa o login por OpenID Connect (authorization code com PKCE)
+// contra provedores de identidade externos configurados na implantação.
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Config descreve um provedor de identidade aceito no login
+type Config struct {
+	// Name identifica o provedor nas rotas /auth/oidc/{name}
+	Name         string `json:"name"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL é a rota de callback desta API registrada no provedor
+	RedirectURL string   `json:"redirect_url"`
+	Scopes      []string `json:"scopes"`
+	// GroupsClaim é a claim do ID token com os grupos do usuário
+	GroupsClaim string `json:"groups_claim"`
+	// Roles traduz cada grupo do provedor nos papéis locais
+	Roles map[string][]string `json:"roles"`
+	// DefaultRoles valem para qualquer usuário do provedor, além dos grupos mapeados
+	DefaultRoles []string `json:"default_roles"`
+	// Tenant é o slug da loja dos usuários do provedor; vazio usa a loja padrão
+	Tenant string `json:"tenant"`
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Validate rejeita provedores sem os dados mínimos do fluxo e completa os padrões
+func (c *Config) Validate() error {
+	if !namePattern.MatchString(c.Name) {
+		return fmt.Errorf("oidc provider name %q must match %s", c.Name, namePattern)
+	}
+	if c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+		return fmt.Errorf("oidc provider %q: issuer, client_id and redirect_url are required", c.Name)
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	return nil
+}
+
+// MapRoles devolve os papéis locais dos grupos informados, sem repetições
+func (c Config) MapRoles(groups []string) []string {
+	seen := map[string]bool{}
+	roles := []string{}
+	add := func(list []string) {
+		for _, r := range list {
+			if !seen[r] {
+				seen[r] = true
+				roles = append(roles, r)
+			}
+		}
+	}
+	add(c.DefaultRoles)
+	for _, g := range groups {
+		add(c.Roles[g])
+	}
+	return roles
+}
+
+// ProvidersFromEnv lê a lista de provedores de OIDC_PROVIDERS_FILE ou do JSON em
+// OIDC_PROVIDERS; sem nenhum dos dois o login por OIDC fica desligado
+func ProvidersFromEnv() ([]Config, error) {
+	var raw []byte
+	if path := os.Getenv("OIDC_PROVIDERS_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	} else if v := os.Getenv("OIDC_PROVIDERS"); v != "" {
+		raw = []byte(v)
+	} else {
+		return nil, nil
+	}
+	var list []Config
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("invalid oidc providers: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range list {
+		if err := list[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[list[i].Name] {
+			return nil, errors.New("duplicate oidc provider " + list[i].Name)
+		}
+		seen[list[i].Name] = true
+	}
+	return list, nil
+}
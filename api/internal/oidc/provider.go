@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	jwxt "github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// ErrInvalidIDToken indica uma resposta do provedor que não pôde ser verificada
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// clockSkew é a tolerância de relógio aceita na validade do ID token
+const clockSkew = 30 * time.Second
+
+// keysRefreshInterval limita a frequência com que o JWKS é baixado de novo
+const keysRefreshInterval = time.Minute
+
+// Identity são os dados do usuário autenticado pelo provedor, vindos do ID token
+type Identity struct {
+	Subject  string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+}
+
+// discovery traz os campos usados de /.well-known/openid-configuration
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider fala com um provedor de identidade; a descoberta e as chaves são
+// carregadas na primeira utilização e mantidas em cache
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	meta      *discovery
+	keys      jwk.Set
+	fetchedAt time.Time
+}
+
+// NewProvider cria o Provider de cfg; client nil usa um cliente com timeout de 10s
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+func (p *Provider) Config() Config {
+	return p.cfg
+}
+
+// AuthCodeURL monta o endereço de autorização com state, nonce e o desafio PKCE (S256) de verifier
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange troca o código pelo ID token, verifica assinatura, emissor, audiência,
+// validade e nonce, e devolve a identidade do usuário
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	var body struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &body); err != nil {
+		return Identity{}, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if body.IDToken == "" {
+		return Identity{}, fmt.Errorf("%w: token response without id_token", ErrInvalidIDToken)
+	}
+
+	tok, err := p.verify(ctx, meta.Issuer, body.IDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if got, _ := stringClaim(tok, "nonce"); got == "" || got != nonce {
+		return Identity{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if tok.Subject() == "" {
+		return Identity{}, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	id := Identity{Subject: tok.Subject(), Groups: groupsClaim(tok, p.cfg.GroupsClaim)}
+	id.Username, _ = stringClaim(tok, "preferred_username")
+	id.Email, _ = stringClaim(tok, "email")
+	id.Name, _ = stringClaim(tok, "name")
+	return id, nil
+}
+
+// verify valida o ID token com o JWKS em cache; se falhar, baixa as chaves de novo
+// (no máximo uma vez por keysRefreshInterval), pois o provedor pode ter rotacionado
+func (p *Provider) verify(ctx context.Context, issuer, raw string) (jwxt.Token, error) {
+	keys, err := p.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := p.parse(raw, issuer, keys)
+	if err == nil {
+		return tok, nil
+	}
+	fresh, ferr := p.keySet(ctx, true)
+	if ferr != nil || fresh == keys {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if tok, err = p.parse(raw, issuer, fresh); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	return tok, nil
+}
+
+func (p *Provider) parse(raw, issuer string, keys jwk.Set) (jwxt.Token, error) {
+	return jwxt.ParseString(raw,
+		jwxt.WithKeySet(keys, jws.WithInferAlgorithmFromKey(true)),
+		jwxt.WithValidate(true),
+		jwxt.WithIssuer(issuer),
+		jwxt.WithAudience(p.cfg.ClientID),
+		jwxt.WithAcceptableSkew(clockSkew),
+	)
+}
+
+// discover carrega a configuração do provedor e confere se o emissor é o configurado
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta discovery
+	if err := p.do(req, &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// keySet devolve o JWKS em cache; refresh força o download se o último for antigo o bastante
+func (p *Provider) keySet(ctx context.Context, refresh bool) (jwk.Set, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil && (!refresh || time.Since(p.fetchedAt) < keysRefreshInterval) {
+		return p.keys, nil
+	}
+	set, err := jwk.Fetch(ctx, p.meta.JWKSURI, jwk.WithHTTPClient(p.client))
+	if err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	p.keys, p.fetchedAt = set, time.Now()
+	return set, nil
+}
+
+// do executa req e decodifica a resposta JSON em v; status diferente de 200 é erro
+func (p *Provider) do(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func stringClaim(tok jwxt.Token, name string) (string, bool) {
+	v, ok := tok.Get(name)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// groupsClaim aceita a claim de grupos como lista ou como um único texto
+func groupsClaim(tok jwxt.Token, name string) []string {
+	v, ok := tok.Get(name)
+	if !ok {
+		return nil
+	}
+	switch g := v.(type) {
+	case string:
+		return []string{g}
+	case []string:
+		return g
+	case []any:
+		groups := make([]string, 0, len(g))
+		for _, item := range g {
+			if s, ok := item.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
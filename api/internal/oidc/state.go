@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// LoginState é o login iniciado em /auth/oidc/{provider}/login, aguardando o callback
+type LoginState struct {
+	Provider string    `json:"provider"`
+	TenantID uuid.UUID `json:"tenant_id"`
+	Verifier string    `json:"verifier"`
+	Nonce    string    `json:"nonce"`
+}
+
+// StateStore guarda os logins pendentes; id é o hash do state entregue ao provedor
+type StateStore interface {
+	Save(ctx context.Context, id string, s LoginState, ttl time.Duration) error
+	// Take devolve e remove o login, para que o state só valha uma vez;
+	// false se ele não existir ou tiver expirado
+	Take(ctx context.Context, id string) (LoginState, bool, error)
+}
+
+// RedisStateStore implementa StateStore no Redis
+type RedisStateStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStateStore(rdb *redis.Client) *RedisStateStore {
+	return &RedisStateStore{rdb: rdb}
+}
+
+func stateKey(id string) string {
+	return "oidc:state:" + id
+}
+
+func (s *RedisStateStore) Save(ctx context.Context, id string, st LoginState, ttl time.Duration) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(ctx, stateKey(id), b, ttl).Err()
+}
+
+func (s *RedisStateStore) Take(ctx context.Context, id string) (LoginState, bool, error) {
+	var st LoginState
+	b, err := s.rdb.GetDel(ctx, stateKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return st, false, nil
+	}
+	if err != nil {
+		return st, false, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, false, err
+	}
+	return st, true, nil
+}
@@ -0,0 +1,82 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// breached é a lista de senhas vazadas distribuída com a API, no mesmo formato
+// das faixas do Have I Been Pwned: um arquivo por prefixo de 5 caracteres do SHA-1
+//
+//go:embed breached
+var breached embed.FS
+
+// RangeSource devolve os sufixos de SHA-1 conhecidos para um prefixo. Só o prefixo
+// sai do processo (k-anonimato), então uma API remota pode substituir os arquivos.
+type RangeSource interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// BreachList consulta uma RangeSource para saber se a senha já vazou
+type BreachList struct {
+	source RangeSource
+}
+
+func NewBreachList(source RangeSource) *BreachList {
+	return &BreachList{source: source}
+}
+
+// DefaultBreachList usa a lista embutida no binário
+func DefaultBreachList() *BreachList {
+	sub, _ := fs.Sub(breached, "breached")
+	return NewBreachList(FSRange{FS: sub})
+}
+
+// Contains informa se a senha aparece na lista
+func (b *BreachList) Contains(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := b.source.Range(ctx, hash[:5])
+	if err != nil {
+		return false, err
+	}
+	for _, s := range suffixes {
+		if s == hash[5:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FSRange lê as faixas de arquivos nomeados pelo prefixo, com um sufixo por linha
+// (o ":contagem" do formato do HIBP é aceito e ignorado)
+type FSRange struct {
+	FS fs.FS
+}
+
+func (r FSRange) Range(ctx context.Context, prefix string) ([]string, error) {
+	f, err := r.FS.Open(prefix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var suffixes []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if suffix != "" {
+			suffixes = append(suffixes, strings.ToUpper(suffix))
+		}
+	}
+	return suffixes, sc.Err()
+}
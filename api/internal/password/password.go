@@ -0,0 +1,130 @@
+// Package password concentra a política de senhas: regras de composição,
+// lista de senhas vazadas e o custo do bcrypt.
+package password
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/env"
+)
+
+// MaxBytes é o limite de entrada do bcrypt
+const MaxBytes = 72
+
+type Policy struct {
+	MinLength int // em caracteres
+	// MinClasses é quantas classes (minúsculas, maiúsculas, dígitos, símbolos) a senha precisa ter
+	MinClasses int
+	// Cost é o custo do bcrypt; hashes com custo menor são refeitos no próximo login
+	Cost int
+	// Breached é a lista de senhas vazadas; nil desativa a verificação
+	Breached *BreachList
+}
+
+// DefaultPolicy exige 12 caracteres de 3 classes, bcrypt com custo 12 e consulta a lista embutida
+func DefaultPolicy() Policy {
+	return Policy{MinLength: 12, MinClasses: 3, Cost: 12, Breached: DefaultBreachList()}
+}
+
+// PolicyFromEnv lê PASSWORD_MIN_LENGTH, PASSWORD_MIN_CLASSES, BCRYPT_COST e
+// PASSWORD_BREACH_DIR (diretório de faixas que substitui a lista embutida)
+func PolicyFromEnv() (Policy, error) {
+	p := DefaultPolicy()
+	var err error
+	if p.MinLength, err = env.Int("PASSWORD_MIN_LENGTH", p.MinLength); err != nil {
+		return Policy{}, err
+	}
+	if p.MinClasses, err = env.Int("PASSWORD_MIN_CLASSES", p.MinClasses); err != nil {
+		return Policy{}, err
+	}
+	if p.Cost, err = env.Int("BCRYPT_COST", p.Cost); err != nil {
+		return Policy{}, err
+	}
+	if dir := os.Getenv("PASSWORD_BREACH_DIR"); dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			return Policy{}, fmt.Errorf("PASSWORD_BREACH_DIR: %w", err)
+		}
+		p.Breached = NewBreachList(FSRange{FS: os.DirFS(dir)})
+	}
+	if p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost {
+		return Policy{}, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if p.MinClasses < 1 || p.MinClasses > 4 {
+		return Policy{}, fmt.Errorf("PASSWORD_MIN_CLASSES must be between 1 and 4")
+	}
+	return p, nil
+}
+
+// Check devolve as regras que a senha viola; username é usado para rejeitar senhas iguais a ele
+func (p Policy) Check(ctx context.Context, password, username string) ([]string, error) {
+	if password == "" {
+		return []string{"is required"}, nil
+	}
+	var problems []string
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must have at least %d characters", p.MinLength))
+	}
+	if len(password) > MaxBytes {
+		problems = append(problems, fmt.Sprintf("must have at most %d bytes", MaxBytes))
+	}
+	if classes(password) < p.MinClasses {
+		problems = append(problems, fmt.Sprintf(
+			"must mix at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinClasses))
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		problems = append(problems, "must not be the username")
+	}
+	if p.Breached != nil {
+		found, err := p.Breached.Contains(ctx, password)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			problems = append(problems, "appears in a list of breached passwords")
+		}
+	}
+	return problems, nil
+}
+
+// Hash gera o hash bcrypt com o custo da política
+func (p Policy) Hash(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), p.cost())
+	return string(h), err
+}
+
+// NeedsRehash informa se o hash foi gerado com custo menor que o atual
+func (p Policy) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < p.cost()
+}
+
+func (p Policy) cost() int {
+	if p.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+	return p.Cost
+}
+
+func classes(s string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
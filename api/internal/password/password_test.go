@@ -0,0 +1,80 @@
+package password_test
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p := password.DefaultPolicy()
+	cases := map[string]struct {
+		password, username string
+		ok                 bool
+	}{
+		"senha forte":            {"Ripe-Mango-2025", "ana", true},
+		"vazia":                  {"", "ana", false},
+		"curta":                  {"Ab1-xyz", "ana", false},
+		"poucas classes":         {"onlylowercaseletters", "ana", false},
+		"igual ao username":      {"Hiltinho.2025", "hiltinho.2025", false},
+		"acima do limite bcrypt": {"Aa1-" + string(make([]byte, 72)), "ana", false},
+		"vazada":                 {"Qwerty123!", "ana", false},
+		"semeada":                {"adminpass", "admin", false},
+	}
+	for name, tc := range cases {
+		problems, err := p.Check(context.Background(), tc.password, tc.username)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if ok := len(problems) == 0; ok != tc.ok {
+			t.Errorf("%s: esperado ok=%v, problemas %v", name, tc.ok, problems)
+		}
+	}
+}
+
+func TestBreachList_UsesOnlyThePrefix(t *testing.T) {
+	// SHA-1 de "password" = 5BAA6 1E4C9B93F3F0682250B6CF8331B7EE68FD8
+	var asked []string
+	src := rangeFunc(func(prefix string) ([]string, error) {
+		asked = append(asked, prefix)
+		return password.FSRange{FS: fstest.MapFS{
+			"5BAA6": {Data: []byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n")},
+		}}.Range(context.Background(), prefix)
+	})
+	list := password.NewBreachList(src)
+
+	found, err := list.Contains(context.Background(), "password")
+	if err != nil || !found {
+		t.Fatalf("esperado encontrar a senha, recebeu %v, %v", found, err)
+	}
+	found, err = list.Contains(context.Background(), "Ripe-Mango-2025")
+	if err != nil || found {
+		t.Fatalf("senha fora da lista foi encontrada: %v, %v", found, err)
+	}
+	if asked[0] != "5BAA6" {
+		t.Fatalf("a consulta deveria enviar só o prefixo, enviou %q", asked[0])
+	}
+}
+
+func TestPolicy_NeedsRehash(t *testing.T) {
+	p := password.Policy{Cost: bcrypt.MinCost + 1}
+	old, _ := bcrypt.GenerateFromPassword([]byte("x"), bcrypt.MinCost)
+	if !p.NeedsRehash(string(old)) {
+		t.Fatal("hash com custo menor deveria ser refeito")
+	}
+	current, err := p.Hash("x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.NeedsRehash(current) {
+		t.Fatal("hash com o custo atual não deveria ser refeito")
+	}
+}
+
+type rangeFunc func(prefix string) ([]string, error)
+
+func (f rangeFunc) Range(ctx context.Context, prefix string) ([]string, error) { return f(prefix) }
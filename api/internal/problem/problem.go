@@ -0,0 +1,89 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// ContentType é o media type de respostas de erro (RFC 7807)
+const ContentType = "application/problem+json"
+
+// Tipos de problema com semântica própria; os demais usam about:blank
+const (
+	TypeDefault    = "about:blank"
+	TypeValidation = "/problems/validation-error"
+)
+
+// Problem é o corpo de uma resposta de erro no formato RFC 7807
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	RequestID     string         `json:"request_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam descreve um campo rejeitado pela validação
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// New cria um problema about:blank com o título padrão do status
+func New(status int, detail string) *Problem {
+	return &Problem{
+		Type:   TypeDefault,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// Validation cria um problema 400 com os campos rejeitados
+func Validation(detail string, params []InvalidParam) *Problem {
+	p := New(http.StatusBadRequest, detail)
+	p.Type = TypeValidation
+	p.Title = "Validation failed"
+	p.InvalidParams = params
+	return p
+}
+
+// Write renderiza p preenchendo instance e request_id a partir da requisição
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = middleware.GetReqID(r.Context())
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error é o equivalente de http.Error no formato problem+json
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// NotFound e MethodNotAllowed substituem as respostas padrão do router
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, "route not found")
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, r.Method+" not allowed on "+r.URL.Path)
+}
+
+// RequestID propaga o ID da requisição (X-Request-Id) e o devolve na resposta
+func RequestID(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
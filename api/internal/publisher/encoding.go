@@ -0,0 +1,142 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+)
+
+// Encoding define o formato das mensagens publicadas
+type Encoding string
+
+const (
+	// EncodingEnvelope publica o event.Envelope como corpo JSON (padrão)
+	EncodingEnvelope Encoding = "envelope"
+	// EncodingCloudEventsStructured publica o evento inteiro como application/cloudevents+json
+	EncodingCloudEventsStructured Encoding = "cloudevents-structured"
+	// EncodingCloudEventsBinary publica só os dados no corpo e os atributos em cabeçalhos ce-*
+	EncodingCloudEventsBinary Encoding = "cloudevents-binary"
+)
+
+// CloudEventsContentType é o content type do modo estruturado
+const CloudEventsContentType = "application/cloudevents+json"
+
+// ParseEncoding valida o nome de um Encoding; vazio é EncodingEnvelope
+func ParseEncoding(s string) (Encoding, error) {
+	switch enc := Encoding(s); enc {
+	case "":
+		return EncodingEnvelope, nil
+	case EncodingEnvelope, EncodingCloudEventsStructured, EncodingCloudEventsBinary:
+		return enc, nil
+	}
+	return "", fmt.Errorf("unknown event encoding %q", s)
+}
+
+// cloudEvent é o evento no formato CloudEvents 1.0. Os campos do envelope que não têm
+// atributo próprio vão como extensões (nomes em minúsculas, sem separadores).
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	SchemaVersion   int             `json:"schemaversion"`
+	CorrelationID   string          `json:"correlationid,omitempty"`
+	ActorType       string          `json:"actortype,omitempty"`
+	ActorID         string          `json:"actorid,omitempty"`
+	TenantID        string          `json:"tenantid"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func newCloudEvent(e event.Envelope) cloudEvent {
+	ce := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              e.ID.String(),
+		Source:          "/" + e.Producer,
+		Type:            e.Type,
+		Time:            e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		SchemaVersion:   e.SchemaVersion,
+		CorrelationID:   e.CorrelationID,
+		TenantID:        e.TenantID.String(),
+		Data:            e.Data,
+	}
+	if e.Actor != nil {
+		ce.ActorType, ce.ActorID = e.Actor.Type, e.Actor.ID
+	}
+	return ce
+}
+
+// Encode monta a mensagem AMQP de e no formato enc. As propriedades AMQP (message_id,
+// type, timestamp, app_id, correlation_id) são preenchidas em todos os formatos.
+func Encode(e event.Envelope, enc Encoding) (amqp.Publishing, error) {
+	msg := amqp.Publishing{
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     e.ID.String(),
+		Type:          e.Type,
+		Timestamp:     e.OccurredAt,
+		AppId:         e.Producer,
+		CorrelationId: e.CorrelationID,
+	}
+	var err error
+	switch enc {
+	case EncodingEnvelope, "":
+		msg.ContentType = "application/json"
+		msg.Headers = headers(e)
+		msg.Body, err = json.Marshal(e)
+	case EncodingCloudEventsStructured:
+		msg.ContentType = CloudEventsContentType
+		msg.Body, err = json.Marshal(newCloudEvent(e))
+	case EncodingCloudEventsBinary:
+		ce := newCloudEvent(e)
+		msg.ContentType = ce.DataContentType
+		msg.Headers = amqp.Table{
+			"ce-specversion":   ce.SpecVersion,
+			"ce-id":            ce.ID,
+			"ce-source":        ce.Source,
+			"ce-type":          ce.Type,
+			"ce-time":          ce.Time,
+			"ce-schemaversion": int32(ce.SchemaVersion),
+			"ce-tenantid":      ce.TenantID,
+		}
+		if ce.CorrelationID != "" {
+			msg.Headers["ce-correlationid"] = ce.CorrelationID
+		}
+		if ce.ActorID != "" {
+			msg.Headers["ce-actortype"] = ce.ActorType
+			msg.Headers["ce-actorid"] = ce.ActorID
+		}
+		msg.Body = ce.Data
+	default:
+		return amqp.Publishing{}, fmt.Errorf("unknown event encoding %q", enc)
+	}
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	return msg, nil
+}
+
+// headers espelha os campos do envelope nos cabeçalhos da mensagem
+func headers(e event.Envelope) amqp.Table {
+	h := amqp.Table{
+		"event_id":       e.ID.String(),
+		"event_type":     e.Type,
+		"schema_version": int32(e.SchemaVersion),
+		"occurred_at":    e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		"producer":       e.Producer,
+		"tenant_id":      e.TenantID.String(),
+	}
+	if e.CorrelationID != "" {
+		h["correlation_id"] = e.CorrelationID
+	}
+	if e.Actor != nil {
+		h["actor_type"] = e.Actor.Type
+		h["actor_id"] = e.Actor.ID
+	}
+	return h
+}
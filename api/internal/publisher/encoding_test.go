@@ -0,0 +1,88 @@
+package publisher_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/publisher"
+)
+
+func testEnvelope() event.Envelope {
+	return event.Envelope{
+		ID:            uuid.New(),
+		Type:          event.UserUpdated,
+		SchemaVersion: event.SchemaVersion,
+		OccurredAt:    time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		Producer:      event.Producer,
+		CorrelationID: "req-1",
+		Actor:         &event.Actor{Type: "user", ID: "42"},
+		TenantID:      uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Action:        "update",
+		Data:          json.RawMessage(`{"username":"ana"}`),
+	}
+}
+
+func TestEncode_CloudEventsStructured(t *testing.T) {
+	e := testEnvelope()
+	msg, err := publisher.Encode(e, publisher.EncodingCloudEventsStructured)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ContentType != publisher.CloudEventsContentType {
+		t.Fatalf("content type: esperado %s, recebeu %s", publisher.CloudEventsContentType, msg.ContentType)
+	}
+	var ce map[string]any
+	if err := json.Unmarshal(msg.Body, &ce); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"specversion": "1.0", "id": e.ID.String(), "source": "/" + event.Producer, "type": event.UserUpdated,
+		"time": "2025-06-01T12:00:00Z", "correlationid": "req-1", "actorid": "42", "schemaversion": float64(1),
+		"tenantid": e.TenantID.String(),
+	}
+	for k, v := range want {
+		if ce[k] != v {
+			t.Errorf("%s: esperado %v, recebeu %v", k, v, ce[k])
+		}
+	}
+	if data, _ := ce["data"].(map[string]any); data["username"] != "ana" {
+		t.Errorf("data: esperado o usuário, recebeu %v", ce["data"])
+	}
+}
+
+func TestEncode_CloudEventsBinary(t *testing.T) {
+	e := testEnvelope()
+	msg, err := publisher.Encode(e, publisher.EncodingCloudEventsBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ContentType != "application/json" || string(msg.Body) != `{"username":"ana"}` {
+		t.Fatalf("no modo binário o corpo é só o dado: %s %s", msg.ContentType, msg.Body)
+	}
+	want := map[string]any{
+		"ce-specversion": "1.0", "ce-id": e.ID.String(), "ce-source": "/" + event.Producer,
+		"ce-type": event.UserUpdated, "ce-correlationid": "req-1", "ce-schemaversion": int32(1),
+		"ce-tenantid": e.TenantID.String(),
+	}
+	for k, v := range want {
+		if msg.Headers[k] != v {
+			t.Errorf("%s: esperado %v, recebeu %v", k, v, msg.Headers[k])
+		}
+	}
+	if msg.MessageId != e.ID.String() {
+		t.Errorf("message_id: esperado %s, recebeu %s", e.ID, msg.MessageId)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	if enc, err := publisher.ParseEncoding(""); err != nil || enc != publisher.EncodingEnvelope {
+		t.Fatalf("vazio deve ser o envelope, recebeu %q, %v", enc, err)
+	}
+	if _, err := publisher.ParseEncoding("xml"); err == nil {
+		t.Fatal("formato desconhecido deve ser recusado")
+	}
+}
@@ -1,42 +1,278 @@
 package publisher
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+)
+
+var (
+	// ErrUnavailable indica que não há conexão com o broker no momento
+	ErrUnavailable = errors.New("rabbitmq unavailable")
+	// ErrNotConfirmed indica que o broker recusou a mensagem ou não confirmou a tempo
+	ErrNotConfirmed = errors.New("rabbitmq publish not confirmed")
+	// ErrReturned indica que a mensagem não chegou a nenhuma fila (mandatory) e voltou do broker
+	ErrReturned = errors.New("rabbitmq message returned unroutable")
+)
+
+const (
+	defaultConfirmTimeout = 5 * time.Second
+	minReconnectDelay     = time.Second
+	maxReconnectDelay     = 30 * time.Second
+	// returnBuffer guarda as devoluções entre o basic.return e a leitura em Publish
+	returnBuffer = 16
 )
 
 // EventPublisher define o contrato
 type EventPublisher interface {
-	Publish(action string, payload interface{}) error
+	Publish(e event.Envelope) error
 }
 
-// RabbitPublisher implementa via RabbitMQ
+// Config descreve onde o RabbitPublisher publica. Com Exchange vazio as mensagens vão
+// pelo exchange padrão direto para Queue; senão o exchange (direct, durável) é declarado
+// e ligado a Queue com a routing key Queue.
+type Config struct {
+	URL            string
+	Exchange       string
+	Queue          string
+	ConfirmTimeout time.Duration
+	// Encoding é o formato das mensagens; vazio publica o envelope
+	Encoding Encoding
+}
+
+// RabbitPublisher implementa via RabbitMQ. Publica em modo confirm, com mandatory, e só
+// devolve nil depois do ack do broker para uma mensagem que chegou a uma fila; a conexão é
+// refeita em segundo plano, com backoff, sempre que cai. Pode ser usado por várias
+// goroutines ao mesmo tempo.
 type RabbitPublisher struct {
-	ch        *amqp.Channel
-	queueName string
+	cfg    Config
+	dial   func(url string) (connection, error)
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// publishing serializa as publicações: assim a devolução (basic.return), que o broker
+	// envia antes da confirmação, é sempre da mensagem em curso ou de uma já abandonada
+	publishing sync.Mutex
+
+	mu      sync.RWMutex
+	ch      channel
+	returns chan amqp.Return
 }
 
-func NewRabbitPublisher(ch *amqp.Channel, queueName string) *RabbitPublisher {
-	return &RabbitPublisher{ch: ch, queueName: queueName}
+// NewRabbitPublisher começa a conectar em segundo plano e devolve o publisher na hora;
+// enquanto não houver conexão Publish falha com ErrUnavailable
+func NewRabbitPublisher(cfg Config) *RabbitPublisher {
+	return newRabbitPublisher(cfg, dialAMQP)
 }
 
-func (p *RabbitPublisher) Publish(action string, payload interface{}) error {
-	evt := struct {
-		Action     string      `json:"action"`
-		SimpleUser interface{} `json:"user"`
-	}{action, payload}
+func newRabbitPublisher(cfg Config, dial func(url string) (connection, error)) *RabbitPublisher {
+	if cfg.ConfirmTimeout <= 0 {
+		cfg.ConfirmTimeout = defaultConfirmTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &RabbitPublisher{cfg: cfg, dial: dial, cancel: cancel, done: make(chan struct{})}
+	go p.run(ctx)
+	return p
+}
 
-	body, err := json.Marshal(evt)
+// Publish envia e no formato de cfg.Encoding (ver Encode)
+func (p *RabbitPublisher) Publish(e event.Envelope) error {
+	msg, err := Encode(e, p.cfg.Encoding)
 	if err != nil {
 		return err
 	}
-	return p.ch.Publish(
-		"", p.queueName,
-		false, false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	)
+
+	p.publishing.Lock()
+	defer p.publishing.Unlock()
+	p.mu.RLock()
+	ch, returns := p.ch, p.returns
+	p.mu.RUnlock()
+	if ch == nil {
+		return ErrUnavailable
+	}
+	// descarta devoluções de publicações que expiraram antes da confirmação
+	for len(returns) > 0 {
+		<-returns
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.ConfirmTimeout)
+	defer cancel()
+	confirm, err := ch.publish(ctx, p.cfg.Exchange, p.cfg.Queue, true, msg)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	select {
+	case <-confirm.Done():
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %v", ErrNotConfirmed, ctx.Err())
+	}
+	if !confirm.Acked() {
+		return fmt.Errorf("%w: nacked by broker", ErrNotConfirmed)
+	}
+	// o broker envia o basic.return antes do ack, então ele já está no buffer
+	for {
+		select {
+		case r := <-returns:
+			if r.MessageId == msg.MessageId {
+				return fmt.Errorf("%w: %d %s", ErrReturned, r.ReplyCode, r.ReplyText)
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// Close para a reconexão e fecha a conexão atual
+func (p *RabbitPublisher) Close() error {
+	p.cancel()
+	<-p.done
+	return nil
+}
+
+// run mantém a conexão viva: conecta, espera ela (ou o canal) cair e conecta de novo,
+// dobrando a espera entre as tentativas que falham
+func (p *RabbitPublisher) run(ctx context.Context) {
+	defer close(p.done)
+	delay := minReconnectDelay
+	for {
+		conn, ch, err := p.connect()
+		if err != nil {
+			log.Printf("rabbitmq connect error: %v (retrying in %s)", err, delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxReconnectDelay)
+			continue
+		}
+		delay = minReconnectDelay
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+		returns := ch.NotifyReturn(make(chan amqp.Return, returnBuffer))
+		p.mu.Lock()
+		p.ch, p.returns = ch, returns
+		p.mu.Unlock()
+
+		var reason *amqp.Error
+		select {
+		case <-ctx.Done():
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		p.mu.Lock()
+		p.ch, p.returns = nil, nil
+		p.mu.Unlock()
+		conn.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("rabbitmq connection lost: %v", reason)
+	}
+}
+
+// connect abre conexão e canal, declara a topologia e liga o modo confirm
+func (p *RabbitPublisher) connect() (connection, channel, error) {
+	conn, err := p.dial(p.cfg.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch, err := conn.Channel()
+	if err == nil {
+		err = p.declare(ch)
+	}
+	if err == nil {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, ch, nil
+}
+
+// declare cria a fila (com os mesmos parâmetros do user-service) e, se configurado, o exchange.
+// Os argumentos não podem mudar: o broker recusa redeclarar uma fila existente com outros; a
+// fila de mensagens mortas é configurada por policy (ver make rabbitmq-policy).
+func (p *RabbitPublisher) declare(ch channel) error {
+	if _, err := ch.QueueDeclare(p.cfg.Queue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("queue declare: %w", err)
+	}
+	if p.cfg.Exchange == "" {
+		return nil
+	}
+	if err := ch.ExchangeDeclare(p.cfg.Exchange, amqp.ExchangeDirect, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("exchange declare: %w", err)
+	}
+	if err := ch.QueueBind(p.cfg.Queue, p.cfg.Queue, p.cfg.Exchange, false, nil); err != nil {
+		return fmt.Errorf("queue bind: %w", err)
+	}
+	return nil
+}
+
+// connection, channel e confirmation são as partes do amqp091 usadas pelo publisher;
+// os testes as substituem por dublês
+type connection interface {
+	Channel() (channel, error)
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+type channel interface {
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Confirm(noWait bool) error
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (confirmation, error)
+}
+
+type confirmation interface {
+	Done() <-chan struct{}
+	Acked() bool
+}
+
+func dialAMQP(url string) (connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConnection{conn}, nil
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return amqpChannel{ch}, nil
+}
+
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+func (c amqpChannel) publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (confirmation, error) {
+	confirm, err := c.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, msg)
+	if err != nil {
+		return nil, err
+	}
+	if confirm == nil {
+		return nil, errors.New("channel is not in confirm mode")
+	}
+	return confirm, nil
 }
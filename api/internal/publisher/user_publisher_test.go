@@ -0,0 +1,219 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+)
+
+// reply é como o broker falso responde a uma publicação
+type reply int
+
+const (
+	ack reply = iota
+	nack
+	unroutable // basic.return seguido do ack, como o RabbitMQ faz com mandatory
+	silent     // nunca confirma
+)
+
+// fakeBroker entrega uma conexão nova a cada dial e responde às publicações com reply
+type fakeBroker struct {
+	mu        sync.Mutex
+	reply     reply
+	published []amqp.Publishing
+	mandatory []bool
+	conns     chan *fakeConn
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{conns: make(chan *fakeConn, 10)}
+}
+
+func (b *fakeBroker) dial(url string) (connection, error) {
+	c := &fakeConn{ch: &fakeChannel{broker: b}}
+	b.conns <- c
+	return c, nil
+}
+
+func (b *fakeBroker) setReply(r reply) {
+	b.mu.Lock()
+	b.reply = r
+	b.mu.Unlock()
+}
+
+type fakeConn struct {
+	ch     *fakeChannel
+	mu     sync.Mutex
+	closed chan *amqp.Error
+}
+
+func (c *fakeConn) Channel() (channel, error) { return c.ch, nil }
+func (c *fakeConn) NotifyClose(ch chan *amqp.Error) chan *amqp.Error {
+	c.mu.Lock()
+	c.closed = ch
+	c.mu.Unlock()
+	return ch
+}
+func (c *fakeConn) Close() error { return nil }
+
+// drop derruba a conexão como o broker faria
+func (c *fakeConn) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed <- &amqp.Error{Code: amqp.ConnectionForced, Reason: "broker restarted"}
+}
+
+type fakeChannel struct {
+	broker  *fakeBroker
+	returns chan amqp.Return
+}
+
+func (c *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, nil
+}
+func (c *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return nil
+}
+func (c *fakeChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	return nil
+}
+func (c *fakeChannel) Confirm(noWait bool) error                        { return nil }
+func (c *fakeChannel) NotifyClose(ch chan *amqp.Error) chan *amqp.Error { return ch }
+func (c *fakeChannel) NotifyReturn(ch chan amqp.Return) chan amqp.Return {
+	c.returns = ch
+	return ch
+}
+
+func (c *fakeChannel) publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (confirmation, error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published = append(b.published, msg)
+	b.mandatory = append(b.mandatory, mandatory)
+	confirm := &fakeConfirm{done: make(chan struct{})}
+	switch b.reply {
+	case ack:
+		confirm.acked = true
+		close(confirm.done)
+	case nack:
+		close(confirm.done)
+	case unroutable:
+		c.returns <- amqp.Return{ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE", MessageId: msg.MessageId}
+		confirm.acked = true
+		close(confirm.done)
+	}
+	return confirm, nil
+}
+
+type fakeConfirm struct {
+	done  chan struct{}
+	acked bool
+}
+
+func (c *fakeConfirm) Done() <-chan struct{} { return c.done }
+func (c *fakeConfirm) Acked() bool           { return c.acked }
+
+func newTestPublisher(t *testing.T, b *fakeBroker) *RabbitPublisher {
+	t.Helper()
+	p := newRabbitPublisher(Config{Exchange: "user.events", Queue: "user.queue", ConfirmTimeout: 100 * time.Millisecond}, b.dial)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// publishWhenConnected tenta publicar até a conexão em segundo plano ficar pronta
+func publishWhenConnected(t *testing.T, p *RabbitPublisher) error {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := p.Publish(event.Envelope{ID: uuid.New(), Type: event.UserCreated, SchemaVersion: event.SchemaVersion})
+		if !errors.Is(err, ErrUnavailable) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRabbitPublisher_WaitsForTheBroker(t *testing.T) {
+	cases := []struct {
+		name  string
+		reply reply
+		want  error
+	}{
+		{"ack", ack, nil},
+		{"nack", nack, ErrNotConfirmed},
+		{"devolvida sem fila", unroutable, ErrReturned},
+		{"sem confirmação no prazo", silent, ErrNotConfirmed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := newFakeBroker()
+			b.setReply(tc.reply)
+			p := newTestPublisher(t, b)
+
+			if err := publishWhenConnected(t, p); !errors.Is(err, tc.want) {
+				t.Fatalf("esperado %v, recebeu %v", tc.want, err)
+			}
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if len(b.mandatory) != 1 || !b.mandatory[0] {
+				t.Fatalf("a publicação deve usar mandatory, recebeu %v", b.mandatory)
+			}
+		})
+	}
+}
+
+func TestRabbitPublisher_IgnoresStaleReturns(t *testing.T) {
+	b := newFakeBroker()
+	p := newTestPublisher(t, b)
+	if err := publishWhenConnected(t, p); err != nil {
+		t.Fatal(err)
+	}
+	// uma devolução atrasada de outra mensagem não derruba a publicação seguinte
+	conn := <-b.conns
+	conn.ch.returns <- amqp.Return{ReplyCode: amqp.NoRoute, MessageId: uuid.NewString()}
+	if err := publishWhenConnected(t, p); err != nil {
+		t.Fatalf("esperado nil, recebeu %v", err)
+	}
+}
+
+func TestRabbitPublisher_ReconnectsAfterConnectionLoss(t *testing.T) {
+	b := newFakeBroker()
+	p := newTestPublisher(t, b)
+	if err := publishWhenConnected(t, p); err != nil {
+		t.Fatal(err)
+	}
+
+	(<-b.conns).drop()
+	select {
+	case <-b.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatal("o publisher deveria ter reconectado")
+	}
+	if err := publishWhenConnected(t, p); err != nil {
+		t.Fatalf("depois da reconexão: esperado nil, recebeu %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.published) != 2 {
+		t.Fatalf("esperadas 2 publicações, recebeu %d", len(b.published))
+	}
+}
+
+func TestRabbitPublisher_UnavailableAfterClose(t *testing.T) {
+	b := newFakeBroker()
+	p := newTestPublisher(t, b)
+	if err := publishWhenConnected(t, p); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	if err := p.Publish(event.Envelope{ID: uuid.New()}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("depois do Close: esperado ErrUnavailable, recebeu %v", err)
+	}
+}
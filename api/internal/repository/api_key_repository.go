@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrAPIKeyNotFound = fmt.Errorf("api key %w", ErrNotFound)
+
+// lastUsedResolution evita uma escrita por requisição: last_used_at só é
+// atualizado quando o registro anterior é mais antigo que isso
+const lastUsedResolution = time.Minute
+
+// APIKeyRepository opera sobre as chaves da loja do contexto, exceto GetByPrefix e
+// TouchLastUsed, usadas para autenticar a chave antes de a loja ser conhecida
+type APIKeyRepository interface {
+	Create(ctx context.Context, k *model.APIKey) error
+	List(ctx context.Context) ([]model.APIKey, error)
+	Get(ctx context.Context, id uuid.UUID) (model.APIKey, error)
+	// GetByPrefix procura em todas as lojas; a chave devolvida informa a sua
+	GetByPrefix(ctx context.Context, prefix string) (model.APIKey, error)
+	// Revoke marca a chave como revogada; revogar de novo mantém a data original
+	Revoke(ctx context.Context, id uuid.UUID) error
+	// TouchLastUsed registra o uso da chave, com resolução de lastUsedResolution
+	TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+type apiKeyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepository(db *pgxpool.Pool) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+const apiKeyColumns = `id, tenant_id, name, prefix, key_hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(row pgx.Row, k *model.APIKey) error {
+	return row.Scan(&k.ID, &k.TenantID, &k.Name, &k.Prefix, &k.KeyHash, &k.Scopes, &k.CreatedBy,
+		&k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt)
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, k *model.APIKey) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	k.ID, k.TenantID = uuid.New(), tid
+	k.CreatedAt = time.Now()
+	_, err = r.db.Exec(ctx, `
+    INSERT INTO api_keys (id, tenant_id, name, prefix, key_hash, scopes, created_by, created_at, expires_at)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		k.ID, k.TenantID, k.Name, k.Prefix, k.KeyHash, k.Scopes, k.CreatedBy, k.CreatedAt, k.ExpiresAt,
+	)
+	return mapError(err)
+}
+
+func (r *apiKeyRepo) List(ctx context.Context) ([]model.APIKey, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE tenant_id = $1 ORDER BY created_at`, tid)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	list := []model.APIKey{}
+	for rows.Next() {
+		var k model.APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			return nil, mapError(err)
+		}
+		list = append(list, k)
+	}
+	return list, mapError(rows.Err())
+}
+
+func (r *apiKeyRepo) Get(ctx context.Context, id uuid.UUID) (model.APIKey, error) {
+	var k model.APIKey
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return k, err
+	}
+	err = scanAPIKey(r.db.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1 AND tenant_id = $2`, id, tid), &k)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return k, ErrAPIKeyNotFound
+	}
+	return k, mapError(err)
+}
+
+func (r *apiKeyRepo) GetByPrefix(ctx context.Context, prefix string) (model.APIKey, error) {
+	var k model.APIKey
+	err := scanAPIKey(r.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix), &k)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return k, ErrAPIKeyNotFound
+	}
+	return k, mapError(err)
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, id uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2 AND tenant_id = $3`, time.Now(), id, tid)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.db.Exec(ctx, `
+    UPDATE api_keys SET last_used_at = $1
+     WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)`,
+		at, id, at.Add(-lastUsedResolution))
+	return mapError(err)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Erros de domínio devolvidos pelos repositórios; use errors.Is para testá-los
+var (
+	// ErrNotFound indica que o registro não existe
+	ErrNotFound = errors.New("not found")
+	// ErrConflict indica violação de unicidade/referência ou estado concorrente
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid indica dados rejeitados por uma constraint do banco
+	ErrInvalid = errors.New("invalid data")
+)
+
+// Códigos SQLSTATE tratados por mapError
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	pgCheckViolation      = "23514"
+)
+
+// mapError traduz erros do pgx para os erros de domínio, preservando a causa
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation, pgForeignKeyViolation:
+			return fmt.Errorf("%w: %s", ErrConflict, pgErr.ConstraintName)
+		case pgNotNullViolation, pgCheckViolation:
+			return fmt.Errorf("%w: %s", ErrInvalid, pgErr.ConstraintName)
+		}
+	}
+	return err
+}
+
+// isUniqueViolation informa se err é violação de unicidade da constraint informada
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && pgErr.ConstraintName == constraint
+}
+
+// isForeignKeyViolation informa se err é violação da chave estrangeira informada
+func isForeignKeyViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation && pgErr.ConstraintName == constraint
+}
@@ -3,20 +3,38 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrFruitNotFound = fmt.Errorf("fruit %w", ErrNotFound)
+	// ErrVersionConflict indica que a versão informada não é mais a atual
+	ErrVersionConflict = fmt.Errorf("fruit version %w", ErrConflict)
+)
+
+// FruitRepository opera só sobre as frutas da loja do contexto (tenant.Require)
 type FruitRepository interface {
+	// GetAll lista apenas as frutas que não estão na lixeira
 	GetAll(ctx context.Context) ([]model.Fruit, error)
+	// GetDeleted lista as frutas na lixeira
+	GetDeleted(ctx context.Context) ([]model.Fruit, error)
 	GetByID(ctx context.Context, id uuid.UUID) (model.Fruit, error)
 	Create(ctx context.Context, f *model.Fruit) error
+	// Update só altera a fruta se f.Version ainda for a versão atual
 	Update(ctx context.Context, f *model.Fruit) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	// Delete move a fruta para a lixeira se version ainda for a versão atual
+	Delete(ctx context.Context, id uuid.UUID, version int, deletedBy *uuid.UUID) error
+	// Restore tira a fruta da lixeira
+	Restore(ctx context.Context, id uuid.UUID) (model.Fruit, error)
+	// Purge remove definitivamente as frutas da loja na lixeira desde antes de before
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
 
 type fruitRepo struct {
@@ -27,53 +45,148 @@ func NewFruitRepository(db *pgxpool.Pool) FruitRepository {
 	return &fruitRepo{db: db}
 }
 
+const fruitColumns = `id, tenant_id, name, quantity, price, version, created_at, updated_at, deleted_at, deleted_by`
+
+func scanFruit(row pgx.Row, f *model.Fruit) error {
+	return row.Scan(&f.ID, &f.TenantID, &f.Name, &f.Quantity, &f.Price, &f.Version,
+		&f.CreatedAt, &f.UpdatedAt, &f.DeletedAt, &f.DeletedBy)
+}
+
 func (r *fruitRepo) GetAll(ctx context.Context) ([]model.Fruit, error) {
-	rows, err := r.db.Query(ctx, `SELECT id, name, quantity, price, created_at FROM fruits`)
+	return r.list(ctx, `SELECT `+fruitColumns+` FROM fruits WHERE tenant_id=$1 AND deleted_at IS NULL`)
+}
+
+func (r *fruitRepo) GetDeleted(ctx context.Context) ([]model.Fruit, error) {
+	return r.list(ctx, `SELECT `+fruitColumns+` FROM fruits WHERE tenant_id=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+}
+
+// list executa query com a loja do contexto como $1
+func (r *fruitRepo) list(ctx context.Context, query string) ([]model.Fruit, error) {
+	tid, err := tenant.Require(ctx)
 	if err != nil {
 		return nil, err
 	}
+	rows, err := r.db.Query(ctx, query, tid)
+	if err != nil {
+		return nil, mapError(err)
+	}
 	defer rows.Close()
 
 	var list []model.Fruit
 	for rows.Next() {
 		var f model.Fruit
-		if err := rows.Scan(&f.ID, &f.Name, &f.Quantity, &f.Price, &f.CreatedAt); err != nil {
-			return nil, err
+		if err := scanFruit(rows, &f); err != nil {
+			return nil, mapError(err)
 		}
 		list = append(list, f)
 	}
-	return list, nil
+	return list, mapError(rows.Err())
 }
 
 func (r *fruitRepo) GetByID(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
 	var f model.Fruit
-	err := r.db.QueryRow(ctx, `SELECT id, name, quantity, price, created_at FROM fruits WHERE id=$1`, id).
-		Scan(&f.ID, &f.Name, &f.Quantity, &f.Price, &f.CreatedAt)
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return f, err
+	}
+	err = scanFruit(r.db.QueryRow(ctx,
+		`SELECT `+fruitColumns+` FROM fruits WHERE id=$1 AND tenant_id=$2 AND deleted_at IS NULL`, id, tid), &f)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return f, errors.New("fruit not found")
+		return f, ErrFruitNotFound
 	}
-	return f, err
+	return f, mapError(err)
 }
 
 func (r *fruitRepo) Create(ctx context.Context, f *model.Fruit) error {
-	f.ID = uuid.New()
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	f.ID, f.TenantID = uuid.New(), tid
+	f.Version = 1
 	f.CreatedAt = time.Now()
-	_, err := r.db.Exec(ctx,
-		`INSERT INTO fruits (id, name, quantity, price, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6)`,
-		f.ID, f.Name, f.Quantity, f.Price, f.CreatedAt, f.UpdatedAt,
+	_, err = r.db.Exec(ctx,
+		`INSERT INTO fruits (id, tenant_id, name, quantity, price, version, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		f.ID, f.TenantID, f.Name, f.Quantity, f.Price, f.Version, f.CreatedAt, f.UpdatedAt,
 	)
-	return err
+	return mapError(err)
 }
 
 func (r *fruitRepo) Update(ctx context.Context, f *model.Fruit) error {
-	_, err := r.db.Exec(ctx,
-		`UPDATE fruits SET name=$1, quantity=$2, price=$3, updated_at=$4 WHERE id=$5`,
-		f.Name, f.Quantity, f.Price, time.Now(), f.ID,
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRow(ctx,
+		`UPDATE fruits SET name=$1, quantity=$2, price=$3, updated_at=$4, version=version+1
+		  WHERE id=$5 AND tenant_id=$6 AND version=$7 AND deleted_at IS NULL
+		  RETURNING version, updated_at`,
+		f.Name, f.Quantity, f.Price, time.Now(), f.ID, tid, f.Version,
+	).Scan(&f.Version, &f.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.missingOrConflict(ctx, tid, f.ID)
+	}
+	return mapError(err)
+}
+
+func (r *fruitRepo) Delete(ctx context.Context, id uuid.UUID, version int, deletedBy *uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE fruits SET deleted_at=$1, deleted_by=$2, version=version+1
+		  WHERE id=$3 AND tenant_id=$4 AND version=$5 AND deleted_at IS NULL`,
+		time.Now(), deletedBy, id, tid, version,
 	)
-	return err
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return r.missingOrConflict(ctx, tid, id)
+	}
+	return nil
 }
 
-func (r *fruitRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, `DELETE FROM fruits WHERE id=$1`, id)
-	return err
+func (r *fruitRepo) Restore(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
+	var f model.Fruit
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return f, err
+	}
+	err = scanFruit(r.db.QueryRow(ctx,
+		`UPDATE fruits SET deleted_at=NULL, deleted_by=NULL, updated_at=$1, version=version+1
+		  WHERE id=$2 AND tenant_id=$3 AND deleted_at IS NOT NULL
+		  RETURNING `+fruitColumns,
+		time.Now(), id, tid), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return f, ErrFruitNotFound
+	}
+	return f, mapError(err)
+}
+
+func (r *fruitRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tag, err := r.db.Exec(ctx, `DELETE FROM fruits WHERE tenant_id = $1 AND deleted_at < $2`, tid, before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// missingOrConflict explica por que um UPDATE condicional não afetou linhas
+func (r *fruitRepo) missingOrConflict(ctx context.Context, tid, id uuid.UUID) error {
+	var exists bool
+	err := r.db.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM fruits WHERE id=$1 AND tenant_id=$2 AND deleted_at IS NULL)`, id, tid).Scan(&exists)
+	if err != nil {
+		return mapError(err)
+	}
+	if !exists {
+		return ErrFruitNotFound
+	}
+	return ErrVersionConflict
 }
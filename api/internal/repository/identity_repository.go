@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrIdentityNotFound indica que a conta do provedor ainda não tem usuário local
+var ErrIdentityNotFound = fmt.Errorf("identity %w", ErrNotFound)
+
+// IdentityRepository vincula contas de provedores OIDC (provider + subject) aos
+// usuários da loja do contexto
+type IdentityRepository interface {
+	// UserID devolve o usuário vinculado à conta do provedor
+	UserID(ctx context.Context, provider, subject string) (uuid.UUID, error)
+	// Provision cria o usuário, seus papéis e o vínculo numa única transação
+	Provision(ctx context.Context, u *model.User, provider, subject string) error
+}
+
+type identityRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepository(db *pgxpool.Pool) IdentityRepository {
+	return &identityRepo{db: db}
+}
+
+func (r *identityRepo) UserID(ctx context.Context, provider, subject string) (uuid.UUID, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err = r.db.QueryRow(ctx,
+		`SELECT user_id FROM user_identities WHERE tenant_id = $1 AND provider = $2 AND subject = $3`,
+		tid, provider, subject).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrIdentityNotFound
+	}
+	return id, mapError(err)
+}
+
+func (r *identityRepo) Provision(ctx context.Context, u *model.User, provider, subject string) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := insertUser(ctx, tx, tid, u); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO user_identities (tenant_id, provider, subject, user_id, created_at) VALUES ($1,$2,$3,$4,$5)`,
+			tid, provider, subject, u.ID, time.Now())
+		return mapError(err)
+	})
+}
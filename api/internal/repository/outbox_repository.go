@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OutboxRepository entrega ao relay os eventos pendentes da tabela outbox. Os eventos
+// de todas as lojas passam pelo mesmo relay, então as consultas não usam o tenant do
+// contexto; a loja de cada evento vem da sua linha.
+type OutboxRepository interface {
+	// Claim reserva por lease até limit eventos pendentes e os devolve em ordem de id;
+	// outra instância só os vê de novo se o lease vencer. Um evento fica de fora enquanto
+	// houver um anterior do mesmo usuário reservado por outra instância ou reagendado, então
+	// a ordem por usuário vale com qualquer número de relays.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	// MarkSent registra a publicação do evento
+	MarkSent(ctx context.Context, id int64) error
+	// Fail registra a falha ao publicar o evento e o reagenda para at
+	Fail(ctx context.Context, id int64, at time.Time, lastErr string) error
+	// Postpone reagenda para at eventos reservados que não chegaram a ser tentados
+	Postpone(ctx context.Context, ids []int64, at time.Time) error
+	// PurgeSent apaga os eventos publicados antes de before e devolve quantos foram removidos
+	PurgeSent(ctx context.Context, before time.Time) (int64, error)
+}
+
+type outboxRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOutboxRepository(db *pgxpool.Pool) OutboxRepository {
+	return &outboxRepo{db: db}
+}
+
+// outboxClaimLock serializa os Claim das instâncias: cada um vê o lease gravado pelo anterior
+const outboxClaimLock = 0x6f7574626f78 // "outbox"
+
+func (r *outboxRepo) Claim(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	now := time.Now()
+	events := []model.OutboxEvent{}
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, outboxClaimLock); err != nil {
+			return mapError(err)
+		}
+		rows, err := tx.Query(ctx, `
+        UPDATE outbox SET next_attempt_at = $1
+         WHERE id IN (SELECT o.id FROM outbox o
+                       WHERE o.sent_at IS NULL AND o.next_attempt_at <= $2
+                         AND NOT EXISTS (SELECT 1 FROM outbox p
+                                          WHERE p.aggregate_id = o.aggregate_id AND p.id < o.id
+                                            AND p.sent_at IS NULL AND p.next_attempt_at > $2)
+                       ORDER BY o.id
+                       LIMIT $3
+                       FOR UPDATE SKIP LOCKED)
+     RETURNING id, action, payload, attempts, created_at, event_id, COALESCE(correlation_id, ''), actor, tenant_id`, now.Add(lease), now, limit)
+		if err != nil {
+			return mapError(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e model.OutboxEvent
+			if err := rows.Scan(&e.ID, &e.Action, &e.Payload, &e.Attempts, &e.CreatedAt, &e.EventID, &e.CorrelationID, &e.Actor, &e.TenantID); err != nil {
+				return mapError(err)
+			}
+			events = append(events, e)
+		}
+		return mapError(rows.Err())
+	})
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING não garante ordem
+	slices.SortFunc(events, func(a, b model.OutboxEvent) int { return cmp.Compare(a.ID, b.ID) })
+	return events, nil
+}
+
+func (r *outboxRepo) MarkSent(ctx context.Context, id int64) error {
+	_, err := r.db.Exec(ctx, `UPDATE outbox SET sent_at = $1, last_error = NULL WHERE id = $2`, time.Now(), id)
+	return mapError(err)
+}
+
+func (r *outboxRepo) Fail(ctx context.Context, id int64, at time.Time, lastErr string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $1, last_error = $2 WHERE id = $3`,
+		at, lastErr, id)
+	return mapError(err)
+}
+
+func (r *outboxRepo) Postpone(ctx context.Context, ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.Exec(ctx, `UPDATE outbox SET next_attempt_at = $1 WHERE id = ANY($2)`, at, ids)
+	return mapError(err)
+}
+
+func (r *outboxRepo) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM outbox WHERE sent_at < $1`, before)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// enqueueUserEvent grava em tx o evento action do usuário u da loja tid, publicado depois
+// pelo relay, com o correlation ID e o ator recebidos em ctx (ver event.WithMetadata)
+func enqueueUserEvent(ctx context.Context, tx pgx.Tx, tid uuid.UUID, action string, u model.User) error {
+	u.TenantID = tid
+	payload, err := json.Marshal(model.NewSimpleUser(u))
+	if err != nil {
+		return err
+	}
+	meta := event.MetadataFrom(ctx)
+	var correlationID *string
+	if meta.CorrelationID != "" {
+		correlationID = &meta.CorrelationID
+	}
+	now := time.Now()
+	_, err = tx.Exec(ctx, `
+    INSERT INTO outbox (action, payload, created_at, next_attempt_at, event_id, correlation_id, actor, tenant_id, aggregate_id)
+    VALUES ($1,$2,$3,$3,$4,$5,$6,$7,$8)`,
+		action, payload, now, uuid.New(), correlationID, meta.Actor, tid, u.ID)
+	return mapError(err)
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrResetTokenNotFound cobre token inexistente, expirado ou já usado
+var ErrResetTokenNotFound = fmt.Errorf("password reset token %w", ErrNotFound)
+
+// ResetRequest é um pedido de redefinição de senha aguardando o envio do token
+type ResetRequest struct {
+	ID       int64
+	TenantID uuid.UUID
+	Username string
+}
+
+// PasswordResetRepository opera sobre os tokens da loja do contexto, exceto Owner e ClaimRequests
+type PasswordResetRepository interface {
+	// Request grava um pedido de redefinição para username, atendido depois por ClaimRequests
+	Request(ctx context.Context, username string) error
+	// ClaimRequests remove e devolve, em ordem de id, até limit pedidos de todas as lojas;
+	// cada pedido é entregue a uma única instância
+	ClaimRequests(ctx context.Context, limit int) ([]ResetRequest, error)
+	// Create grava um token novo e descarta os pedidos anteriores ainda não usados
+	Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	// Owner devolve o dono de um token ainda utilizável e a sua loja, sem consumi-lo;
+	// procura em todas as lojas
+	Owner(ctx context.Context, tokenHash string, now time.Time) (userID, tenantID uuid.UUID, err error)
+	// Consume marca o token como usado e troca a senha na mesma transação;
+	// devolve o dono do token
+	Consume(ctx context.Context, tokenHash, passwordHash string, now time.Time) (uuid.UUID, error)
+}
+
+type passwordResetRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewPasswordResetRepository(db *pgxpool.Pool) PasswordResetRepository {
+	return &passwordResetRepo{db: db}
+}
+
+func (r *passwordResetRepo) Request(ctx context.Context, username string) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx,
+		`INSERT INTO password_reset_requests (tenant_id, username) VALUES ($1,$2)`, tid, username)
+	return mapError(err)
+}
+
+func (r *passwordResetRepo) ClaimRequests(ctx context.Context, limit int) ([]ResetRequest, error) {
+	rows, err := r.db.Query(ctx, `
+    DELETE FROM password_reset_requests
+     WHERE id IN (SELECT id FROM password_reset_requests
+                   ORDER BY id
+                   LIMIT $1
+                   FOR UPDATE SKIP LOCKED)
+ RETURNING id, tenant_id, username`, limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	requests := []ResetRequest{}
+	for rows.Next() {
+		var req ResetRequest
+		if err := rows.Scan(&req.ID, &req.TenantID, &req.Username); err != nil {
+			return nil, mapError(err)
+		}
+		requests = append(requests, req)
+	}
+	// RETURNING não garante ordem
+	slices.SortFunc(requests, func(a, b ResetRequest) int { return cmp.Compare(a.ID, b.ID) })
+	return requests, mapError(rows.Err())
+}
+
+func (r *passwordResetRepo) Create(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`DELETE FROM password_reset_tokens WHERE user_id = $1 AND tenant_id = $2 AND used_at IS NULL`, userID, tid)
+		if err != nil {
+			return mapError(err)
+		}
+		_, err = tx.Exec(ctx,
+			`INSERT INTO password_reset_tokens (token_hash, user_id, tenant_id, expires_at) VALUES ($1,$2,$3,$4)`,
+			tokenHash, userID, tid, expiresAt)
+		return mapError(err)
+	})
+}
+
+func (r *passwordResetRepo) Owner(ctx context.Context, tokenHash string, now time.Time) (userID, tenantID uuid.UUID, err error) {
+	err = r.db.QueryRow(ctx, `
+    SELECT user_id, tenant_id FROM password_reset_tokens
+     WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2`, tokenHash, now).Scan(&userID, &tenantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, uuid.Nil, ErrResetTokenNotFound
+	}
+	return userID, tenantID, mapError(err)
+}
+
+func (r *passwordResetRepo) Consume(ctx context.Context, tokenHash, passwordHash string, now time.Time) (uuid.UUID, error) {
+	var userID uuid.UUID
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return userID, err
+	}
+	err = pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+        UPDATE password_reset_tokens SET used_at = $2
+         WHERE token_hash = $1 AND tenant_id = $3 AND used_at IS NULL AND expires_at > $2
+        RETURNING user_id`, tokenHash, now, tid).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrResetTokenNotFound
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET password_hash = $1, must_change_password = FALSE, updated_at = $2 WHERE id = $3 AND tenant_id = $4`,
+			passwordHash, now, userID, tid)
+		if err != nil {
+			return mapError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+	return userID, err
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrRefreshTokenNotFound = fmt.Errorf("refresh token %w", ErrNotFound)
+	// ErrSessionNotFound cobre sessão inexistente, já encerrada ou de outro usuário
+	ErrSessionNotFound = fmt.Errorf("session %w", ErrNotFound)
+)
+
+// RefreshTokenRepository opera sobre os tokens da loja do contexto, exceto GetByHash
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, t *model.RefreshToken) error
+	// GetByHash procura em todas as lojas; o token devolvido informa a sua
+	GetByHash(ctx context.Context, hash string) (model.RefreshToken, error)
+	// MarkUsed marca o token como rotacionado; devolve false se ele já havia sido usado
+	MarkUsed(ctx context.Context, id uuid.UUID) (bool, error)
+	// RevokeFamily revoga todos os tokens derivados do mesmo login
+	RevokeFamily(ctx context.Context, familyID uuid.UUID) error
+	// RevokeAllForUser revoga todos os refresh tokens do usuário
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+	// ListSessions devolve as sessões do usuário com um refresh token ainda utilizável
+	ListSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]model.Session, error)
+	// RevokeSession revoga a família familyID se ela pertencer ao usuário
+	RevokeSession(ctx context.Context, userID, familyID uuid.UUID) error
+	// RevokeOtherSessions revoga todas as famílias do usuário, exceto keep
+	RevokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error
+}
+
+type refreshTokenRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRefreshTokenRepository(db *pgxpool.Pool) RefreshTokenRepository {
+	return &refreshTokenRepo{db: db}
+}
+
+func (r *refreshTokenRepo) Create(ctx context.Context, t *model.RefreshToken) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	t.ID, t.TenantID = uuid.New(), tid
+	t.CreatedAt = time.Now()
+	_, err = r.db.Exec(ctx,
+		`INSERT INTO refresh_tokens (id, family_id, user_id, tenant_id, token_hash, user_agent, ip, created_at, expires_at)
+         VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`,
+		t.ID, t.FamilyID, t.UserID, t.TenantID, t.TokenHash, t.UserAgent, t.IP, t.CreatedAt, t.ExpiresAt,
+	)
+	return mapError(err)
+}
+
+func (r *refreshTokenRepo) GetByHash(ctx context.Context, hash string) (model.RefreshToken, error) {
+	var t model.RefreshToken
+	err := r.db.QueryRow(ctx, `
+    SELECT id, family_id, user_id, tenant_id, token_hash, user_agent, ip, created_at, expires_at, used_at, revoked_at
+      FROM refresh_tokens
+     WHERE token_hash = $1`, hash,
+	).Scan(&t.ID, &t.FamilyID, &t.UserID, &t.TenantID, &t.TokenHash, &t.UserAgent, &t.IP,
+		&t.CreatedAt, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrRefreshTokenNotFound
+	}
+	return t, mapError(err)
+}
+
+func (r *refreshTokenRepo) MarkUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND tenant_id = $3 AND used_at IS NULL`, time.Now(), id, tid)
+	if err != nil {
+		return false, mapError(err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *refreshTokenRepo) RevokeFamily(ctx context.Context, familyID uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND tenant_id = $3 AND revoked_at IS NULL`,
+		time.Now(), familyID, tid)
+	return mapError(err)
+}
+
+func (r *refreshTokenRepo) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND tenant_id = $3 AND revoked_at IS NULL`,
+		time.Now(), userID, tid)
+	return mapError(err)
+}
+
+func (r *refreshTokenRepo) ListSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]model.Session, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(ctx, `
+    SELECT t.family_id, t.user_agent, t.ip, f.started_at, t.created_at, t.expires_at
+      FROM refresh_tokens t
+      JOIN (SELECT family_id, MIN(created_at) AS started_at
+              FROM refresh_tokens
+             WHERE user_id = $1 AND tenant_id = $3
+             GROUP BY family_id) f ON f.family_id = t.family_id
+     WHERE t.user_id = $1 AND t.tenant_id = $3
+       AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > $2
+     ORDER BY t.created_at DESC`, userID, now, tid)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, mapError(err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, mapError(rows.Err())
+}
+
+func (r *refreshTokenRepo) RevokeSession(ctx context.Context, userID, familyID uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1
+          WHERE user_id = $2 AND family_id = $3 AND tenant_id = $4 AND revoked_at IS NULL`,
+		time.Now(), userID, familyID, tid)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *refreshTokenRepo) RevokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(ctx,
+		`UPDATE refresh_tokens SET revoked_at = $1
+          WHERE user_id = $2 AND family_id <> $3 AND tenant_id = $4 AND revoked_at IS NULL`,
+		time.Now(), userID, keep, tid)
+	return mapError(err)
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrRoleNotFound = fmt.Errorf("role %w", ErrNotFound)
+	ErrRoleExists   = fmt.Errorf("role already exists: %w", ErrConflict)
+	// ErrUnknownPermission indica um papel com permissão inexistente
+	ErrUnknownPermission = fmt.Errorf("unknown permission: %w", ErrInvalid)
+)
+
+// RoleRepository opera sobre os papéis da loja do contexto; o catálogo de permissões
+// é o mesmo para todas as lojas
+type RoleRepository interface {
+	ListPermissions(ctx context.Context) ([]model.Permission, error)
+	List(ctx context.Context) ([]model.Role, error)
+	Get(ctx context.Context, name string) (model.Role, error)
+	Create(ctx context.Context, role *model.Role) error
+	// Update altera a descrição e substitui todas as permissões do papel
+	Update(ctx context.Context, role *model.Role) error
+	Delete(ctx context.Context, name string) error
+	// PermissionsOf devolve a união das permissões dos papéis informados
+	PermissionsOf(ctx context.Context, roles []string) ([]string, error)
+}
+
+type roleRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRoleRepository(db *pgxpool.Pool) RoleRepository {
+	return &roleRepo{db: db}
+}
+
+const roleColumns = `r.name, r.description,
+       COALESCE((SELECT array_agg(rp.permission ORDER BY rp.permission) FROM role_permissions rp
+                  WHERE rp.tenant_id = r.tenant_id AND rp.role = r.name), '{}'),
+       r.created_at, r.updated_at`
+
+func scanRole(row pgx.Row, role *model.Role) error {
+	return row.Scan(&role.Name, &role.Description, &role.Permissions, &role.CreatedAt, &role.UpdatedAt)
+}
+
+func (r *roleRepo) ListPermissions(ctx context.Context) ([]model.Permission, error) {
+	rows, err := r.db.Query(ctx, `SELECT name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var list []model.Permission
+	for rows.Next() {
+		var p model.Permission
+		if err := rows.Scan(&p.Name, &p.Description); err != nil {
+			return nil, mapError(err)
+		}
+		list = append(list, p)
+	}
+	return list, mapError(rows.Err())
+}
+
+func (r *roleRepo) List(ctx context.Context) ([]model.Role, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query(ctx, `SELECT `+roleColumns+` FROM roles r WHERE r.tenant_id = $1 ORDER BY r.name`, tid)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var list []model.Role
+	for rows.Next() {
+		var role model.Role
+		if err := scanRole(rows, &role); err != nil {
+			return nil, mapError(err)
+		}
+		list = append(list, role)
+	}
+	return list, mapError(rows.Err())
+}
+
+func (r *roleRepo) Get(ctx context.Context, name string) (model.Role, error) {
+	var role model.Role
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return role, err
+	}
+	err = scanRole(r.db.QueryRow(ctx, `SELECT `+roleColumns+` FROM roles r WHERE r.tenant_id = $1 AND r.name = $2`, tid, name), &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return role, ErrRoleNotFound
+	}
+	return role, mapError(err)
+}
+
+func (r *roleRepo) Create(ctx context.Context, role *model.Role) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	role.CreatedAt, role.UpdatedAt = now, now
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO roles (tenant_id, name, description, created_at, updated_at) VALUES ($1,$2,$3,$4,$5)`,
+			tid, role.Name, role.Description, role.CreatedAt, role.UpdatedAt)
+		if isUniqueViolation(err, "roles_pkey") {
+			return ErrRoleExists
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		return insertRolePermissions(ctx, tx, tid, role.Name, role.Permissions)
+	})
+}
+
+func (r *roleRepo) Update(ctx context.Context, role *model.Role) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	role.UpdatedAt = time.Now()
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`UPDATE roles SET description = $1, updated_at = $2 WHERE tenant_id = $3 AND name = $4 RETURNING created_at`,
+			role.Description, role.UpdatedAt, tid, role.Name,
+		).Scan(&role.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRoleNotFound
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM role_permissions WHERE tenant_id = $1 AND role = $2`, tid, role.Name); err != nil {
+			return mapError(err)
+		}
+		return insertRolePermissions(ctx, tx, tid, role.Name, role.Permissions)
+	})
+}
+
+func (r *roleRepo) Delete(ctx context.Context, name string) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx, `DELETE FROM roles WHERE tenant_id = $1 AND name = $2`, tid, name)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (r *roleRepo) PermissionsOf(ctx context.Context, roles []string) ([]string, error) {
+	var perms []string
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return perms, err
+	}
+	err = r.db.QueryRow(ctx, `
+    SELECT COALESCE(array_agg(DISTINCT permission ORDER BY permission), '{}')
+      FROM role_permissions
+     WHERE tenant_id = $1 AND role = ANY($2)`, tid, roles,
+	).Scan(&perms)
+	return perms, mapError(err)
+}
+
+func insertRolePermissions(ctx context.Context, tx pgx.Tx, tid uuid.UUID, role string, perms []string) error {
+	for _, p := range perms {
+		_, err := tx.Exec(ctx, `INSERT INTO role_permissions (tenant_id, role, permission) VALUES ($1, $2, $3)`, tid, role, p)
+		if isForeignKeyViolation(err, "role_permissions_permission_fkey") {
+			return ErrUnknownPermission
+		}
+		if err != nil {
+			return mapError(err)
+		}
+	}
+	return nil
+}
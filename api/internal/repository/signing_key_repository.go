@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// signingKeyLock serializa a rotação entre instâncias (pg_advisory_xact_lock)
+const signingKeyLock = 0x6a776b73 // "jwks"
+
+type SigningKeyRepository interface {
+	// List devolve as chaves ordenadas por activates_at
+	List(ctx context.Context) ([]model.SigningKey, error)
+	// CreateUnlessNewer grava k somente se nenhuma chave foi criada depois de since;
+	// devolve false quando outra instância já rotacionou
+	CreateUnlessNewer(ctx context.Context, k model.SigningKey, since time.Time) (bool, error)
+	Delete(ctx context.Context, kid string) error
+}
+
+type signingKeyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewSigningKeyRepository(db *pgxpool.Pool) SigningKeyRepository {
+	return &signingKeyRepo{db: db}
+}
+
+func (r *signingKeyRepo) List(ctx context.Context) ([]model.SigningKey, error) {
+	rows, err := r.db.Query(ctx, `
+    SELECT kid, algorithm, private_key, created_at, activates_at
+      FROM signing_keys
+     ORDER BY activates_at`)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	var list []model.SigningKey
+	for rows.Next() {
+		var k model.SigningKey
+		var pem string
+		if err := rows.Scan(&k.ID, &k.Algorithm, &pem, &k.CreatedAt, &k.ActivatesAt); err != nil {
+			return nil, mapError(err)
+		}
+		k.PrivateKey = []byte(pem)
+		list = append(list, k)
+	}
+	return list, mapError(rows.Err())
+}
+
+func (r *signingKeyRepo) CreateUnlessNewer(ctx context.Context, k model.SigningKey, since time.Time) (bool, error) {
+	created := false
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, signingKeyLock); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM signing_keys WHERE created_at > $1)`, since,
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO signing_keys (kid, algorithm, private_key, created_at, activates_at)
+             VALUES ($1,$2,$3,$4,$5)`,
+			k.ID, k.Algorithm, string(k.PrivateKey), k.CreatedAt, k.ActivatesAt)
+		created = err == nil
+		return err
+	})
+	return created, mapError(err)
+}
+
+func (r *signingKeyRepo) Delete(ctx context.Context, kid string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM signing_keys WHERE kid = $1`, kid)
+	return mapError(err)
+}
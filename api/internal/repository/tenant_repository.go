@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTenantNotFound = fmt.Errorf("tenant %w", ErrNotFound)
+	// ErrSlugTaken indica que já existe uma loja com o mesmo slug
+	ErrSlugTaken = fmt.Errorf("tenant slug already taken: %w", ErrConflict)
+)
+
+type TenantRepository interface {
+	Create(ctx context.Context, t *model.Tenant) error
+	List(ctx context.Context) ([]model.Tenant, error)
+	// ResolveTenant devolve o ID da loja pelo slug, ou tenant.ErrUnknown
+	ResolveTenant(ctx context.Context, slug string) (uuid.UUID, error)
+	// Delete remove uma loja ainda sem dados
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type tenantRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewTenantRepository(db *pgxpool.Pool) TenantRepository {
+	return &tenantRepo{db: db}
+}
+
+func (r *tenantRepo) Create(ctx context.Context, t *model.Tenant) error {
+	t.ID = uuid.New()
+	t.CreatedAt = time.Now()
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO tenants (id, slug, name, created_at) VALUES ($1,$2,$3,$4)`,
+			t.ID, t.Slug, t.Name, t.CreatedAt)
+		if isUniqueViolation(err, "tenants_slug_key") {
+			return ErrSlugTaken
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		return seedTenantRoles(ctx, tx, t.ID)
+	})
+}
+
+// seedTenantRoles cria os papéis iniciais da loja tid; tenants:manage fica de fora,
+// porque só vale na loja padrão
+func seedTenantRoles(ctx context.Context, tx pgx.Tx, tid uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+    INSERT INTO roles (tenant_id, name, description) VALUES
+      ($1, $2, 'Acesso total'),
+      ($1, $3, 'Somente leitura de frutas')`, tid, model.RoleAdmin, model.RoleUser)
+	if err != nil {
+		return mapError(err)
+	}
+	_, err = tx.Exec(ctx, `
+    INSERT INTO role_permissions (tenant_id, role, permission)
+    SELECT $1::uuid, $2::text, name FROM permissions WHERE name <> $3
+     UNION ALL
+    SELECT $1::uuid, $4::text, $5::text`,
+		tid, model.RoleAdmin, model.PermTenantsManage, model.RoleUser, model.PermFruitsRead)
+	return mapError(err)
+}
+
+func (r *tenantRepo) List(ctx context.Context) ([]model.Tenant, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, slug, name, created_at FROM tenants ORDER BY slug`)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+
+	list := []model.Tenant{}
+	for rows.Next() {
+		var t model.Tenant
+		if err := rows.Scan(&t.ID, &t.Slug, &t.Name, &t.CreatedAt); err != nil {
+			return nil, mapError(err)
+		}
+		list = append(list, t)
+	}
+	return list, mapError(rows.Err())
+}
+
+func (r *tenantRepo) ResolveTenant(ctx context.Context, slug string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRow(ctx, `SELECT id FROM tenants WHERE slug = $1`, slug).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, tenant.ErrUnknown
+	}
+	return id, mapError(err)
+}
+
+func (r *tenantRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTenantNotFound
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrTOTPNotFound       = fmt.Errorf("totp enrollment %w", ErrNotFound)
+	ErrTOTPAlreadyEnabled = fmt.Errorf("totp already enabled: %w", ErrConflict)
+)
+
+// TOTPRepository opera só sobre os cadastros da loja do contexto (tenant.Require)
+type TOTPRepository interface {
+	Get(ctx context.Context, userID uuid.UUID) (model.TOTP, error)
+	// SavePending grava (ou substitui) um segredo ainda não confirmado
+	SavePending(ctx context.Context, userID uuid.UUID, secret string) error
+	// Enable confirma o cadastro no passo informado e grava os códigos de recuperação
+	Enable(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error
+	// UseStep registra o passo aceito; devolve false se ele (ou um posterior) já foi usado
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	// ReplaceRecoveryCodes descarta os códigos de recuperação atuais e grava os novos
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	// UseRecoveryCode consome um código de recuperação; devolve false se ele não existir ou já foi usado
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+}
+
+type totpRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewTOTPRepository(db *pgxpool.Pool) TOTPRepository {
+	return &totpRepo{db: db}
+}
+
+func (r *totpRepo) Get(ctx context.Context, userID uuid.UUID) (model.TOTP, error) {
+	var t model.TOTP
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return t, err
+	}
+	err = r.db.QueryRow(ctx, `
+    SELECT user_id, secret, last_step, created_at, enabled_at
+      FROM user_totp
+     WHERE user_id = $1 AND tenant_id = $2`, userID, tid,
+	).Scan(&t.UserID, &t.Secret, &t.LastStep, &t.CreatedAt, &t.EnabledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, ErrTOTPNotFound
+	}
+	return t, mapError(err)
+}
+
+func (r *totpRepo) SavePending(ctx context.Context, userID uuid.UUID, secret string) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx, `
+    INSERT INTO user_totp (user_id, tenant_id, secret, created_at)
+    VALUES ($1, $2, $3, $4)
+    ON CONFLICT (user_id) DO UPDATE
+       SET secret = EXCLUDED.secret, last_step = 0, created_at = EXCLUDED.created_at
+     WHERE user_totp.enabled_at IS NULL AND user_totp.tenant_id = EXCLUDED.tenant_id`,
+		userID, tid, secret, time.Now())
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+func (r *totpRepo) Enable(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE user_totp SET enabled_at = $1, last_step = $2 WHERE user_id = $3 AND tenant_id = $4 AND enabled_at IS NULL`,
+			time.Now(), step, userID, tid)
+		if err != nil {
+			return mapError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrTOTPAlreadyEnabled
+		}
+		return replaceRecoveryCodes(ctx, tx, tid, userID, codeHashes)
+	})
+}
+
+func (r *totpRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE user_totp SET last_step = $1 WHERE user_id = $2 AND tenant_id = $3 AND last_step < $1`, step, userID, tid)
+	if err != nil {
+		return false, mapError(err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *totpRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, tid, userID, codeHashes)
+	})
+}
+
+func (r *totpRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return false, err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND tenant_id = $3 AND code_hash = $4 AND used_at IS NULL`,
+		time.Now(), userID, tid, codeHash)
+	if err != nil {
+		return false, mapError(err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, tid, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1 AND tenant_id = $2`, userID, tid); err != nil {
+		return mapError(err)
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO recovery_codes (id, user_id, tenant_id, code_hash) VALUES ($1, $2, $3, $4)`,
+			uuid.New(), userID, tid, h); err != nil {
+			return mapError(err)
+		}
+	}
+	return nil
+}
@@ -2,17 +2,48 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrUserNotFound = fmt.Errorf("user %w", ErrNotFound)
+	// ErrUsernameTaken indica que já existe um usuário com o mesmo username
+	ErrUsernameTaken = fmt.Errorf("username already taken: %w", ErrConflict)
+	// ErrEmailTaken indica que o e-mail já pertence a outro usuário
+	ErrEmailTaken = fmt.Errorf("email already taken: %w", ErrConflict)
+	// ErrUnknownRole indica a atribuição de um papel inexistente
+	ErrUnknownRole = fmt.Errorf("unknown role: %w", ErrInvalid)
+)
+
+// UserRepository opera só sobre os usuários da loja do contexto (tenant.Require).
+// Create, Update, UpdateProfile e Delete gravam o evento do usuário na outbox na
+// mesma transação, para que a fila user.queue não perca alterações.
 type UserRepository interface {
+	// Create grava o usuário e seus papéis
 	Create(ctx context.Context, u *model.User) error
-	GetAll(ctx context.Context) ([]model.User, error)
+	// List devolve a página pedida em f, ordenada por username, e o total de usuários do filtro
+	List(ctx context.Context, f model.UserFilter) ([]model.User, int, error)
+	GetByID(ctx context.Context, id uuid.UUID) (model.User, error)
 	GetByUsername(ctx context.Context, username string) (model.User, error)
+	// Update grava username e desativação e substitui todos os papéis do usuário
+	Update(ctx context.Context, u *model.User) error
+	// UpdateProfile grava nome de exibição e e-mail
+	UpdateProfile(ctx context.Context, u *model.User) error
+	// Delete remove o usuário; sessões, papéis e 2FA saem em cascata
+	Delete(ctx context.Context, id uuid.UUID) error
+	// UpdatePassword grava um novo hash de senha e o indicador de troca obrigatória
+	UpdatePassword(ctx context.Context, id uuid.UUID, hash string, mustChange bool) error
+	// CountActiveWithRole conta os usuários ativos da loja com o papel role, exceto except
+	CountActiveWithRole(ctx context.Context, role string, except uuid.UUID) (int, error)
 }
 
 type userRepo struct {
@@ -23,47 +54,247 @@ func NewUserRepository(db *pgxpool.Pool) UserRepository {
 	return &userRepo{db: db}
 }
 
+// userColumns inclui os papéis agregados de user_roles
+const userColumns = `u.id, u.tenant_id, u.username, u.display_name, COALESCE(u.email, ''), u.password_hash,
+       COALESCE((SELECT array_agg(ur.role ORDER BY ur.role) FROM user_roles ur WHERE ur.user_id = u.id), '{}'),
+       u.must_change_password, u.disabled_at, u.created_at, u.updated_at`
+
+func scanUser(row pgx.Row, u *model.User) error {
+	return row.Scan(&u.ID, &u.TenantID, &u.Username, &u.DisplayName, &u.Email, &u.PasswordHash, &u.Roles, &u.MustChangePassword, &u.DisabledAt, &u.CreatedAt, &u.UpdatedAt)
+}
+
 func (r *userRepo) Create(ctx context.Context, u *model.User) error {
-	u.ID = uuid.New()
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return insertUser(ctx, tx, tid, u)
+	})
+}
+
+// insertUser grava o usuário, seus papéis e o evento create na loja tid dentro de tx,
+// preenchendo ID e datas
+func insertUser(ctx context.Context, tx pgx.Tx, tid uuid.UUID, u *model.User) error {
+	u.ID, u.TenantID = uuid.New(), tid
 	now := time.Now()
 	u.CreatedAt, u.UpdatedAt = now, now
-	_, err := r.db.Exec(ctx,
-		`INSERT INTO users (id, username, password_hash, role, created_at, updated_at)
-         VALUES ($1,$2,$3,$4,$5,$6)`,
-		u.ID, u.Username, u.PasswordHash, u.Role, u.CreatedAt, u.UpdatedAt,
+	_, err := tx.Exec(ctx,
+		`INSERT INTO users (id, tenant_id, username, display_name, email, password_hash, must_change_password, created_at, updated_at)
+         VALUES ($1,$2,$3,$4,NULLIF($5, ''),$6,$7,$8,$9)`,
+		u.ID, u.TenantID, u.Username, u.DisplayName, u.Email, u.PasswordHash, u.MustChangePassword, u.CreatedAt, u.UpdatedAt,
 	)
-	return err
+	if isUniqueViolation(err, "users_username_key") {
+		return ErrUsernameTaken
+	}
+	if isUniqueViolation(err, "users_email_key") {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return mapError(err)
+	}
+	if err := insertUserRoles(ctx, tx, tid, u.ID, u.Roles); err != nil {
+		return err
+	}
+	return enqueueUserEvent(ctx, tx, tid, "create", *u)
 }
 
-func (r *userRepo) GetAll(ctx context.Context) ([]model.User, error) {
+// userFilter restringe à loja ($1) e aplica a busca ($2, um padrão LIKE) e o papel ($3), ambos opcionais
+const userFilter = `
+     WHERE u.tenant_id = $1
+       AND ($2 = '' OR u.username ILIKE $2 OR u.display_name ILIKE $2 OR u.email ILIKE $2)
+       AND ($3 = '' OR EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id AND ur.role = $3))`
+
+func (r *userRepo) List(ctx context.Context, f model.UserFilter) ([]model.User, int, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	pattern := ""
+	if f.Query != "" {
+		pattern = "%" + likeEscaper.Replace(f.Query) + "%"
+	}
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM users u`+userFilter, tid, pattern, f.Role).Scan(&total); err != nil {
+		return nil, 0, mapError(err)
+	}
+
 	rows, err := r.db.Query(ctx,
-		`SELECT id, username, password_hash, role, created_at, updated_at
-         FROM users ORDER BY created_at`)
+		`SELECT `+userColumns+`
+           FROM users u`+userFilter+`
+          ORDER BY u.username
+          LIMIT $4 OFFSET $5`, tid, pattern, f.Role, f.Limit, f.Offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, mapError(err)
 	}
 	defer rows.Close()
 
-	var users []model.User
+	users := []model.User{}
 	for rows.Next() {
 		var u model.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.UpdatedAt); err != nil {
-			return nil, err
+		if err := scanUser(rows, &u); err != nil {
+			return nil, 0, mapError(err)
 		}
 		users = append(users, u)
 	}
-	return users, nil
+	return users, total, mapError(rows.Err())
+}
+
+func (r *userRepo) CountActiveWithRole(ctx context.Context, role string, except uuid.UUID) (int, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = r.db.QueryRow(ctx, `
+    SELECT COUNT(*) FROM users u JOIN user_roles ur ON ur.user_id = u.id
+     WHERE u.tenant_id = $1 AND ur.role = $2 AND u.disabled_at IS NULL AND u.id <> $3`,
+		tid, role, except).Scan(&n)
+	return n, mapError(err)
+}
+
+// likeEscaper faz a busca tratar %, _ e \ como caracteres comuns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (r *userRepo) GetByID(ctx context.Context, id uuid.UUID) (model.User, error) {
+	var u model.User
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return u, err
+	}
+	err = scanUser(r.db.QueryRow(ctx, `
+    SELECT `+userColumns+`
+      FROM users u
+     WHERE u.id = $1 AND u.tenant_id = $2`, id, tid), &u)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return u, ErrUserNotFound
+	}
+	return u, mapError(err)
 }
 
 func (r *userRepo) GetByUsername(ctx context.Context, username string) (model.User, error) {
 	var u model.User
-	err := r.db.QueryRow(ctx, `
-    SELECT id, username, password_hash, role, created_at, updated_at
-      FROM users
-     WHERE username = $1`, username,
-	).Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.UpdatedAt)
+	tid, err := tenant.Require(ctx)
 	if err != nil {
 		return u, err
 	}
+	err = scanUser(r.db.QueryRow(ctx, `
+    SELECT `+userColumns+`
+      FROM users u
+     WHERE u.username = $1 AND u.tenant_id = $2`, username, tid), &u)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return u, ErrUserNotFound
+	}
+	if err != nil {
+		return u, mapError(err)
+	}
 	return u, nil
 }
+
+func (r *userRepo) Update(ctx context.Context, u *model.User) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	u.UpdatedAt = time.Now()
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET username = $1, disabled_at = $2, updated_at = $3 WHERE id = $4 AND tenant_id = $5`,
+			u.Username, u.DisabledAt, u.UpdatedAt, u.ID, tid)
+		if isUniqueViolation(err, "users_username_key") {
+			return ErrUsernameTaken
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM user_roles WHERE user_id = $1`, u.ID); err != nil {
+			return mapError(err)
+		}
+		if err := insertUserRoles(ctx, tx, tid, u.ID, u.Roles); err != nil {
+			return err
+		}
+		return enqueueUserEvent(ctx, tx, tid, "update", *u)
+	})
+}
+
+func (r *userRepo) UpdateProfile(ctx context.Context, u *model.User) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	u.UpdatedAt = time.Now()
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET display_name = $1, email = NULLIF($2, ''), updated_at = $3 WHERE id = $4 AND tenant_id = $5`,
+			u.DisplayName, u.Email, u.UpdatedAt, u.ID, tid)
+		if isUniqueViolation(err, "users_email_key") {
+			return ErrEmailTaken
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+		return enqueueUserEvent(ctx, tx, tid, "update", *u)
+	})
+}
+
+func (r *userRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		// lê o usuário (com os papéis) antes que eles saiam em cascata, para o evento delete
+		var u model.User
+		err := scanUser(tx.QueryRow(ctx, `
+        SELECT `+userColumns+`
+          FROM users u
+         WHERE u.id = $1 AND u.tenant_id = $2
+           FOR UPDATE`, id, tid), &u)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return mapError(err)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+			return mapError(err)
+		}
+		return enqueueUserEvent(ctx, tx, tid, "delete", u)
+	})
+}
+
+func (r *userRepo) UpdatePassword(ctx context.Context, id uuid.UUID, hash string, mustChange bool) error {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE users SET password_hash = $1, must_change_password = $2, updated_at = $3 WHERE id = $4 AND tenant_id = $5`,
+		hash, mustChange, time.Now(), id, tid)
+	if err != nil {
+		return mapError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func insertUserRoles(ctx context.Context, tx pgx.Tx, tid, userID uuid.UUID, roles []string) error {
+	for _, role := range roles {
+		_, err := tx.Exec(ctx, `INSERT INTO user_roles (tenant_id, user_id, role) VALUES ($1, $2, $3)`, tid, userID, role)
+		if isForeignKeyViolation(err, "user_roles_role_fkey") {
+			return ErrUnknownRole
+		}
+		if err != nil {
+			return mapError(err)
+		}
+	}
+	return nil
+}
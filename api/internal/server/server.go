@@ -1,25 +1,38 @@
 package server
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/hsalmeida/fruit-store-monorepo/api/docs"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/audit"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/handler"
-	"github.com/hsalmeida/fruit-store-monorepo/api/internal/publisher"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mfa"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/oidc"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
 	"github.com/jackc/pgx/v5/pgxpool"
-	amqp "github.com/rabbitmq/amqp091-go"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 type Server struct {
-	Router     *chi.Mux
-	DB         *pgxpool.Pool
-	Redis      *redis.Client
-	JWTAuth    *jwtauth.JWTAuth
-	RabbitConn *amqp.Connection
-	RabbitChan *amqp.Channel
+	Router    *chi.Mux
+	DB        *pgxpool.Pool
+	Redis     *redis.Client
+	Tokens    *auth.Tokens
+	Passwords password.Policy
+	// Logins limita as tentativas de login e Forgot os pedidos de redefinição de senha
+	Logins loginguard.Policy
+	Forgot loginguard.LimitPolicy
+	// OIDC são os provedores de identidade externos aceitos no login
+	OIDC []oidc.Config
 }
 
 // Option configura um Server
@@ -27,7 +40,12 @@ type Option func(*Server) error
 
 // New cria um Server aplicando todas as Option
 func New(opts ...Option) (*Server, error) {
-	s := &Server{Router: chi.NewRouter()}
+	s := &Server{
+		Router:    chi.NewRouter(),
+		Passwords: password.DefaultPolicy(),
+		Logins:    loginguard.DefaultPolicy(),
+		Forgot:    loginguard.DefaultForgotPolicy(),
+	}
 	for _, o := range opts {
 		if err := o(s); err != nil {
 			return nil, err
@@ -52,53 +70,196 @@ func WithRedis(client *redis.Client) Option {
 	}
 }
 
-func WithJWTAuth(auth *jwtauth.JWTAuth) Option {
+// WithTokens define o emissor/verificador de JWT usado pelo login e por todos os middlewares
+func WithTokens(tokens *auth.Tokens) Option {
+	return func(s *Server) error {
+		s.Tokens = tokens
+		return nil
+	}
+}
+
+// WithPasswordPolicy define as regras de senha e o custo do bcrypt
+func WithPasswordPolicy(p password.Policy) Option {
+	return func(s *Server) error {
+		s.Passwords = p
+		return nil
+	}
+}
+
+// WithLoginPolicy define os limites de tentativas de login
+func WithLoginPolicy(p loginguard.Policy) Option {
+	return func(s *Server) error {
+		s.Logins = p
+		return nil
+	}
+}
+
+// WithForgotPolicy define os limites de pedidos de redefinição de senha
+func WithForgotPolicy(p loginguard.LimitPolicy) Option {
 	return func(s *Server) error {
-		s.JWTAuth = auth
+		s.Forgot = p
 		return nil
 	}
 }
 
-func WithRabbit(conn *amqp.Connection, ch *amqp.Channel) Option {
+// WithOIDCProviders habilita o login pelos provedores de identidade informados
+func WithOIDCProviders(providers []oidc.Config) Option {
 	return func(s *Server) error {
-		s.RabbitConn = conn
-		s.RabbitChan = ch
+		for i := range providers {
+			if err := providers[i].Validate(); err != nil {
+				return err
+			}
+		}
+		s.OIDC = providers
 		return nil
 	}
 }
 
 func (s *Server) setupRoutes() {
+	s.Router.Use(problem.RequestID, handler.EventMetadata)
+	s.Router.NotFound(problem.NotFound)
+	s.Router.MethodNotAllowed(problem.MethodNotAllowed)
 
 	s.Router.Get("/swagger/*", httpSwagger.WrapHandler)
+	s.Router.Get("/.well-known/jwks.json", s.Tokens.Keys().JWKS)
+
+	denylist := auth.NewRedisDenylist(s.Redis, s.Tokens.Config().AccessTTL)
+	guard := loginguard.New(loginguard.NewRedisStore(s.Redis), s.Logins, audit.LogLogger{})
+	// um único RoleService resolve as permissões e recebe as alterações, mantendo o cache coerente
+	roles := service.NewRoleService(repository.NewRoleRepository(s.DB))
+	challenges := mfa.NewRedisChallengeStore(s.Redis)
+	loginHandler := handler.NewLoginHandler(s.DB, s.Tokens, denylist, guard, challenges, s.Passwords, roles)
+	roleHandler := handler.NewRoleHandler(roles)
+	apiKeys := service.NewAPIKeyService(repository.NewAPIKeyRepository(s.DB), repository.NewRoleRepository(s.DB))
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeys)
+	// nas rotas públicas de login a loja vem do cabeçalho X-Tenant; nas demais, do token ou da chave
+	tenants := repository.NewTenantRepository(s.DB)
+	byHeader := tenant.FromHeader(tenants)
+	providers := make([]*oidc.Provider, 0, len(s.OIDC))
+	for _, cfg := range s.OIDC {
+		providers = append(providers, oidc.NewProvider(cfg, nil))
+	}
+	loginHandler.WithOIDC(service.NewOIDCService(
+		providers,
+		oidc.NewRedisStateStore(s.Redis),
+		tenants,
+		repository.NewUserRepository(s.DB),
+		repository.NewIdentityRepository(s.DB),
+		// o login OIDC passa pelo mesmo segundo fator do login por senha
+		service.NewAuthService(
+			repository.NewUserRepository(s.DB),
+			repository.NewRefreshTokenRepository(s.DB),
+			repository.NewTOTPRepository(s.DB),
+			s.Tokens,
+			denylist,
+			guard,
+			challenges,
+			s.Passwords,
+			roles,
+		),
+		denylist,
+	))
+	// EventMetadata repete no fim da cadeia para que os eventos levem o usuário do token como ator
+	jwtChain := []func(http.Handler) http.Handler{s.Tokens.Verifier, auth.MustAuth, auth.NotRevoked(denylist), auth.TenantFromToken, handler.EventMetadata}
+
+	// Rotas públicas de login (incluindo o segundo fator), renovação de tokens e redefinição de senha
+	s.Router.Route("/auth", func(r chi.Router) {
+		forgotLimiter := loginguard.NewLimiter(loginguard.NewRedisStore(s.Redis), "forgot", s.Forgot)
+		passwordHandler := handler.NewPasswordHandler(s.DB, denylist, s.Passwords, forgotLimiter)
+		r.With(byHeader).Post("/login", loginHandler.Login)
+		r.Post("/2fa/verify", loginHandler.VerifyMFA)
+		r.Post("/refresh", loginHandler.Refresh)
+		r.With(byHeader).Post("/password/forgot", passwordHandler.Forgot)
+		r.Post("/password/reset", passwordHandler.Reset)
+		r.Post("/password/change", loginHandler.ChangePassword)
+		// login pelos provedores OIDC; a loja vem da configuração do provedor
+		r.Get("/oidc", loginHandler.OIDCProviders)
+		r.Get("/oidc/{provider}/login", loginHandler.OIDCLogin)
+		r.Get("/oidc/{provider}/callback", loginHandler.OIDCCallback)
 
-	// Rota pública de login utilizando auth.GenerateToken
-	s.Router.Route("/auth/login", func(r chi.Router) {
-		handler := handler.NewLoginHandler(s.DB)
-		r.Post("/", handler.Login)
+		r.Group(func(r chi.Router) {
+			mfaHandler := handler.NewMFAHandler(s.DB)
+			r.Use(jwtChain...)
+			r.Post("/logout", loginHandler.Logout)
+			r.Post("/2fa/enroll", mfaHandler.Enroll)
+			r.Post("/2fa/confirm", mfaHandler.Confirm)
+			r.Post("/2fa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		})
 	})
 
-	// Adiciona middleware JWT às rotas protegidas
+	// Frutas aceitam JWT ou, para integrações, Authorization: ApiKey com os escopos da chave
 	s.Router.Route("/fruits", func(r chi.Router) {
 		handler := handler.NewFruitHandler(s.DB, s.Redis)
-		r.Use(jwtauth.Verifier(s.JWTAuth))
-		r.Use(auth.MustAuth)
-		//List & Get: só admin OU user
-		r.With(auth.RoleAuth("admin", "user")).Get("/", handler.List)
-		r.With(auth.RoleAuth("admin", "user")).Get("/{id}", handler.Get)
-
-		//Create/Update/Delete: só admin
-		r.With(auth.RoleAuth("admin")).Post("/", handler.Create)
-		r.With(auth.RoleAuth("admin")).Put("/{id}", handler.Update)
-		r.With(auth.RoleAuth("admin")).Delete("/{id}", handler.Delete)
+		r.Use(auth.APIKeyOr(apiKeys, jwtChain...))
+		read := auth.RequirePermission(roles, model.PermFruitsRead)
+		write := auth.RequirePermission(roles, model.PermFruitsWrite)
+		r.With(read).Get("/", handler.List)
+		r.With(read).Get("/{id}", handler.Get)
+
+		r.With(write).Get("/trash", handler.Trash)
+		r.With(write).Post("/", handler.Create)
+		r.With(write).Put("/{id}", handler.Update)
+		r.With(write).Patch("/{id}", handler.Patch)
+		r.With(write).Delete("/{id}", handler.Delete)
+		r.With(write).Post("/{id}/restore", handler.Restore)
+	})
+
+	// Conta do próprio usuário autenticado
+	s.Router.Route("/me", func(r chi.Router) {
+		meHandler := handler.NewMeHandler(s.DB, denylist, guard, s.Passwords)
+		r.Use(jwtChain...)
+		r.Get("/", meHandler.Get)
+		r.Patch("/", meHandler.Patch)
+		r.Post("/password", meHandler.ChangePassword)
+		r.Get("/sessions", meHandler.Sessions)
+		r.Delete("/sessions/{id}", meHandler.RevokeSession)
 	})
 
 	s.Router.Route("/users", func(r chi.Router) {
-		pub := publisher.NewRabbitPublisher(s.RabbitChan, "user.queue")
-		handler := handler.NewUserHandler(s.DB, pub)
-		r.Use(jwtauth.Verifier(s.JWTAuth))
-		r.Use(auth.MustAuth, auth.RoleAuth("admin"))
+		handler := handler.NewUserHandler(s.DB, denylist, s.Passwords)
+		r.Use(jwtChain...)
+		r.Use(auth.RequirePermission(roles, model.PermUsersManage))
 		r.Get("/", handler.List)
 		r.Post("/", handler.Create)
+		r.Get("/{id}", handler.Get)
+		r.Put("/{id}", handler.Update)
+		r.Patch("/{id}", handler.Patch)
+		r.Delete("/{id}", handler.Delete)
+		r.Put("/{id}/roles", handler.SetRoles)
+		r.Post("/{id}/disable", handler.Disable)
+		r.Post("/{id}/enable", handler.Enable)
+		r.Post("/{id}/revoke-tokens", loginHandler.RevokeUserTokens)
+		r.Post("/{id}/unlock", loginHandler.UnlockUser)
+	})
+
+	// Gestão de papéis, permissões e chaves de API
+	s.Router.Group(func(r chi.Router) {
+		r.Use(jwtChain...)
+		r.Use(auth.RequirePermission(roles, model.PermUsersManage))
+		r.Get("/permissions", roleHandler.ListPermissions)
+		r.Route("/roles", func(r chi.Router) {
+			r.Get("/", roleHandler.List)
+			r.Get("/{name}", roleHandler.Get)
+			// cada loja edita os próprios papéis
+			r.Post("/", roleHandler.Create)
+			r.Put("/{name}", roleHandler.Update)
+			r.Delete("/{name}", roleHandler.Delete)
+		})
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Get("/", apiKeyHandler.List)
+			r.Post("/", apiKeyHandler.Create)
+			r.Get("/{id}", apiKeyHandler.Get)
+			r.Delete("/{id}", apiKeyHandler.Revoke)
+		})
+	})
+
+	// Lojas hospedadas na implantação, geridas pelos operadores da loja padrão
+	s.Router.Route("/tenants", func(r chi.Router) {
+		tenantHandler := handler.NewTenantHandler(s.DB, s.Passwords)
+		r.Use(jwtChain...)
+		r.Use(tenant.RequireOperator, auth.RequirePermission(roles, model.PermTenantsManage))
+		r.Get("/", tenantHandler.List)
+		r.Post("/", tenantHandler.Create)
 	})
 
 }
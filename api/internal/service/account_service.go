@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AccountService atende o próprio usuário autenticado em /me
+type AccountService interface {
+	Profile(ctx context.Context, userID uuid.UUID) (model.User, error)
+	// PatchProfile aplica um JSON Merge Patch sobre o model.ProfileInput atual; trocar o
+	// e-mail exige a senha atual, conferida com os mesmos limites do login, das contas que têm senha
+	PatchProfile(ctx context.Context, userID uuid.UUID, patch []byte, ip string) (model.User, error)
+	// ChangePassword exige a senha atual, com os mesmos limites do login, e encerra as
+	// sessões diferentes de current; os access tokens já emitidos são negados
+	ChangePassword(ctx context.Context, userID, current uuid.UUID, in model.PasswordChangeInput, ip string) error
+	// Sessions lista os logins ativos, marcando current
+	Sessions(ctx context.Context, userID, current uuid.UUID) ([]model.Session, error)
+	// RevokeSession encerra uma sessão do usuário; o access token dela vale até expirar
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+}
+
+type accountService struct {
+	users    repository.UserRepository
+	tokens   repository.RefreshTokenRepository
+	denylist auth.Denylist
+	guard    *loginguard.Guard
+	policy   password.Policy
+}
+
+func NewAccountService(
+	users repository.UserRepository,
+	tokens repository.RefreshTokenRepository,
+	denylist auth.Denylist,
+	guard *loginguard.Guard,
+	policy password.Policy,
+) AccountService {
+	return &accountService{users: users, tokens: tokens, denylist: denylist, guard: guard, policy: policy}
+}
+
+func (s *accountService) Profile(ctx context.Context, userID uuid.UUID) (model.User, error) {
+	return s.users.GetByID(ctx, userID)
+}
+
+func (s *accountService) PatchProfile(ctx context.Context, userID uuid.UUID, patch []byte, ip string) (model.User, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return u, err
+	}
+	doc, err := json.Marshal(model.ProfileInput{DisplayName: u.DisplayName, Email: u.Email})
+	if err != nil {
+		return u, err
+	}
+	merged, err := mergepatch.Apply(doc, patch)
+	if err != nil {
+		return u, &ValidationError{Resource: "profile", Reason: err.Error()}
+	}
+	var in model.ProfileInput
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return u, &ValidationError{Resource: "profile", Reason: err.Error()}
+	}
+
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	in.Email = strings.TrimSpace(in.Email)
+	if err := validateProfile(in); err != nil {
+		return u, err
+	}
+	// as contas criadas no login OIDC não têm senha local para conferir
+	if in.Email != u.Email && u.PasswordHash != "" {
+		if err := s.checkPassword(ctx, u, in.CurrentPassword, ip); err != nil {
+			return u, err
+		}
+	}
+	u.DisplayName, u.Email = in.DisplayName, in.Email
+	if err := s.users.UpdateProfile(ctx, &u); err != nil {
+		return u, err
+	}
+	return u, nil
+}
+
+func (s *accountService) ChangePassword(ctx context.Context, userID, current uuid.UUID, in model.PasswordChangeInput, ip string) error {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword(ctx, u, in.CurrentPassword, ip); err != nil {
+		return err
+	}
+	if err := validatePasswordChange(ctx, s.policy, in, u.Username); err != nil {
+		return err
+	}
+	hash, err := s.policy.Hash(in.NewPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.users.UpdatePassword(ctx, u.ID, hash, false); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeOtherSessions(ctx, u.ID, current); err != nil {
+		return err
+	}
+	// o denylist só corta por usuário: a sessão atual continua e renova o próprio access token
+	return s.denylist.RevokeUser(ctx, u.ID.String(), time.Now())
+}
+
+// checkPassword confere a senha atual de u contando as falhas no loginguard, que
+// bloqueia o username como em /auth/login
+func (s *accountService) checkPassword(ctx context.Context, u model.User, pw, ip string) error {
+	wait, err := s.guard.Allow(ctx, u.Username, ip)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &TooManyAttemptsError{RetryAfter: wait}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(pw)) != nil {
+		if err := s.guard.Failure(ctx, u.Username, ip); err != nil {
+			return err
+		}
+		v := newValidator("password")
+		v.check(false, "current_password", "does not match")
+		return v.err()
+	}
+	return s.guard.Success(ctx, u.Username)
+}
+
+func (s *accountService) Sessions(ctx context.Context, userID, current uuid.UUID) ([]model.Session, error) {
+	sessions, err := s.tokens.ListSessions(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	return sessions, nil
+}
+
+func (s *accountService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	return s.tokens.RevokeSession(ctx, userID, sessionID)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+)
+
+// Formato das chaves: fsk_<id de 8 caracteres>_<segredo de 52 caracteres>.
+// O trecho fsk_<id> é o prefixo público, que identifica a chave em logs e listagens.
+const (
+	apiKeyTag       = "fsk_"
+	apiKeyIDLen     = 8
+	apiKeySecretLen = 32 // bytes aleatórios do segredo
+)
+
+var apiKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// APIKeyService emite e valida as chaves de API dos clientes máquina a máquina
+type APIKeyService interface {
+	// Create emite uma chave; o segredo só é devolvido aqui
+	Create(ctx context.Context, createdBy uuid.UUID, in model.APIKeyInput) (model.CreatedAPIKey, error)
+	List(ctx context.Context) ([]model.APIKey, error)
+	Get(ctx context.Context, id uuid.UUID) (model.APIKey, error)
+	Revoke(ctx context.Context, id uuid.UUID) error
+	// AuthenticateAPIKey implementa auth.APIKeyAuthenticator
+	AuthenticateAPIKey(ctx context.Context, key string) (auth.APIClient, error)
+}
+
+type apiKeyService struct {
+	repo  repository.APIKeyRepository
+	roles repository.RoleRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, roles repository.RoleRepository) APIKeyService {
+	return &apiKeyService{repo: repo, roles: roles}
+}
+
+func (s *apiKeyService) Create(ctx context.Context, createdBy uuid.UUID, in model.APIKeyInput) (model.CreatedAPIKey, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Scopes = normalizeNames(in.Scopes)
+	if err := s.validate(ctx, in); err != nil {
+		return model.CreatedAPIKey{}, err
+	}
+	prefix, key, err := newAPIKey()
+	if err != nil {
+		return model.CreatedAPIKey{}, err
+	}
+	k := model.APIKey{
+		Name:      in.Name,
+		Prefix:    prefix,
+		KeyHash:   HashToken(key),
+		Scopes:    in.Scopes,
+		ExpiresAt: in.ExpiresAt,
+	}
+	if createdBy != uuid.Nil {
+		k.CreatedBy = &createdBy
+	}
+	if err := s.repo.Create(ctx, &k); err != nil {
+		return model.CreatedAPIKey{}, err
+	}
+	return model.CreatedAPIKey{APIKey: k, Key: key}, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context) ([]model.APIKey, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *apiKeyService) Get(ctx context.Context, id uuid.UUID) (model.APIKey, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, id uuid.UUID) error {
+	return s.repo.Revoke(ctx, id)
+}
+
+func (s *apiKeyService) AuthenticateAPIKey(ctx context.Context, key string) (auth.APIClient, error) {
+	prefix, ok := apiKeyPrefix(key)
+	if !ok {
+		return auth.APIClient{}, auth.ErrInvalidAPIKey
+	}
+	k, err := s.repo.GetByPrefix(ctx, prefix)
+	if errors.Is(err, repository.ErrNotFound) {
+		return auth.APIClient{}, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return auth.APIClient{}, err
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(HashToken(key)), []byte(k.KeyHash)) != 1 || !k.Active(now) {
+		return auth.APIClient{}, auth.ErrInvalidAPIKey
+	}
+	// o registro de uso é informativo: uma falha aqui não bloqueia a requisição
+	if err := s.repo.TouchLastUsed(ctx, k.ID, now); err != nil {
+		log.Printf("api key %s: record last use: %v", k.Prefix, err)
+	}
+	return auth.APIClient{KeyID: k.ID.String(), Name: k.Name, Scopes: k.Scopes, TenantID: k.TenantID}, nil
+}
+
+// validate confere a entrada contra as permissões existentes, que são os escopos possíveis
+func (s *apiKeyService) validate(ctx context.Context, in model.APIKeyInput) error {
+	perms, err := s.roles.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(perms))
+	for _, p := range perms {
+		known[p.Name] = true
+	}
+	return validateAPIKey(in, known, time.Now())
+}
+
+// newAPIKey gera a chave completa e seu prefixo público
+func newAPIKey() (prefix, key string, err error) {
+	b := make([]byte, 5+apiKeySecretLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id := strings.ToLower(apiKeyEncoding.EncodeToString(b[:5]))
+	secret := strings.ToLower(apiKeyEncoding.EncodeToString(b[5:]))
+	prefix = apiKeyTag + id
+	return prefix, prefix + "_" + secret, nil
+}
+
+// apiKeyPrefix extrai o prefixo público de uma chave bem formada
+func apiKeyPrefix(key string) (string, bool) {
+	n := len(apiKeyTag) + apiKeyIDLen
+	if !strings.HasPrefix(key, apiKeyTag) || len(key) <= n+1 || key[n] != '_' {
+		return "", false
+	}
+	return key[:n], true
+}
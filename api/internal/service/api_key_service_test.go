@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// memAPIKeyRepo é um APIKeyRepository em memória que registra os prefixos consultados
+type memAPIKeyRepo struct {
+	keys    map[uuid.UUID]*model.APIKey
+	lookups []string
+	touched int
+}
+
+func newMemAPIKeyRepo() *memAPIKeyRepo {
+	return &memAPIKeyRepo{keys: map[uuid.UUID]*model.APIKey{}}
+}
+
+func (m *memAPIKeyRepo) Create(ctx context.Context, k *model.APIKey) error {
+	k.ID, k.CreatedAt = uuid.New(), time.Now()
+	stored := *k
+	m.keys[k.ID] = &stored
+	return nil
+}
+func (m *memAPIKeyRepo) List(ctx context.Context) ([]model.APIKey, error) {
+	list := []model.APIKey{}
+	for _, k := range m.keys {
+		list = append(list, *k)
+	}
+	return list, nil
+}
+func (m *memAPIKeyRepo) Get(ctx context.Context, id uuid.UUID) (model.APIKey, error) {
+	k, ok := m.keys[id]
+	if !ok {
+		return model.APIKey{}, repository.ErrNotFound
+	}
+	return *k, nil
+}
+func (m *memAPIKeyRepo) GetByPrefix(ctx context.Context, prefix string) (model.APIKey, error) {
+	m.lookups = append(m.lookups, prefix)
+	for _, k := range m.keys {
+		if k.Prefix == prefix {
+			return *k, nil
+		}
+	}
+	return model.APIKey{}, repository.ErrNotFound
+}
+func (m *memAPIKeyRepo) Revoke(ctx context.Context, id uuid.UUID) error {
+	now := time.Now()
+	m.keys[id].RevokedAt = &now
+	return nil
+}
+func (m *memAPIKeyRepo) TouchLastUsed(ctx context.Context, id uuid.UUID, at time.Time) error {
+	m.touched++
+	m.keys[id].LastUsedAt = &at
+	return nil
+}
+
+// permissionsRepo só responde às permissões existentes, que são os escopos aceitos
+type permissionsRepo struct {
+	repository.RoleRepository
+}
+
+func (permissionsRepo) ListPermissions(ctx context.Context) ([]model.Permission, error) {
+	return []model.Permission{{Name: model.PermFruitsRead}, {Name: model.PermFruitsWrite}}, nil
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemAPIKeyRepo()
+	svc := service.NewAPIKeyService(repo, permissionsRepo{})
+	issue := func(name string) model.CreatedAPIKey {
+		t.Helper()
+		k, err := svc.Create(ctx, uuid.Nil, model.APIKeyInput{Name: name, Scopes: []string{model.PermFruitsRead}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	valid := issue("erp")
+	expired := issue("legado")
+	past := time.Now().Add(-time.Minute)
+	repo.keys[expired.ID].ExpiresAt = &past
+	revoked := issue("antiga")
+	if err := svc.Revoke(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := svc.AuthenticateAPIKey(ctx, valid.Key)
+	if err != nil || client.KeyID != valid.ID.String() || client.Name != "erp" || len(client.Scopes) != 1 {
+		t.Fatalf("chave válida: esperado o cliente erp, recebeu %+v, %v", client, err)
+	}
+	if repo.touched != 1 || repo.keys[valid.ID].LastUsedAt == nil {
+		t.Fatal("o uso da chave válida deveria ser registrado")
+	}
+
+	// o segredo trocado mantém o prefixo, então a chave é encontrada e o hash não confere
+	last := "a"
+	if strings.HasSuffix(valid.Key, "a") {
+		last = "b"
+	}
+	tampered := valid.Key[:len(valid.Key)-1] + last
+	cases := []struct {
+		name   string
+		key    string
+		lookup bool
+	}{
+		{"expirada", expired.Key, true},
+		{"revogada", revoked.Key, true},
+		{"hash diferente", tampered, true},
+		{"prefixo desconhecido", "fsk_zzzzzzzz_" + strings.Repeat("a", 52), true},
+		{"vazia", "", false},
+		{"sem a marca fsk_", "abc_" + valid.Key[4:], false},
+		{"id curto", "fsk_abc_" + strings.Repeat("a", 52), false},
+		{"sem segredo", valid.Prefix, false},
+		{"segredo vazio", valid.Prefix + "_", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := len(repo.lookups)
+			_, err := svc.AuthenticateAPIKey(ctx, tc.key)
+			if !errors.Is(err, auth.ErrInvalidAPIKey) {
+				t.Fatalf("esperado ErrInvalidAPIKey, recebeu %v", err)
+			}
+			if looked := len(repo.lookups) > before; looked != tc.lookup {
+				t.Fatalf("consulta ao repositório: esperado %v, recebeu %v", tc.lookup, looked)
+			}
+			if tc.lookup && repo.lookups[len(repo.lookups)-1] != tc.key[:len(valid.Prefix)] {
+				t.Fatalf("prefixo consultado errado: %q", repo.lookups[len(repo.lookups)-1])
+			}
+		})
+	}
+	if repo.touched != 1 {
+		t.Fatalf("chaves recusadas não registram uso, recebeu %d registros", repo.touched)
+	}
+}
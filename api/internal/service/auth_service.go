@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mfa"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrInvalidPasswordChallenge cobre desafio de troca de senha desconhecido ou expirado
+	ErrInvalidPasswordChallenge = errors.New("invalid or expired password change challenge")
+	// ErrRefreshTokenReused indica que um token já rotacionado foi reapresentado;
+	// toda a família é revogada, pois o token pode ter sido roubado
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// TokenPair é o par de tokens devolvido no login e no refresh
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// challengeTTL é o prazo para informar o segundo fator após acertar a senha
+const challengeTTL = 5 * time.Minute
+
+// LoginResult traz os tokens ou, se o usuário precisa trocar a senha ou informar
+// o segundo fator, o desafio pendente
+type LoginResult struct {
+	Tokens         TokenPair
+	Challenge      *MFAChallenge
+	PasswordChange *PasswordChangeChallenge
+	// RecoveryCodes só é preenchido no login que conclui o cadastro do TOTP
+	RecoveryCodes []string
+}
+
+// MFAChallenge é devolvido no lugar dos tokens quando o login exige o segundo fator.
+// Enrollment vem preenchido quando a política exige um TOTP que o usuário ainda não cadastrou.
+type MFAChallenge struct {
+	Token      string
+	ExpiresIn  time.Duration
+	Enrollment *Enrollment
+}
+
+// PasswordChangeChallenge é devolvido no lugar dos tokens quando a senha precisa ser
+// trocada antes do login, como no primeiro acesso das contas semeadas
+type PasswordChangeChallenge struct {
+	Token     string
+	ExpiresIn time.Duration
+}
+
+type AuthService interface {
+	// Login autentica por senha; com 2FA ativo (ou exigido) devolve um desafio em vez dos tokens
+	Login(ctx context.Context, username, password string, client model.ClientInfo) (LoginResult, error)
+	// ChangePassword troca a senha exigida no login e segue para o segundo fator ou para os tokens
+	ChangePassword(ctx context.Context, challengeToken, newPassword string, client model.ClientInfo) (LoginResult, error)
+	// CompleteLogin conclui o login de quem já se autenticou por outro meio, como um provedor
+	// OIDC, passando pelo mesmo segundo fator (ou cadastro obrigatório do TOTP) do Login
+	CompleteLogin(ctx context.Context, u model.User, client model.ClientInfo) (LoginResult, error)
+	// VerifyMFA conclui o login respondendo ao desafio com um código TOTP ou de recuperação
+	VerifyMFA(ctx context.Context, challengeToken, code string, client model.ClientInfo) (LoginResult, error)
+	// Refresh troca um refresh token válido por um novo par (rotação)
+	Refresh(ctx context.Context, refreshToken string, client model.ClientInfo) (TokenPair, error)
+	// Logout revoga o access token atual (jti) e, se informado, a família do refresh token
+	Logout(ctx context.Context, userID uuid.UUID, jti string, expiresAt time.Time, refreshToken string) error
+	// RevokeUserTokens invalida todos os access e refresh tokens já emitidos para o usuário
+	RevokeUserTokens(ctx context.Context, userID uuid.UUID) error
+	// UnlockUser remove o bloqueio por tentativas falhas; actor é quem desbloqueou
+	UnlockUser(ctx context.Context, userID uuid.UUID, actor string) error
+}
+
+type authService struct {
+	sessionIssuer
+	users      UserService
+	repo       repository.UserRepository
+	mfa        *mfaService
+	denylist   auth.Denylist
+	guard      *loginguard.Guard
+	challenges mfa.ChallengeStore
+	policy     password.Policy
+	roles      auth.PermissionResolver
+}
+
+func NewAuthService(
+	users repository.UserRepository,
+	tokens repository.RefreshTokenRepository,
+	totp repository.TOTPRepository,
+	issuer *auth.Tokens,
+	denylist auth.Denylist,
+	guard *loginguard.Guard,
+	challenges mfa.ChallengeStore,
+	policy password.Policy,
+	roles auth.PermissionResolver,
+) AuthService {
+	return &authService{
+		sessionIssuer: sessionIssuer{issuer: issuer, tokens: tokens},
+		users:         NewUserService(users, tokens, denylist, policy),
+		repo:          users,
+		mfa:           &mfaService{users: users, repo: totp},
+		denylist:      denylist,
+		guard:         guard,
+		challenges:    challenges,
+		policy:        policy,
+		roles:         roles,
+	}
+}
+
+func (s *authService) Login(ctx context.Context, username, password string, client model.ClientInfo) (LoginResult, error) {
+	if err := s.allow(ctx, username, client.IP); err != nil {
+		return LoginResult{}, err
+	}
+
+	u, err := s.users.Authenticate(ctx, username, password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if ferr := s.guard.Failure(ctx, username, client.IP); ferr != nil {
+			return LoginResult{}, ferr
+		}
+		return LoginResult{}, err
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if u.MustChangePassword {
+		return s.passwordChallenge(ctx, u)
+	}
+	return s.secondFactor(ctx, u, client)
+}
+
+func (s *authService) ChangePassword(ctx context.Context, challengeToken, newPassword string, client model.ClientInfo) (LoginResult, error) {
+	id := HashToken(challengeToken)
+	c, ok, err := s.challenges.Get(ctx, id)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !ok || !c.ChangePassword || c.TenantID == uuid.Nil {
+		return LoginResult{}, ErrInvalidPasswordChallenge
+	}
+	ctx = tenant.WithID(ctx, c.TenantID)
+	u, err := s.repo.GetByID(ctx, c.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return LoginResult{}, ErrInvalidPasswordChallenge
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if u.Disabled() {
+		return LoginResult{}, ErrUserDisabled
+	}
+	if err := validateNewPassword(ctx, s.policy, newPassword, u.Username); err != nil {
+		return LoginResult{}, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(newPassword)) == nil {
+		v := newValidator("password")
+		v.check(false, "password", "must differ from the current password")
+		return LoginResult{}, v.err()
+	}
+	hash, err := s.policy.Hash(newPassword)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if err := s.repo.UpdatePassword(ctx, u.ID, hash, false); err != nil {
+		return LoginResult{}, err
+	}
+	if err := s.challenges.Delete(ctx, id); err != nil {
+		return LoginResult{}, err
+	}
+	u.PasswordHash, u.MustChangePassword = hash, false
+	return s.secondFactor(ctx, u, client)
+}
+
+func (s *authService) VerifyMFA(ctx context.Context, challengeToken, code string, client model.ClientInfo) (LoginResult, error) {
+	id := HashToken(challengeToken)
+	c, ok, err := s.challenges.Get(ctx, id)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !ok || c.ChangePassword || c.TenantID == uuid.Nil {
+		return LoginResult{}, ErrInvalidMFAChallenge
+	}
+	ctx = tenant.WithID(ctx, c.TenantID)
+	// os códigos contam para o mesmo limite de tentativas da senha
+	if err := s.allow(ctx, c.Username, client.IP); err != nil {
+		return LoginResult{}, err
+	}
+
+	var codes []string
+	if c.Enroll {
+		codes, err = s.mfa.confirm(ctx, c.UserID, code)
+	} else {
+		err = s.mfa.verify(ctx, c.UserID, code)
+	}
+	if errors.Is(err, ErrInvalidMFACode) {
+		if ferr := s.guard.Failure(ctx, c.Username, client.IP); ferr != nil {
+			return LoginResult{}, ferr
+		}
+		return LoginResult{}, err
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	if err := s.challenges.Delete(ctx, id); err != nil {
+		return LoginResult{}, err
+	}
+	if err := s.guard.Success(ctx, c.Username); err != nil {
+		return LoginResult{}, err
+	}
+	u, err := s.repo.GetByID(ctx, c.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return LoginResult{}, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if u.Disabled() {
+		return LoginResult{}, ErrUserDisabled
+	}
+	pair, err := s.issue(ctx, u, uuid.New(), client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{Tokens: pair, RecoveryCodes: codes}, nil
+}
+
+func (s *authService) Refresh(ctx context.Context, refreshToken string, client model.ClientInfo) (TokenPair, error) {
+	t, err := s.tokens.GetByHash(ctx, HashToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if t.RevokedAt != nil || time.Now().After(t.ExpiresAt) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	// a rota de refresh é pública: a loja vem do próprio token
+	ctx = tenant.WithID(ctx, t.TenantID)
+	if t.UsedAt != nil {
+		return TokenPair{}, s.revokeReused(ctx, t.FamilyID)
+	}
+	// MarkUsed é condicional: se duas requisições rotacionarem o mesmo token ao mesmo tempo, só uma vence
+	ok, err := s.tokens.MarkUsed(ctx, t.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !ok {
+		return TokenPair{}, s.revokeReused(ctx, t.FamilyID)
+	}
+
+	u, err := s.repo.GetByID(ctx, t.UserID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && u.Disabled()) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return s.issue(ctx, u, t.FamilyID, client)
+}
+
+func (s *authService) Logout(ctx context.Context, userID uuid.UUID, jti string, expiresAt time.Time, refreshToken string) error {
+	if err := s.denylist.Revoke(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	t, err := s.tokens.GetByHash(ctx, HashToken(refreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// só encerra a sessão se o refresh token pertencer ao mesmo usuário
+	if t.UserID != userID || t.TenantID != tenantOf(ctx) {
+		return nil
+	}
+	return s.tokens.RevokeFamily(ctx, t.FamilyID)
+}
+
+func (s *authService) RevokeUserTokens(ctx context.Context, userID uuid.UUID) error {
+	if _, err := s.repo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.denylist.RevokeUser(ctx, userID.String(), time.Now())
+}
+
+func (s *authService) UnlockUser(ctx context.Context, userID uuid.UUID, actor string) error {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.guard.Unlock(ctx, u.Username, actor)
+}
+
+func (s *authService) CompleteLogin(ctx context.Context, u model.User, client model.ClientInfo) (LoginResult, error) {
+	return s.secondFactor(ctx, u, client)
+}
+
+// secondFactor conclui o login de quem já provou a senha: emite os tokens ou,
+// com 2FA ativo (ou exigido), devolve o desafio do segundo fator
+func (s *authService) secondFactor(ctx context.Context, u model.User, client model.ClientInfo) (LoginResult, error) {
+	t, err := s.mfa.repo.Get(ctx, u.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return LoginResult{}, err
+	}
+	enabled := err == nil && t.Enabled()
+	required, err := mfaRequired(ctx, s.roles, u)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !enabled && !required {
+		if err := s.guard.Success(ctx, u.Username); err != nil {
+			return LoginResult{}, err
+		}
+		pair, err := s.issue(ctx, u, uuid.New(), client)
+		return LoginResult{Tokens: pair}, err
+	}
+
+	// as falhas só são zeradas quando o segundo fator também for aceito
+	challenge := &MFAChallenge{ExpiresIn: challengeTTL}
+	if !enabled {
+		enr, err := s.mfa.begin(ctx, u)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		challenge.Enrollment = &enr
+	}
+	if challenge.Token, err = newOpaqueToken(); err != nil {
+		return LoginResult{}, err
+	}
+	c := mfa.Challenge{UserID: u.ID, TenantID: u.TenantID, Username: u.Username, Enroll: !enabled}
+	if err := s.challenges.Save(ctx, HashToken(challenge.Token), c, challengeTTL); err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{Challenge: challenge}, nil
+}
+
+// passwordChallenge adia o login até a troca da senha; as falhas do loginguard
+// só são zeradas quando o login for concluído
+func (s *authService) passwordChallenge(ctx context.Context, u model.User) (LoginResult, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return LoginResult{}, err
+	}
+	c := mfa.Challenge{UserID: u.ID, TenantID: u.TenantID, Username: u.Username, ChangePassword: true}
+	if err := s.challenges.Save(ctx, HashToken(token), c, challengeTTL); err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{PasswordChange: &PasswordChangeChallenge{Token: token, ExpiresIn: challengeTTL}}, nil
+}
+
+// allow consulta o loginguard e devolve TooManyAttemptsError durante espera ou bloqueio
+func (s *authService) allow(ctx context.Context, username, ip string) error {
+	wait, err := s.guard.Allow(ctx, username, ip)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &TooManyAttemptsError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (s *authService) revokeReused(ctx context.Context, familyID uuid.UUID) error {
+	if err := s.tokens.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// sessionIssuer emite os pares de tokens das sessões, qualquer que seja a forma de login
+type sessionIssuer struct {
+	issuer *auth.Tokens
+	tokens repository.RefreshTokenRepository
+}
+
+// issue emite um access token e um novo refresh token na família informada
+func (s sessionIssuer) issue(ctx context.Context, u model.User, familyID uuid.UUID, client model.ClientInfo) (TokenPair, error) {
+	access, err := s.issuer.IssueSubject(auth.Subject{
+		UserID:    u.ID.String(),
+		TenantID:  u.TenantID.String(),
+		SessionID: familyID.String(),
+		Roles:     u.Roles,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refresh, err := newOpaqueToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	t := model.RefreshToken{
+		FamilyID:  familyID,
+		UserID:    u.ID,
+		TokenHash: HashToken(refresh),
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: time.Now().Add(s.issuer.Config().RefreshTTL),
+	}
+	if err := s.tokens.Create(ctx, &t); err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: s.issuer.Config().AccessTTL}, nil
+}
+
+// tenantOf devolve a loja do contexto, ou uuid.Nil se não houver
+func tenantOf(ctx context.Context) uuid.UUID {
+	id, _ := tenant.FromContext(ctx)
+	return id
+}
+
+// newOpaqueToken gera 32 bytes aleatórios codificados em base64url
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken devolve o SHA-256 (hex) de um token opaco; tokens aleatórios dispensam bcrypt
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// FieldError descreve a rejeição de um campo específico da entrada
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// ValidationError indica uma entrada rejeitada pelas regras de negócio
+type ValidationError struct {
+	Resource string
+	Reason   string
+	Fields   []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Resource, e.Reason)
+}
+
+// TooManyAttemptsError indica que o login está temporariamente bloqueado
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return "too many failed login attempts, retry later"
+}
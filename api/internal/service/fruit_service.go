@@ -1,18 +1,31 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 )
 
 type FruitService interface {
 	ListFruits(ctx context.Context) ([]model.Fruit, error)
+	ListDeletedFruits(ctx context.Context) ([]model.Fruit, error)
 	GetFruit(ctx context.Context, id uuid.UUID) (model.Fruit, error)
 	CreateFruit(ctx context.Context, f *model.Fruit) error
 	UpdateFruit(ctx context.Context, f *model.Fruit) error
-	DeleteFruit(ctx context.Context, id uuid.UUID) error
+	// PatchFruit aplica um JSON Merge Patch sobre a versão informada da fruta
+	PatchFruit(ctx context.Context, id uuid.UUID, version int, patch []byte) (model.Fruit, error)
+	// DeleteFruit move a fruta para a lixeira registrando quem a removeu
+	DeleteFruit(ctx context.Context, id uuid.UUID, version int, deletedBy *uuid.UUID) error
+	RestoreFruit(ctx context.Context, id uuid.UUID) (model.Fruit, error)
+	// PurgeDeletedFruits remove definitivamente as frutas na lixeira há mais de retention
+	PurgeDeletedFruits(ctx context.Context, retention time.Duration) (int64, error)
 }
 
 type fruitService struct {
@@ -27,18 +40,97 @@ func (s *fruitService) ListFruits(ctx context.Context) ([]model.Fruit, error) {
 	return s.repo.GetAll(ctx)
 }
 
+func (s *fruitService) ListDeletedFruits(ctx context.Context) ([]model.Fruit, error) {
+	return s.repo.GetDeleted(ctx)
+}
+
 func (s *fruitService) GetFruit(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
 func (s *fruitService) CreateFruit(ctx context.Context, f *model.Fruit) error {
+	if err := validateFruit(f); err != nil {
+		return err
+	}
 	return s.repo.Create(ctx, f)
 }
 
 func (s *fruitService) UpdateFruit(ctx context.Context, f *model.Fruit) error {
+	if err := validateFruit(f); err != nil {
+		return err
+	}
 	return s.repo.Update(ctx, f)
 }
 
-func (s *fruitService) DeleteFruit(ctx context.Context, id uuid.UUID) error {
-	return s.repo.Delete(ctx, id)
+func (s *fruitService) PatchFruit(ctx context.Context, id uuid.UUID, version int, patch []byte) (model.Fruit, error) {
+	cur, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return cur, err
+	}
+	if cur.Version != version {
+		return cur, repository.ErrVersionConflict
+	}
+
+	doc, err := json.Marshal(model.FruitInput{Name: &cur.Name, Quantity: &cur.Quantity, Price: &cur.Price})
+	if err != nil {
+		return cur, err
+	}
+	merged, err := mergepatch.Apply(doc, patch)
+	if err != nil {
+		return cur, &ValidationError{Resource: "fruit", Reason: err.Error()}
+	}
+	var in model.FruitInput
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return cur, &ValidationError{Resource: "fruit", Reason: err.Error()}
+	}
+
+	f, err := FruitFromInput(in)
+	if err != nil {
+		return cur, err
+	}
+	f.ID, f.Version, f.CreatedAt = cur.ID, cur.Version, cur.CreatedAt
+	if err := validateFruit(&f); err != nil {
+		return cur, err
+	}
+	if err := s.repo.Update(ctx, &f); err != nil {
+		return cur, err
+	}
+	return f, nil
+}
+
+func (s *fruitService) DeleteFruit(ctx context.Context, id uuid.UUID, version int, deletedBy *uuid.UUID) error {
+	return s.repo.Delete(ctx, id, version, deletedBy)
+}
+
+func (s *fruitService) RestoreFruit(ctx context.Context, id uuid.UUID) (model.Fruit, error) {
+	return s.repo.Restore(ctx, id)
+}
+
+func (s *fruitService) PurgeDeletedFruits(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.Purge(ctx, time.Now().Add(-retention))
+}
+
+// FruitFromInput exige todos os campos graváveis, para que nenhum seja zerado por omissão
+func FruitFromInput(in model.FruitInput) (model.Fruit, error) {
+	var missing []string
+	var fields []FieldError
+	for _, f := range []struct {
+		name    string
+		present bool
+	}{{"name", in.Name != nil}, {"quantity", in.Quantity != nil}, {"price", in.Price != nil}} {
+		if !f.present {
+			missing = append(missing, f.name)
+			fields = append(fields, FieldError{Field: f.name, Message: "is required"})
+		}
+	}
+	if len(missing) > 0 {
+		return model.Fruit{}, &ValidationError{
+			Resource: "fruit",
+			Reason:   "missing fields: " + strings.Join(missing, ", "),
+			Fields:   fields,
+		}
+	}
+	return model.Fruit{Name: *in.Name, Quantity: *in.Quantity, Price: *in.Price}, nil
 }
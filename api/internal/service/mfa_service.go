@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mfa"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+)
+
+var (
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge")
+)
+
+// recoveryCodeCount é quantos códigos de recuperação são emitidos por vez
+const recoveryCodeCount = 10
+
+// Enrollment é o segredo TOTP recém-gerado, ainda pendente de confirmação
+type Enrollment struct {
+	Secret string
+	URI    string
+}
+
+// MFAService gerencia o TOTP do próprio usuário autenticado
+type MFAService interface {
+	// StartEnrollment gera um novo segredo; o cadastro só vale após ConfirmEnrollment
+	StartEnrollment(ctx context.Context, userID uuid.UUID) (Enrollment, error)
+	// ConfirmEnrollment ativa o TOTP com um código válido e devolve os códigos de recuperação
+	ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	// RegenerateRecoveryCodes invalida os códigos de recuperação atuais e emite novos
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+}
+
+type mfaService struct {
+	users repository.UserRepository
+	repo  repository.TOTPRepository
+}
+
+func NewMFAService(users repository.UserRepository, repo repository.TOTPRepository) MFAService {
+	return &mfaService{users: users, repo: repo}
+}
+
+// privilegedPermissions são as permissões que não podem ser usadas só com senha
+var privilegedPermissions = []string{model.PermUsersManage, model.PermFruitsWrite, model.PermTenantsManage}
+
+// mfaRequired é a política de segundo fator: quem tem alguma permissão privilegiada,
+// por qualquer papel, precisa de TOTP
+func mfaRequired(ctx context.Context, roles auth.PermissionResolver, u model.User) (bool, error) {
+	for _, perm := range privilegedPermissions {
+		ok, err := roles.HasPermission(ctx, u.Roles, perm)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (s *mfaService) StartEnrollment(ctx context.Context, userID uuid.UUID) (Enrollment, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	return s.begin(ctx, u)
+}
+
+func (s *mfaService) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	codes, err := s.confirm(ctx, userID, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		return nil, invalidCodeError()
+	}
+	return codes, err
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	t, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Enabled() {
+		return nil, repository.ErrTOTPNotFound
+	}
+	// só o autenticador serve aqui: um código de recuperação não pode gerar outros
+	if err := s.checkTOTP(ctx, t, code); errors.Is(err, ErrInvalidMFACode) {
+		return nil, invalidCodeError()
+	} else if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// begin grava um segredo pendente, substituindo um cadastro anterior não confirmado
+func (s *mfaService) begin(ctx context.Context, u model.User) (Enrollment, error) {
+	secret, err := mfa.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	if err := s.repo.SavePending(ctx, u.ID, secret); err != nil {
+		return Enrollment{}, err
+	}
+	return Enrollment{Secret: secret, URI: mfa.KeyURI(u.Username, secret)}, nil
+}
+
+// confirm ativa o cadastro pendente; devolve ErrInvalidMFACode se o código não confere
+func (s *mfaService) confirm(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	t, err := s.repo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled() {
+		return nil, repository.ErrTOTPAlreadyEnabled
+	}
+	step, ok := mfa.Validate(t.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(ctx, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verify aceita um código do autenticador ou um código de recuperação ainda não usado
+func (s *mfaService) verify(ctx context.Context, userID uuid.UUID, code string) error {
+	t, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+	if !t.Enabled() {
+		return ErrInvalidMFACode
+	}
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		return s.checkTOTP(ctx, t, code)
+	}
+	ok, err := s.repo.UseRecoveryCode(ctx, userID, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// checkTOTP valida o código e registra o passo, rejeitando a reutilização do mesmo código
+func (s *mfaService) checkTOTP(ctx context.Context, t model.TOTP, code string) error {
+	step, ok := mfa.Validate(t.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	fresh, err := s.repo.UseStep(ctx, t.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != mfa.Digits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes gera os códigos no formato xxxxx-xxxxx e seus hashes
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(enc.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode aceita o código com ou sem hífen e em qualquer caixa
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func invalidCodeError() error {
+	return &ValidationError{
+		Resource: "two-factor code",
+		Reason:   "code does not match",
+		Fields:   []FieldError{{Field: "code", Message: "does not match"}},
+	}
+}
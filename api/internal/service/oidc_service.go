@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/oidc"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+var (
+	// ErrUnknownProvider indica um provedor OIDC que não está configurado
+	ErrUnknownProvider = fmt.Errorf("oidc provider %w", repository.ErrNotFound)
+	// ErrInvalidOIDCState cobre state desconhecido, expirado, já usado ou de outro provedor
+	ErrInvalidOIDCState = errors.New("invalid or expired oidc login state")
+	// ErrOIDCLoginFailed indica que o provedor recusou o código ou devolveu um ID token inválido
+	ErrOIDCLoginFailed = errors.New("oidc login failed")
+	// ErrNoMappedRole indica um usuário do provedor sem nenhum grupo mapeado para papéis locais
+	ErrNoMappedRole = errors.New("no local role is mapped to the identity provider groups")
+)
+
+// oidcStateTTL é o prazo para o usuário concluir o login no provedor
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCService interface {
+	// Providers devolve os nomes dos provedores configurados, em ordem alfabética
+	Providers() []string
+	// Begin inicia o login no provedor e devolve o endereço de autorização
+	Begin(ctx context.Context, provider string) (string, error)
+	// Complete troca o código do callback pelo usuário local, criado no primeiro acesso, e
+	// conclui o login como o Login por senha: tokens ou o desafio do segundo fator
+	Complete(ctx context.Context, provider, state, code string, client model.ClientInfo) (LoginResult, error)
+}
+
+type oidcService struct {
+	providers  map[string]*oidc.Provider
+	states     oidc.StateStore
+	tenants    tenant.Resolver
+	users      repository.UserRepository
+	identities repository.IdentityRepository
+	logins     AuthService
+	denylist   auth.Denylist
+}
+
+func NewOIDCService(
+	providers []*oidc.Provider,
+	states oidc.StateStore,
+	tenants tenant.Resolver,
+	users repository.UserRepository,
+	identities repository.IdentityRepository,
+	logins AuthService,
+	denylist auth.Denylist,
+) OIDCService {
+	byName := make(map[string]*oidc.Provider, len(providers))
+	for _, p := range providers {
+		byName[p.Config().Name] = p
+	}
+	return &oidcService{
+		providers:  byName,
+		states:     states,
+		tenants:    tenants,
+		users:      users,
+		identities: identities,
+		logins:     logins,
+		denylist:   denylist,
+	}
+}
+
+func (s *oidcService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *oidcService) Begin(ctx context.Context, provider string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+	tid := tenant.Default
+	if slug := p.Config().Tenant; slug != "" {
+		var err error
+		if tid, err = s.tenants.ResolveTenant(ctx, slug); err != nil {
+			return "", fmt.Errorf("oidc provider %s: %w", provider, err)
+		}
+	}
+
+	st := oidc.LoginState{Provider: provider, TenantID: tid}
+	state, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if st.Nonce, err = newOpaqueToken(); err != nil {
+		return "", err
+	}
+	if st.Verifier, err = newOpaqueToken(); err != nil {
+		return "", err
+	}
+	if err := s.states.Save(ctx, HashToken(state), st, oidcStateTTL); err != nil {
+		return "", err
+	}
+	return p.AuthCodeURL(ctx, state, st.Nonce, st.Verifier)
+}
+
+func (s *oidcService) Complete(ctx context.Context, provider, state, code string, client model.ClientInfo) (LoginResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return LoginResult{}, ErrUnknownProvider
+	}
+	if state == "" || code == "" {
+		return LoginResult{}, ErrInvalidOIDCState
+	}
+	// o state só vale uma vez, mesmo que a troca do código falhe
+	st, ok, err := s.states.Take(ctx, HashToken(state))
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !ok || st.Provider != provider || st.TenantID == uuid.Nil {
+		return LoginResult{}, ErrInvalidOIDCState
+	}
+	id, err := p.Exchange(ctx, code, st.Verifier, st.Nonce)
+	if err != nil {
+		log.Printf("oidc login with %s failed: %v", provider, err)
+		return LoginResult{}, ErrOIDCLoginFailed
+	}
+	roles := p.Config().MapRoles(id.Groups)
+	if len(roles) == 0 {
+		return LoginResult{}, ErrNoMappedRole
+	}
+
+	ctx = tenant.WithID(ctx, st.TenantID)
+	var u model.User
+	userID, err := s.identities.UserID(ctx, provider, id.Subject)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		u, err = s.provision(ctx, provider, id, roles)
+	case err == nil:
+		u, err = s.syncRoles(ctx, userID, roles)
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return s.logins.CompleteLogin(ctx, u, client)
+}
+
+// provision cria o usuário local no primeiro login (just-in-time), sem senha: ele só
+// entra pelo provedor até que alguém defina uma. Um username já usado não é vinculado
+// automaticamente, pois isso entregaria a conta local a quem controla o provedor.
+func (s *oidcService) provision(ctx context.Context, provider string, id oidc.Identity, roles []string) (model.User, error) {
+	u := model.User{Username: oidcUsername(id), DisplayName: id.Name, Roles: roles}
+	v := newValidator("user")
+	checkUsername(v, u.Username)
+	if err := v.err(); err != nil {
+		return model.User{}, err
+	}
+	if utf8.RuneCountInString(u.DisplayName) > maxDisplayNameLen {
+		u.DisplayName = string([]rune(u.DisplayName)[:maxDisplayNameLen])
+	}
+	if addr, err := mail.ParseAddress(id.Email); err == nil && addr.Address == id.Email && len(id.Email) <= maxEmailLen {
+		u.Email = id.Email
+	}
+	if err := s.identities.Provision(ctx, &u, provider, id.Subject); err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+// syncRoles aplica ao usuário já vinculado os papéis vindos dos grupos do provedor. Os
+// access tokens carregam os papéis, então os já emitidos são negados quando eles mudam.
+func (s *oidcService) syncRoles(ctx context.Context, userID uuid.UUID, roles []string) (model.User, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	if u.Disabled() {
+		return model.User{}, ErrUserDisabled
+	}
+	want := slices.Clone(roles)
+	slices.Sort(want)
+	have := slices.Clone(u.Roles)
+	slices.Sort(have)
+	if slices.Equal(want, have) {
+		return u, nil
+	}
+	u.Roles = want
+	if err := s.users.Update(ctx, &u); err != nil {
+		return model.User{}, err
+	}
+	if err := s.denylist.RevokeUser(ctx, u.ID.String(), time.Now()); err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+var usernameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// oidcUsername deriva o username do preferred_username ou da parte local do e-mail
+func oidcUsername(id oidc.Identity) string {
+	name := id.Username
+	if name == "" {
+		name, _, _ = strings.Cut(id.Email, "@")
+	}
+	name = usernameUnsafe.ReplaceAllString(name, "_")
+	return strings.TrimLeft(name, "._-")
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/event"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/publisher"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+)
+
+const (
+	// outboxLease é por quanto tempo os eventos reservados ficam fora das outras instâncias
+	outboxLease = 30 * time.Second
+	// outboxMaxBackoff limita a espera entre as tentativas de um evento que continua falhando
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+type OutboxService interface {
+	// Relay publica, em ordem, até limit eventos pendentes e devolve quantos foram enviados.
+	// Na primeira falha o evento e os seguintes do lote são reagendados juntos; os eventos
+	// do mesmo usuário fora do lote esperam o reagendado (ver OutboxRepository.Claim).
+	Relay(ctx context.Context, limit int) (int, error)
+	// PurgeSent remove os eventos publicados há mais tempo que retention
+	PurgeSent(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+type outboxService struct {
+	repo repository.OutboxRepository
+	pub  publisher.EventPublisher
+}
+
+func NewOutboxService(repo repository.OutboxRepository, pub publisher.EventPublisher) OutboxService {
+	return &outboxService{repo: repo, pub: pub}
+}
+
+func (s *outboxService) Relay(ctx context.Context, limit int) (int, error) {
+	events, err := s.repo.Claim(ctx, limit, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+	for i, e := range events {
+		perr := s.pub.Publish(envelope(e))
+		if perr == nil {
+			if err := s.repo.MarkSent(ctx, e.ID); err != nil {
+				return i, err
+			}
+			continue
+		}
+
+		at := time.Now().Add(outboxBackoff(e.Attempts))
+		if err := s.repo.Fail(ctx, e.ID, at, perr.Error()); err != nil {
+			return i, err
+		}
+		rest := make([]int64, 0, len(events)-i-1)
+		for _, later := range events[i+1:] {
+			rest = append(rest, later.ID)
+		}
+		if err := s.repo.Postpone(ctx, rest, at); err != nil {
+			return i, err
+		}
+		return i, perr
+	}
+	return len(events), nil
+}
+
+func (s *outboxService) PurgeSent(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.repo.PurgeSent(ctx, time.Now().Add(-retention))
+}
+
+// envelope monta o evento publicado a partir da linha da outbox
+func envelope(e model.OutboxEvent) event.Envelope {
+	return event.Envelope{
+		ID:            e.EventID,
+		Type:          event.TypeOf(e.Action),
+		SchemaVersion: event.SchemaVersion,
+		OccurredAt:    e.CreatedAt,
+		Producer:      event.Producer,
+		CorrelationID: e.CorrelationID,
+		Actor:         e.Actor,
+		TenantID:      e.TenantID,
+		Action:        e.Action,
+		Data:          e.Payload,
+	}
+}
+
+// outboxBackoff dobra a espera a cada falha, começando em 1s e parando em outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	d := time.Second
+	for i := 0; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, outboxMaxBackoff)
+}
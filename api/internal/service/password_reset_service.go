@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/loginguard"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/notify"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// ErrInvalidResetToken cobre token desconhecido, expirado ou já usado
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// passwordResetTTL é a validade de um token de redefinição de senha
+const passwordResetTTL = 30 * time.Minute
+
+// forgotTimeout limita a emissão e o envio de cada token em segundo plano
+const forgotTimeout = 30 * time.Second
+
+type PasswordResetService interface {
+	// Forgot grava o pedido, cujo token é emitido e enviado depois pelo PasswordResetSender.
+	// Acima do limite por IP devolve TooManyAttemptsError; acima do limite por username o
+	// pedido é descartado em silêncio. A resposta não depende da existência do username nem
+	// do envio, para não revelar quais contas existem.
+	Forgot(ctx context.Context, username, ip string) error
+	// Reset troca a senha com um token válido e encerra todas as sessões do usuário
+	Reset(ctx context.Context, token, password string) error
+}
+
+// PasswordResetSender atende, fora da requisição, os pedidos gravados por Forgot
+type PasswordResetSender interface {
+	// SendPending emite e envia os tokens de até limit pedidos, em ordem, e devolve quantos
+	// pedidos atendeu. Um pedido que falha não é repetido: o usuário pode pedir de novo.
+	SendPending(ctx context.Context, limit int) (int, error)
+}
+
+type passwordResetService struct {
+	users    repository.UserRepository
+	resets   repository.PasswordResetRepository
+	tokens   repository.RefreshTokenRepository
+	denylist auth.Denylist
+	policy   password.Policy
+	limiter  *loginguard.Limiter
+}
+
+func NewPasswordResetService(
+	users repository.UserRepository,
+	resets repository.PasswordResetRepository,
+	tokens repository.RefreshTokenRepository,
+	denylist auth.Denylist,
+	policy password.Policy,
+	limiter *loginguard.Limiter,
+) PasswordResetService {
+	return &passwordResetService{
+		users:    users,
+		resets:   resets,
+		tokens:   tokens,
+		denylist: denylist,
+		policy:   policy,
+		limiter:  limiter,
+	}
+}
+
+func (s *passwordResetService) Forgot(ctx context.Context, username, ip string) error {
+	wait, userOK, err := s.limiter.Allow(ctx, username, ip)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &TooManyAttemptsError{RetryAfter: wait}
+	}
+	// acima do limite do username o pedido é descartado sem aviso: um 429 deixaria
+	// qualquer um que saiba o username bloquear a redefinição da conta
+	if !userOK {
+		return nil
+	}
+	return s.resets.Request(ctx, strings.TrimSpace(username))
+}
+
+type passwordResetSender struct {
+	users    repository.UserRepository
+	resets   repository.PasswordResetRepository
+	notifier notify.Notifier
+}
+
+func NewPasswordResetSender(
+	users repository.UserRepository,
+	resets repository.PasswordResetRepository,
+	notifier notify.Notifier,
+) PasswordResetSender {
+	return &passwordResetSender{users: users, resets: resets, notifier: notifier}
+}
+
+func (s *passwordResetSender) SendPending(ctx context.Context, limit int) (int, error) {
+	requests, err := s.resets.ClaimRequests(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, req := range requests {
+		issueCtx, cancel := context.WithTimeout(tenant.WithID(ctx, req.TenantID), forgotTimeout)
+		if err := s.issue(issueCtx, req.Username); err != nil {
+			log.Printf("password reset: %v", err)
+		}
+		cancel()
+	}
+	return len(requests), nil
+}
+
+// issue grava um token novo, que substitui o anterior, e o envia ao usuário
+func (s *passwordResetSender) issue(ctx context.Context, username string) error {
+	u, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().Add(passwordResetTTL)
+	if err := s.resets.Create(ctx, u.ID, HashToken(token), expiresAt); err != nil {
+		return err
+	}
+	// sem e-mail cadastrado em /me, o destinatário é o próprio username
+	to := u.Username
+	if u.Email != "" {
+		to = u.Email
+	}
+	msg := notify.Message{
+		To:      to,
+		Subject: "Redefinição de senha",
+		Body: fmt.Sprintf("Use o token abaixo em POST /auth/password/reset até %s:\n\n%s\n\n"+
+			"Se você não pediu a redefinição, ignore esta mensagem.",
+			expiresAt.UTC().Format(time.RFC3339), token),
+		Secrets: []string{token},
+	}
+	if err := s.notifier.Notify(ctx, msg); err != nil {
+		// o erro vai para o log, que não pode levar o token
+		return fmt.Errorf("notify to=%s: %w\n%s", msg.To, err, msg.Redacted())
+	}
+	return nil
+}
+
+func (s *passwordResetService) Reset(ctx context.Context, token, pw string) error {
+	tokenHash := HashToken(strings.TrimSpace(token))
+	owner, tid, err := s.resets.Owner(ctx, tokenHash, time.Now())
+	if errors.Is(err, repository.ErrResetTokenNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	// a rota de reset é pública: a loja vem do próprio token
+	ctx = tenant.WithID(ctx, tid)
+	u, err := s.users.GetByID(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if err := validateNewPassword(ctx, s.policy, pw, u.Username); err != nil {
+		return err
+	}
+	hash, err := s.policy.Hash(pw)
+	if err != nil {
+		return err
+	}
+	userID, err := s.resets.Consume(ctx, tokenHash, hash, time.Now())
+	if errors.Is(err, repository.ErrResetTokenNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	// quem tinha a senha antiga perde o acesso: refresh tokens e access tokens já emitidos
+	if err := s.tokens.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.denylist.RevokeUser(ctx, userID.String(), time.Now())
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// ErrProtectedRole impede alterações que deixariam a API sem administradores
+var ErrProtectedRole = errors.New("role admin cannot be deleted or lose users:manage")
+
+// permissionCacheTTL limita quanto tempo uma instância leva para enxergar
+// alterações de permissões feitas por outra
+const permissionCacheTTL = 30 * time.Second
+
+type RoleService interface {
+	ListPermissions(ctx context.Context) ([]model.Permission, error)
+	ListRoles(ctx context.Context) ([]model.Role, error)
+	GetRole(ctx context.Context, name string) (model.Role, error)
+	CreateRole(ctx context.Context, in model.RoleInput) (model.Role, error)
+	// UpdateRole altera a descrição e substitui as permissões do papel name
+	UpdateRole(ctx context.Context, name string, in model.RoleInput) (model.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+	// HasPermission informa se algum dos papéis concede perm (auth.PermissionResolver)
+	HasPermission(ctx context.Context, roles []string, perm string) (bool, error)
+}
+
+type roleService struct {
+	repo repository.RoleRepository
+
+	mu    sync.Mutex
+	cache map[string]cachedPermissions
+}
+
+type cachedPermissions struct {
+	perms   map[string]bool
+	expires time.Time
+}
+
+func NewRoleService(repo repository.RoleRepository) RoleService {
+	return &roleService{repo: repo, cache: map[string]cachedPermissions{}}
+}
+
+func (s *roleService) ListPermissions(ctx context.Context) ([]model.Permission, error) {
+	return s.repo.ListPermissions(ctx)
+}
+
+func (s *roleService) ListRoles(ctx context.Context) ([]model.Role, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *roleService) GetRole(ctx context.Context, name string) (model.Role, error) {
+	return s.repo.Get(ctx, name)
+}
+
+func (s *roleService) CreateRole(ctx context.Context, in model.RoleInput) (model.Role, error) {
+	role := roleFromInput(in)
+	if err := validateRole(role); err != nil {
+		return model.Role{}, err
+	}
+	if err := s.repo.Create(ctx, &role); err != nil {
+		return model.Role{}, err
+	}
+	return role, nil
+}
+
+func (s *roleService) UpdateRole(ctx context.Context, name string, in model.RoleInput) (model.Role, error) {
+	in.Name = name
+	role := roleFromInput(in)
+	if err := validateRole(role); err != nil {
+		return model.Role{}, err
+	}
+	if role.Name == model.RoleAdmin && !contains(role.Permissions, model.PermUsersManage) {
+		return model.Role{}, ErrProtectedRole
+	}
+	if err := s.repo.Update(ctx, &role); err != nil {
+		return model.Role{}, err
+	}
+	s.invalidate()
+	return role, nil
+}
+
+func (s *roleService) DeleteRole(ctx context.Context, name string) error {
+	if name == model.RoleAdmin {
+		return ErrProtectedRole
+	}
+	if err := s.repo.Delete(ctx, name); err != nil {
+		return err
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *roleService) HasPermission(ctx context.Context, roles []string, perm string) (bool, error) {
+	// os papéis de cada loja têm permissões próprias
+	tid, _ := tenant.FromContext(ctx)
+	key := tid.String() + ":" + strings.Join(normalizeNames(roles), ",")
+	now := time.Now()
+
+	s.mu.Lock()
+	c, ok := s.cache[key]
+	s.mu.Unlock()
+	if !ok || now.After(c.expires) {
+		list, err := s.repo.PermissionsOf(ctx, roles)
+		if err != nil {
+			return false, err
+		}
+		c = cachedPermissions{perms: map[string]bool{}, expires: now.Add(permissionCacheTTL)}
+		for _, p := range list {
+			c.perms[p] = true
+		}
+		s.mu.Lock()
+		s.cache[key] = c
+		s.mu.Unlock()
+	}
+	return c.perms[perm], nil
+}
+
+func (s *roleService) invalidate() {
+	s.mu.Lock()
+	s.cache = map[string]cachedPermissions{}
+	s.mu.Unlock()
+}
+
+func roleFromInput(in model.RoleInput) model.Role {
+	return model.Role{
+		Name:        strings.TrimSpace(in.Name),
+		Description: strings.TrimSpace(in.Description),
+		Permissions: normalizeNames(in.Permissions),
+	}
+}
+
+// normalizeNames ordena e remove duplicatas, garantindo uma lista não nula
+func normalizeNames(names []string) []string {
+	out := make([]string, 0, len(names))
+	seen := map[string]bool{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
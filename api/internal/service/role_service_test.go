@@ -0,0 +1,44 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// tenantRolesRepo responde as permissões do papel user conforme a loja do contexto
+type tenantRolesRepo struct {
+	repository.RoleRepository
+	perms map[uuid.UUID][]string
+}
+
+func (r tenantRolesRepo) PermissionsOf(ctx context.Context, roles []string) ([]string, error) {
+	tid, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.perms[tid], nil
+}
+
+func TestHasPermission_PerTenant(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	svc := service.NewRoleService(tenantRolesRepo{perms: map[uuid.UUID][]string{
+		a: {model.PermFruitsRead, model.PermFruitsWrite},
+		b: {model.PermFruitsRead},
+	}})
+	roles := []string{model.RoleUser}
+
+	// a consulta da loja a não pode ficar no cache como resposta da loja b
+	if ok, err := svc.HasPermission(tenant.WithID(context.Background(), a), roles, model.PermFruitsWrite); err != nil || !ok {
+		t.Fatalf("loja a: esperado true, recebeu %v, %v", ok, err)
+	}
+	if ok, err := svc.HasPermission(tenant.WithID(context.Background(), b), roles, model.PermFruitsWrite); err != nil || ok {
+		t.Fatalf("loja b: esperado false, recebeu %v, %v", ok, err)
+	}
+}
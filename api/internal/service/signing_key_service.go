@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+)
+
+// KeyPublishLead é a antecedência com que uma chave nova aparece no JWKS antes de
+// assinar tokens; precisa superar o cache do JWKS e o intervalo de recarga das instâncias
+const KeyPublishLead = 3 * auth.JWKSMaxAge
+
+// SigningKeyService mantém as chaves de assinatura de JWT: cria, rotaciona, descarta
+// as aposentadas e carrega as vigentes no KeySet desta instância
+type SigningKeyService interface {
+	Refresh(ctx context.Context) error
+}
+
+type signingKeyService struct {
+	repo     repository.SigningKeyRepository
+	tokens   *auth.Tokens
+	rotation time.Duration
+}
+
+// NewSigningKeyService cria as chaves com o algoritmo de tokens.Config() e as carrega em tokens.Keys()
+func NewSigningKeyService(repo repository.SigningKeyRepository, tokens *auth.Tokens, rotation time.Duration) SigningKeyService {
+	return &signingKeyService{repo: repo, tokens: tokens, rotation: rotation}
+}
+
+func (s *signingKeyService) Refresh(ctx context.Context) error {
+	now := time.Now()
+	stored, err := s.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	// a primeira chave assina imediatamente; as seguintes esperam KeyPublishLead
+	var since, activates time.Time
+	rotate := len(stored) == 0
+	if rotate {
+		activates = now
+	} else if newest := stored[len(stored)-1]; newest.CreatedAt.Before(now.Add(-s.rotation)) {
+		rotate, since, activates = true, now.Add(-s.rotation), now.Add(KeyPublishLead)
+	}
+	if rotate {
+		created, err := s.create(ctx, since, activates)
+		if err != nil {
+			return err
+		}
+		if created {
+			if stored, err = s.repo.List(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]auth.Key, 0, len(stored))
+	for i, k := range stored {
+		if retired(stored, i, now, s.tokens.Config().AccessTTL) {
+			if err := s.repo.Delete(ctx, k.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		parsed, err := auth.ParseKey(k.ID, k.Algorithm, k.PrivateKey, k.ActivatesAt)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, parsed)
+	}
+	return s.tokens.Keys().Load(keys)
+}
+
+func (s *signingKeyService) create(ctx context.Context, since, activates time.Time) (bool, error) {
+	k, err := auth.GenerateKey(s.tokens.Config().Algorithm, activates)
+	if err != nil {
+		return false, err
+	}
+	pem, err := auth.MarshalPrivateKey(k)
+	if err != nil {
+		return false, err
+	}
+	return s.repo.CreateUnlessNewer(ctx, model.SigningKey{
+		ID:          k.ID,
+		Algorithm:   k.Algorithm,
+		PrivateKey:  pem,
+		CreatedAt:   time.Now(),
+		ActivatesAt: activates,
+	}, since)
+}
+
+// retired informa se a chave i já foi substituída há tempo suficiente para que
+// todos os tokens assinados com ela tenham expirado
+func retired(keys []model.SigningKey, i int, now time.Time, accessTTL time.Duration) bool {
+	if i+1 >= len(keys) {
+		return false
+	}
+	successor := keys[i+1].ActivatesAt
+	return now.After(successor.Add(accessTTL + time.Minute))
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// tenantAdminRole é o papel do primeiro usuário de uma loja nova
+const tenantAdminRole = "admin"
+
+type TenantService interface {
+	// CreateTenant cria a loja e o seu primeiro administrador, devolvido na resposta
+	CreateTenant(ctx context.Context, in model.TenantInput) (model.Tenant, model.User, error)
+	ListTenants(ctx context.Context) ([]model.Tenant, error)
+}
+
+type tenantService struct {
+	repo   repository.TenantRepository
+	users  repository.UserRepository
+	policy password.Policy
+}
+
+func NewTenantService(repo repository.TenantRepository, users repository.UserRepository, policy password.Policy) TenantService {
+	return &tenantService{repo: repo, users: users, policy: policy}
+}
+
+func (s *tenantService) CreateTenant(ctx context.Context, in model.TenantInput) (model.Tenant, model.User, error) {
+	in.Slug, in.Name = strings.ToLower(strings.TrimSpace(in.Slug)), strings.TrimSpace(in.Name)
+	// valida tudo antes de gravar, para não deixar uma loja sem administrador
+	if err := validateTenant(ctx, s.policy, in); err != nil {
+		return model.Tenant{}, model.User{}, err
+	}
+	hash, err := s.policy.Hash(in.AdminPassword)
+	if err != nil {
+		return model.Tenant{}, model.User{}, err
+	}
+	t := model.Tenant{Slug: in.Slug, Name: in.Name}
+	if err := s.repo.Create(ctx, &t); err != nil {
+		return model.Tenant{}, model.User{}, err
+	}
+	admin := model.User{Username: in.AdminUsername, PasswordHash: hash, Roles: []string{tenantAdminRole}}
+	if err := s.users.Create(tenant.WithID(ctx, t.ID), &admin); err != nil {
+		if derr := s.repo.Delete(ctx, t.ID); derr != nil {
+			log.Printf("tenant %s left without admin: %v", t.Slug, derr)
+		}
+		return model.Tenant{}, model.User{}, err
+	}
+	return t, admin, nil
+}
+
+func (s *tenantService) ListTenants(ctx context.Context) ([]model.Tenant, error) {
+	return s.repo.List(ctx)
+}
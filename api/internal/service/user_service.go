@@ -1,45 +1,291 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/auth"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/mergepatch"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
 	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUserDisabled só é devolvido a quem acertou a senha de uma conta desativada
+	ErrUserDisabled = errors.New("user account is disabled")
+	// ErrSelfLockout impede que um administrador desative ou remova a própria conta,
+	// ou tire de si mesmo o papel admin
+	ErrSelfLockout = errors.New("cannot disable, delete or remove the admin role from your own account")
+	// ErrLastAdmin impede que a loja fique sem nenhum administrador ativo
+	ErrLastAdmin = errors.New("cannot remove the last active admin")
+)
+
+// dummyHashes guarda, por custo, o hash comparado quando o usuário não existe, para que o
+// tempo de resposta não revele quais usernames são válidos
+var dummyHashes sync.Map
+
+// dummyHash gera no primeiro uso o hash com o custo da política, igual ao dos hashes reais
+func dummyHash(policy password.Policy) []byte {
+	if h, ok := dummyHashes.Load(policy.Cost); ok {
+		return h.([]byte)
+	}
+	h, _ := policy.Hash("dummy-password")
+	actual, _ := dummyHashes.LoadOrStore(policy.Cost, []byte(h))
+	return actual.([]byte)
+}
 
 type UserService interface {
-	CreateUser(ctx context.Context, u *model.User) error
-	GetAllUsers() ([]model.User, error)
+	// CreateUser valida a entrada contra a política de senhas, gera o hash e persiste o usuário
+	CreateUser(ctx context.Context, in model.NewUser) (model.User, error)
+	// ListUsers devolve uma página de usuários e o total do filtro; Limit zero usa o padrão
+	ListUsers(ctx context.Context, f model.UserFilter) (model.UserPage, error)
+	GetUser(ctx context.Context, id uuid.UUID) (model.User, error)
+	// UpdateUser substitui username, papéis e estado da conta; actor é quem altera
+	UpdateUser(ctx context.Context, actor, id uuid.UUID, in model.UserInput) (model.User, error)
+	// PatchUser aplica um JSON Merge Patch sobre o model.UserInput atual do usuário
+	PatchUser(ctx context.Context, actor, id uuid.UUID, patch []byte) (model.User, error)
+	// SetRoles substitui os papéis do usuário
+	SetRoles(ctx context.Context, actor, id uuid.UUID, roles []string) (model.User, error)
+	// SetDisabled desativa ou reativa a conta
+	SetDisabled(ctx context.Context, actor, id uuid.UUID, disabled bool) (model.User, error)
+	// DeleteUser remove o usuário; actor é quem remove
+	DeleteUser(ctx context.Context, actor, id uuid.UUID) error
+	// Authenticate confere a senha e refaz o hash se ele usar um custo menor que o da política
 	Authenticate(ctx context.Context, username, password string) (model.User, error)
 }
 
 type userService struct {
-	repo repository.UserRepository
+	repo     repository.UserRepository
+	tokens   repository.RefreshTokenRepository
+	denylist auth.Denylist
+	policy   password.Policy
+}
+
+func NewUserService(r repository.UserRepository, tokens repository.RefreshTokenRepository, denylist auth.Denylist, policy password.Policy) UserService {
+	return &userService{repo: r, tokens: tokens, denylist: denylist, policy: policy}
+}
+
+func (s *userService) CreateUser(ctx context.Context, in model.NewUser) (model.User, error) {
+	if len(in.Roles) == 0 && in.Role != "" {
+		in.Roles = []string{in.Role}
+	}
+	in.Roles = normalizeNames(in.Roles)
+	if err := validateNewUser(ctx, s.policy, in); err != nil {
+		return model.User{}, err
+	}
+	hash, err := s.policy.Hash(in.Password)
+	if err != nil {
+		return model.User{}, err
+	}
+	u := model.User{
+		Username:     in.Username,
+		PasswordHash: hash,
+		Roles:        in.Roles,
+	}
+	if err := s.repo.Create(ctx, &u); err != nil {
+		return model.User{}, err
+	}
+	return u, nil
 }
 
-func NewUserService(r repository.UserRepository) UserService {
-	return &userService{repo: r}
+func (s *userService) ListUsers(ctx context.Context, f model.UserFilter) (model.UserPage, error) {
+	f.Query, f.Role = strings.TrimSpace(f.Query), strings.TrimSpace(f.Role)
+	if f.Limit == 0 {
+		f.Limit = defaultUserPageSize
+	}
+	if err := validateUserFilter(f); err != nil {
+		return model.UserPage{}, err
+	}
+	users, total, err := s.repo.List(ctx, f)
+	if err != nil {
+		return model.UserPage{}, err
+	}
+	return model.UserPage{Users: users, Total: total, Limit: f.Limit, Offset: f.Offset}, nil
 }
 
-func (s *userService) CreateUser(ctx context.Context, u *model.User) error {
-	return s.repo.Create(ctx, u)
+func (s *userService) GetUser(ctx context.Context, id uuid.UUID) (model.User, error) {
+	return s.repo.GetByID(ctx, id)
 }
 
-func (s *userService) GetAllUsers() ([]model.User, error) {
-	return s.repo.GetAll(context.Background())
+func (s *userService) UpdateUser(ctx context.Context, actor, id uuid.UUID, in model.UserInput) (model.User, error) {
+	cur, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return cur, err
+	}
+	return s.apply(ctx, actor, cur, in)
+}
+
+func (s *userService) PatchUser(ctx context.Context, actor, id uuid.UUID, patch []byte) (model.User, error) {
+	cur, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return cur, err
+	}
+	doc, err := json.Marshal(userInput(cur))
+	if err != nil {
+		return cur, err
+	}
+	merged, err := mergepatch.Apply(doc, patch)
+	if err != nil {
+		return cur, &ValidationError{Resource: "user", Reason: err.Error()}
+	}
+	var in model.UserInput
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return cur, &ValidationError{Resource: "user", Reason: err.Error()}
+	}
+	return s.apply(ctx, actor, cur, in)
+}
+
+func (s *userService) SetRoles(ctx context.Context, actor, id uuid.UUID, roles []string) (model.User, error) {
+	cur, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return cur, err
+	}
+	in := userInput(cur)
+	in.Roles = roles
+	return s.apply(ctx, actor, cur, in)
+}
+
+func (s *userService) SetDisabled(ctx context.Context, actor, id uuid.UUID, disabled bool) (model.User, error) {
+	cur, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return cur, err
+	}
+	in := userInput(cur)
+	in.Disabled = &disabled
+	return s.apply(ctx, actor, cur, in)
+}
+
+func (s *userService) DeleteUser(ctx context.Context, actor, id uuid.UUID) error {
+	if actor == id {
+		return ErrSelfLockout
+	}
+	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.keepAnAdmin(ctx, u); err != nil {
+		return err
+	}
+	// os refresh tokens saem em cascata; os access tokens emitidos são negados até expirarem
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.denylist.RevokeUser(ctx, id.String(), time.Now())
+}
+
+// apply grava in sobre cur. Os access tokens carregam os papéis, então são negados
+// quando eles mudam; desativar a conta encerra também as sessões.
+func (s *userService) apply(ctx context.Context, actor uuid.UUID, cur model.User, in model.UserInput) (model.User, error) {
+	in.Username = strings.TrimSpace(in.Username)
+	in.Roles = normalizeNames(in.Roles)
+	if err := validateUserInput(in); err != nil {
+		return cur, err
+	}
+	// sem disabled no corpo, a conta fica como está
+	disabled := cur.Disabled()
+	if in.Disabled != nil {
+		disabled = *in.Disabled
+	}
+
+	u := cur
+	u.Username, u.Roles = in.Username, in.Roles
+	if actor == cur.ID && (disabled || cur.HasRole(model.RoleAdmin) && !u.HasRole(model.RoleAdmin)) {
+		return cur, ErrSelfLockout
+	}
+	disabling := disabled && !cur.Disabled()
+	if disabling || !u.HasRole(model.RoleAdmin) {
+		if err := s.keepAnAdmin(ctx, cur); err != nil {
+			return cur, err
+		}
+	}
+	if disabling {
+		now := time.Now()
+		u.DisabledAt = &now
+	} else if !disabled {
+		u.DisabledAt = nil
+	}
+	if err := s.repo.Update(ctx, &u); err != nil {
+		return cur, err
+	}
+
+	if disabling {
+		if err := s.tokens.RevokeAllForUser(ctx, u.ID); err != nil {
+			return u, err
+		}
+	}
+	if disabling || strings.Join(u.Roles, ",") != strings.Join(normalizeNames(cur.Roles), ",") {
+		if err := s.denylist.RevokeUser(ctx, u.ID.String(), time.Now()); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// keepAnAdmin recusa desativar, remover ou tirar o papel admin de u se ele for
+// o último administrador ativo da loja
+func (s *userService) keepAnAdmin(ctx context.Context, u model.User) error {
+	if !u.HasRole(model.RoleAdmin) || u.Disabled() {
+		return nil
+	}
+	n, err := s.repo.CountActiveWithRole(ctx, model.RoleAdmin, u.ID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// userInput devolve os campos alteráveis de u
+func userInput(u model.User) model.UserInput {
+	disabled := u.Disabled()
+	return model.UserInput{Username: u.Username, Roles: u.Roles, Disabled: &disabled}
 }
 
 func (s *userService) Authenticate(ctx context.Context, username, password string) (model.User, error) {
 	u, err := s.repo.GetByUsername(ctx, username)
-	if err != nil {
+	if errors.Is(err, repository.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash(s.policy), []byte(password))
 		return u, ErrInvalidCredentials
 	}
+	if err != nil {
+		return u, err
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
 		return u, ErrInvalidCredentials
 	}
+	if u.Disabled() {
+		return u, ErrUserDisabled
+	}
+	if s.policy.NeedsRehash(u.PasswordHash) {
+		s.rehash(ctx, &u, password)
+	}
 	return u, nil
 }
+
+// rehash regrava a senha com o custo atual; uma falha não impede o login,
+// que tenta de novo na próxima vez
+func (s *userService) rehash(ctx context.Context, u *model.User, password string) {
+	hash, err := s.policy.Hash(password)
+	if err == nil {
+		err = s.repo.UpdatePassword(ctx, u.ID, hash, u.MustChangePassword)
+	}
+	if err != nil {
+		log.Printf("rehash password of user %s: %v", u.ID, err)
+		return
+	}
+	u.PasswordHash = hash
+}
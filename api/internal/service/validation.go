@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/password"
+)
+
+// Limites das regras de validação
+const (
+	maxFruitNameLen = 100
+	maxQuantity     = 1_000_000
+	// maxPrice respeita a coluna NUMERIC(10,2)
+	maxPrice          = 99_999_999.99
+	maxDescriptionLen = 200
+	maxAPIKeyNameLen  = 100
+	maxDisplayNameLen = 100
+	maxEmailLen       = 254
+	maxTenantNameLen  = 100
+	// defaultUserPageSize e maxUserPageSize limitam as páginas de GET /users
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{2,31}$`)
+	roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+	slugPattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,31}$`)
+)
+
+// validator acumula os erros de campo de uma entrada
+type validator struct {
+	resource string
+	fields   []FieldError
+}
+
+func newValidator(resource string) *validator {
+	return &validator{resource: resource}
+}
+
+// check registra message para field quando ok é falso
+func (v *validator) check(ok bool, field, message string) {
+	if !ok {
+		v.fields = append(v.fields, FieldError{Field: field, Message: message})
+	}
+}
+
+// err devolve um *ValidationError com todos os campos rejeitados, ou nil
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(v.fields))
+	for _, f := range v.fields {
+		names = append(names, f.Field)
+	}
+	return &ValidationError{
+		Resource: v.resource,
+		Reason:   "invalid fields: " + strings.Join(names, ", "),
+		Fields:   v.fields,
+	}
+}
+
+// validateFruit normaliza o nome e aplica as regras de negócio de uma fruta
+func validateFruit(f *model.Fruit) error {
+	f.Name = strings.TrimSpace(f.Name)
+
+	v := newValidator("fruit")
+	v.check(f.Name != "", "name", "is required")
+	v.check(utf8.RuneCountInString(f.Name) <= maxFruitNameLen, "name",
+		fmt.Sprintf("must have at most %d characters", maxFruitNameLen))
+	v.check(f.Quantity >= 0, "quantity", "must not be negative")
+	v.check(f.Quantity <= maxQuantity, "quantity", fmt.Sprintf("must be at most %d", maxQuantity))
+	v.check(f.Price >= 0, "price", "must not be negative")
+	v.check(f.Price <= maxPrice, "price", fmt.Sprintf("must be at most %.2f", maxPrice))
+	return v.err()
+}
+
+// validateNewUser aplica as regras de formato de username, a política de senhas
+// e as regras dos papéis; a existência dos papéis é garantida pelo banco
+func validateNewUser(ctx context.Context, policy password.Policy, in model.NewUser) error {
+	v := newValidator("user")
+	checkUsername(v, in.Username)
+	if err := checkPassword(ctx, v, "password", policy, in.Password, in.Username); err != nil {
+		return err
+	}
+	checkRoleNames(v, in.Roles)
+	return v.err()
+}
+
+// validateUserInput aplica as regras de username e papéis na alteração de um usuário
+func validateUserInput(in model.UserInput) error {
+	v := newValidator("user")
+	checkUsername(v, in.Username)
+	checkRoleNames(v, in.Roles)
+	return v.err()
+}
+
+func validateUserFilter(f model.UserFilter) error {
+	v := newValidator("user filter")
+	v.check(f.Limit >= 1 && f.Limit <= maxUserPageSize, "limit",
+		fmt.Sprintf("must be between 1 and %d", maxUserPageSize))
+	v.check(f.Offset >= 0, "offset", "must not be negative")
+	return v.err()
+}
+
+// validateProfile aplica as regras dos campos que o próprio usuário altera
+func validateProfile(in model.ProfileInput) error {
+	v := newValidator("profile")
+	v.check(utf8.RuneCountInString(in.DisplayName) <= maxDisplayNameLen, "display_name",
+		fmt.Sprintf("must have at most %d characters", maxDisplayNameLen))
+	if in.Email != "" {
+		addr, err := mail.ParseAddress(in.Email)
+		v.check(err == nil && addr.Address == in.Email && len(in.Email) <= maxEmailLen, "email",
+			"must be a plain e-mail address")
+	}
+	return v.err()
+}
+
+// validateNewPassword aplica a política de senhas na troca da senha de username
+func validateNewPassword(ctx context.Context, policy password.Policy, pw, username string) error {
+	v := newValidator("password")
+	if err := checkPassword(ctx, v, "password", policy, pw, username); err != nil {
+		return err
+	}
+	return v.err()
+}
+
+// validatePasswordChange aplica a política à nova senha, que deve diferir da atual
+func validatePasswordChange(ctx context.Context, policy password.Policy, in model.PasswordChangeInput, username string) error {
+	v := newValidator("password")
+	if err := checkPassword(ctx, v, "new_password", policy, in.NewPassword, username); err != nil {
+		return err
+	}
+	v.check(in.NewPassword != in.CurrentPassword, "new_password", "must differ from the current password")
+	return v.err()
+}
+
+// checkPassword registra em v, sob field, cada regra da política violada; o erro vem da lista de senhas vazadas
+func checkPassword(ctx context.Context, v *validator, field string, policy password.Policy, pw, username string) error {
+	problems, err := policy.Check(ctx, pw, username)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		v.check(false, field, p)
+	}
+	return nil
+}
+
+// validateTenant aplica as regras da loja e do seu primeiro administrador
+func validateTenant(ctx context.Context, policy password.Policy, in model.TenantInput) error {
+	v := newValidator("tenant")
+	v.check(slugPattern.MatchString(in.Slug), "slug",
+		"must have 2-32 lowercase letters, digits or '-', starting with a letter or digit")
+	v.check(in.Name != "", "name", "is required")
+	v.check(utf8.RuneCountInString(in.Name) <= maxTenantNameLen, "name",
+		fmt.Sprintf("must have at most %d characters", maxTenantNameLen))
+	v.check(usernamePattern.MatchString(in.AdminUsername), "admin_username",
+		"must have 3-32 characters among letters, digits, '.', '_' and '-', starting with a letter or digit")
+	if err := checkPassword(ctx, v, "admin_password", policy, in.AdminPassword, in.AdminUsername); err != nil {
+		return err
+	}
+	return v.err()
+}
+
+// validateRole aplica as regras de formato de um papel; as permissões são conferidas pelo banco
+func validateRole(r model.Role) error {
+	v := newValidator("role")
+	v.check(roleNamePattern.MatchString(r.Name), "name",
+		"must have 2-32 lowercase letters, digits, '_' or '-', starting with a letter")
+	v.check(utf8.RuneCountInString(r.Description) <= maxDescriptionLen, "description",
+		fmt.Sprintf("must have at most %d characters", maxDescriptionLen))
+	return v.err()
+}
+
+func validateRoleNames(roles []string) error {
+	v := newValidator("user roles")
+	checkRoleNames(v, roles)
+	return v.err()
+}
+
+func checkUsername(v *validator, username string) {
+	v.check(usernamePattern.MatchString(username), "username",
+		"must have 3-32 characters among letters, digits, '.', '_' and '-', starting with a letter or digit")
+}
+
+func checkRoleNames(v *validator, roles []string) {
+	v.check(len(roles) > 0, "roles", "must have at least one role")
+	for _, r := range roles {
+		v.check(roleNamePattern.MatchString(r), "roles", fmt.Sprintf("invalid role name %q", r))
+	}
+}
+
+// validateAPIKey aplica as regras de uma chave de API; known são os escopos aceitos
+func validateAPIKey(in model.APIKeyInput, known map[string]bool, now time.Time) error {
+	v := newValidator("api key")
+	v.check(in.Name != "", "name", "is required")
+	v.check(utf8.RuneCountInString(in.Name) <= maxAPIKeyNameLen, "name",
+		fmt.Sprintf("must have at most %d characters", maxAPIKeyNameLen))
+	v.check(len(in.Scopes) > 0, "scopes", "must have at least one scope")
+	for _, scope := range in.Scopes {
+		v.check(known[scope], "scopes", fmt.Sprintf("unknown scope %q", scope))
+	}
+	v.check(in.ExpiresAt == nil || in.ExpiresAt.After(now), "expires_at", "must be in the future")
+	return v.err()
+}
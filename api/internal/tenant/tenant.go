@@ -0,0 +1,95 @@
+// Package tenant identifica a loja (tenant) de cada requisição. Os repositórios
+// leem o tenant do contexto e recusam a consulta quando ele não foi definido.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/problem"
+)
+
+// Default é a loja criada pela migração, dona dos dados anteriores ao multi-tenant.
+// Os usuários dela operam a implantação: criam lojas e definem papéis.
+var Default = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// Header escolhe a loja nas rotas públicas de login; sem ele vale a loja padrão
+const Header = "X-Tenant"
+
+// ErrMissing indica uma consulta sem tenant no contexto, o que é um erro de programação
+var ErrMissing = errors.New("tenant missing from context")
+
+// ErrUnknown indica um slug de loja inexistente
+var ErrUnknown = errors.New("unknown tenant")
+
+type ctxKey struct{}
+
+// WithID devolve um contexto com a loja id
+func WithID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext devolve a loja do contexto, se houver
+func FromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(ctxKey{}).(uuid.UUID)
+	return id, ok && id != uuid.Nil
+}
+
+// Require devolve a loja do contexto ou ErrMissing
+func Require(ctx context.Context) (uuid.UUID, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return uuid.Nil, ErrMissing
+	}
+	return id, nil
+}
+
+// Key prefixa uma chave do Redis com a loja id
+func Key(id uuid.UUID, key string) string {
+	return "tenant:" + id.String() + ":" + key
+}
+
+// Resolver traduz o slug de uma loja no seu ID
+type Resolver interface {
+	ResolveTenant(ctx context.Context, slug string) (uuid.UUID, error)
+}
+
+// FromHeader define a loja pelo cabeçalho X-Tenant (slug), ou a padrão se ele faltar
+func FromHeader(resolver Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			slug := strings.TrimSpace(r.Header.Get(Header))
+			if slug == "" {
+				next.ServeHTTP(w, r.WithContext(WithID(r.Context(), Default)))
+				return
+			}
+			id, err := resolver.ResolveTenant(r.Context(), slug)
+			if errors.Is(err, ErrUnknown) {
+				problem.Error(w, r, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err != nil {
+				log.Printf("tenant lookup failed: %v", err)
+				problem.Error(w, r, http.StatusServiceUnavailable, "tenant lookup unavailable")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+		})
+	}
+}
+
+// RequireOperator restringe a rota aos usuários da loja padrão; deve vir depois da autenticação
+func RequireOperator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := FromContext(r.Context()); !ok || id != Default {
+			problem.Error(w, r, http.StatusForbidden, "only operators of the default tenant can do this")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
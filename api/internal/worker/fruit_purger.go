@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/repository"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/tenant"
+)
+
+// FruitPurger expurga periodicamente, loja a loja, as frutas na lixeira há mais tempo que a retenção
+type FruitPurger struct {
+	svc       service.FruitService
+	tenants   repository.TenantRepository
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewFruitPurger(svc service.FruitService, tenants repository.TenantRepository, retention, interval time.Duration) *FruitPurger {
+	return &FruitPurger{svc: svc, tenants: tenants, retention: retention, interval: interval}
+}
+
+// Run executa o expurgo a cada intervalo até o contexto ser cancelado
+func (p *FruitPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.purge(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *FruitPurger) purge(ctx context.Context) {
+	tenants, err := p.tenants.List(ctx)
+	if err != nil {
+		log.Printf("fruit purge error: %v", err)
+		return
+	}
+	for _, t := range tenants {
+		n, err := p.svc.PurgeDeletedFruits(tenant.WithID(ctx, t.ID), p.retention)
+		if err != nil {
+			log.Printf("fruit purge error (tenant %s): %v", t.Slug, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("fruit purge: %d frutas removidas definitivamente (loja %s)", n, t.Slug)
+		}
+	}
+}
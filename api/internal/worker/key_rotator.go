@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// KeyRotator recarrega periodicamente as chaves de assinatura, rotacionando-as quando vencem
+type KeyRotator struct {
+	svc      service.SigningKeyService
+	interval time.Duration
+}
+
+func NewKeyRotator(svc service.SigningKeyService, interval time.Duration) *KeyRotator {
+	return &KeyRotator{svc: svc, interval: interval}
+}
+
+// Run recarrega as chaves a cada intervalo até o contexto ser cancelado
+func (k *KeyRotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := k.svc.Refresh(ctx); err != nil {
+			log.Printf("signing key refresh error: %v", err)
+		}
+	}
+}
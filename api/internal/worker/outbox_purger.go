@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// OutboxPurger apaga periodicamente os eventos da outbox publicados há mais tempo que a retenção
+type OutboxPurger struct {
+	svc       service.OutboxService
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewOutboxPurger(svc service.OutboxService, retention, interval time.Duration) *OutboxPurger {
+	return &OutboxPurger{svc: svc, retention: retention, interval: interval}
+}
+
+// Run executa o expurgo a cada intervalo até o contexto ser cancelado
+func (p *OutboxPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		n, err := p.svc.PurgeSent(ctx, p.retention)
+		if err != nil {
+			log.Printf("outbox purge error: %v", err)
+		} else if n > 0 {
+			log.Printf("outbox purge: %d eventos publicados removidos", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// outboxBatch é o número de eventos reservados por vez
+const outboxBatch = 100
+
+// OutboxRelay publica os eventos pendentes da outbox; enquanto houver fila cheia
+// segue sem esperar o intervalo
+type OutboxRelay struct {
+	svc      service.OutboxService
+	interval time.Duration
+}
+
+func NewOutboxRelay(svc service.OutboxService, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{svc: svc, interval: interval}
+}
+
+// Run publica os eventos a cada intervalo até o contexto ser cancelado
+func (o *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := o.svc.Relay(ctx, outboxBatch)
+			if err != nil {
+				log.Printf("outbox relay error: %v", err)
+			}
+			if err != nil || n < outboxBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
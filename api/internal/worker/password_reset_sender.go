@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/hsalmeida/fruit-store-monorepo/api/internal/service"
+)
+
+// resetBatch é o número de pedidos de redefinição atendidos por vez
+const resetBatch = 50
+
+// PasswordResetSender envia os tokens dos pedidos de redefinição de senha pendentes;
+// enquanto houver fila cheia segue sem esperar o intervalo
+type PasswordResetSender struct {
+	svc      service.PasswordResetSender
+	interval time.Duration
+}
+
+func NewPasswordResetSender(svc service.PasswordResetSender, interval time.Duration) *PasswordResetSender {
+	return &PasswordResetSender{svc: svc, interval: interval}
+}
+
+// Run atende os pedidos a cada intervalo até o contexto ser cancelado
+func (p *PasswordResetSender) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := p.svc.SendPending(ctx, resetBatch)
+			if err != nil {
+				log.Printf("password reset sender error: %v", err)
+			}
+			if err != nil || n < resetBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
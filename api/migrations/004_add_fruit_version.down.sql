@@ -0,0 +1 @@
+ALTER TABLE fruits DROP COLUMN version;
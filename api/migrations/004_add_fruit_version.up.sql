@@ -0,0 +1 @@
+ALTER TABLE fruits ADD COLUMN version INT NOT NULL DEFAULT 1;
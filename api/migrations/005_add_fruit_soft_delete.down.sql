@@ -0,0 +1,5 @@
+DROP INDEX fruits_deleted_at_idx;
+
+ALTER TABLE fruits
+  DROP COLUMN deleted_by,
+  DROP COLUMN deleted_at;
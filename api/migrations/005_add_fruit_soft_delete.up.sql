@@ -0,0 +1,5 @@
+ALTER TABLE fruits
+  ADD COLUMN deleted_at TIMESTAMPTZ,
+  ADD COLUMN deleted_by UUID;
+
+CREATE INDEX fruits_deleted_at_idx ON fruits (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+CREATE TABLE signing_keys (
+  kid TEXT PRIMARY KEY,
+  algorithm TEXT NOT NULL,
+  -- chave privada em PEM (PKCS #8); as públicas são derivadas dela e publicadas no JWKS
+  private_key TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  activates_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,13 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+
+-- volta ao papel único, preferindo admin quando o usuário tinha vários
+UPDATE users u
+   SET role = 'admin'
+ WHERE EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id AND ur.role = 'admin');
+
+ALTER TABLE users ALTER COLUMN role DROP DEFAULT;
+
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE roles;
+DROP TABLE permissions;
@@ -0,0 +1,46 @@
+CREATE TABLE permissions (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE roles (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE role_permissions (
+  role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+  PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+INSERT INTO permissions (name, description) VALUES
+  ('fruits:read',  'Listar e consultar frutas'),
+  ('fruits:write', 'Criar, alterar, excluir e restaurar frutas'),
+  ('users:manage', 'Gerenciar usuários, sessões e papéis'),
+  ('reports:view', 'Consultar relatórios');
+
+INSERT INTO roles (name, description) VALUES
+  ('admin', 'Acesso total'),
+  ('user',  'Somente leitura de frutas');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role, permission) VALUES ('user', 'fruits:read');
+
+-- cada usuário mantém o papel que tinha na coluna users.role
+INSERT INTO user_roles (user_id, role)
+SELECT id, role FROM users WHERE role IN (SELECT name FROM roles);
+
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+  id UUID PRIMARY KEY,
+  name TEXT NOT NULL,
+  -- identifica a chave sem expor o segredo; também é a chave de busca na autenticação
+  prefix TEXT NOT NULL UNIQUE,
+  key_hash TEXT NOT NULL,
+  scopes TEXT[] NOT NULL,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- o admin semeado por 003_seed_admin precisa trocar a senha padrão no primeiro login
+UPDATE users
+   SET must_change_password = TRUE
+ WHERE username = 'admin'
+   AND password_hash = crypt('adminpass', password_hash);
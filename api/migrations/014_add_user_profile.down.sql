@@ -0,0 +1,5 @@
+DROP INDEX users_email_key;
+
+ALTER TABLE users
+  DROP COLUMN email,
+  DROP COLUMN display_name;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+  ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+  ADD COLUMN email TEXT;
+
+CREATE UNIQUE INDEX users_email_key ON users (lower(email));
@@ -0,0 +1,16 @@
+DELETE FROM permissions WHERE name = 'tenants:manage';
+
+DROP INDEX users_email_key;
+CREATE UNIQUE INDEX users_email_key ON users (lower(email));
+ALTER TABLE users DROP CONSTRAINT users_username_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+
+ALTER TABLE recovery_codes DROP COLUMN tenant_id;
+ALTER TABLE user_totp DROP COLUMN tenant_id;
+ALTER TABLE password_reset_tokens DROP COLUMN tenant_id;
+ALTER TABLE refresh_tokens DROP COLUMN tenant_id;
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+ALTER TABLE users DROP COLUMN tenant_id;
+ALTER TABLE fruits DROP COLUMN tenant_id;
+
+DROP TABLE tenants;
@@ -0,0 +1,48 @@
+CREATE TABLE tenants (
+  id UUID PRIMARY KEY,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- a loja padrão fica com todos os dados existentes; seus usuários operam a implantação
+INSERT INTO tenants (id, slug, name) VALUES
+  ('00000000-0000-0000-0000-000000000001', 'default', 'Fruit Store');
+
+-- o DEFAULT só preenche as linhas existentes: depois dele, todo INSERT precisa informar a loja
+ALTER TABLE fruits ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+ALTER TABLE users ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+ALTER TABLE api_keys ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+ALTER TABLE refresh_tokens ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+ALTER TABLE password_reset_tokens ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+ALTER TABLE user_totp ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+ALTER TABLE recovery_codes ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id);
+
+ALTER TABLE fruits ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE refresh_tokens ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE password_reset_tokens ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE user_totp ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE recovery_codes ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX fruits_tenant_idx ON fruits (tenant_id);
+CREATE INDEX api_keys_tenant_idx ON api_keys (tenant_id);
+CREATE INDEX refresh_tokens_tenant_user_idx ON refresh_tokens (tenant_id, user_id);
+
+-- username e e-mail passam a ser únicos dentro de cada loja
+ALTER TABLE users DROP CONSTRAINT users_username_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (tenant_id, username);
+DROP INDEX users_email_key;
+CREATE UNIQUE INDEX users_email_key ON users (tenant_id, lower(email));
+
+INSERT INTO permissions (name, description) VALUES
+  ('tenants:manage', 'Criar e listar lojas (somente na loja padrão)');
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'tenants:manage');
@@ -0,0 +1,11 @@
+-- Vínculo dos usuários com as contas de provedores OIDC (subject do ID token)
+CREATE TABLE user_identities (
+  tenant_id UUID NOT NULL REFERENCES tenants(id),
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (tenant_id, provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
@@ -0,0 +1,13 @@
+-- Eventos gravados na mesma transação da alteração que os originou; o relay os publica em ordem de id
+CREATE TABLE outbox (
+  id BIGSERIAL PRIMARY KEY,
+  action TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL,
+  last_error TEXT,
+  sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at, id) WHERE sent_at IS NULL;
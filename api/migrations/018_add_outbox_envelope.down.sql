@@ -0,0 +1,3 @@
+ALTER TABLE outbox DROP COLUMN actor;
+ALTER TABLE outbox DROP COLUMN correlation_id;
+ALTER TABLE outbox DROP COLUMN event_id;
@@ -0,0 +1,5 @@
+-- Metadados do envelope, fixados na gravação para que as novas tentativas repitam o mesmo evento
+ALTER TABLE outbox ADD COLUMN event_id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE outbox ALTER COLUMN event_id DROP DEFAULT;
+ALTER TABLE outbox ADD COLUMN correlation_id TEXT;
+ALTER TABLE outbox ADD COLUMN actor JSONB;
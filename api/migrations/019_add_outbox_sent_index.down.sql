@@ -0,0 +1 @@
+DROP INDEX outbox_sent_idx;
@@ -0,0 +1,2 @@
+-- Usado pelo expurgo dos eventos já publicados
+CREATE INDEX outbox_sent_idx ON outbox (sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Pedidos de redefinição de senha aguardando o envio do token; o worker os apaga ao atendê-los
+CREATE TABLE password_reset_requests (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id UUID NOT NULL REFERENCES tenants(id),
+  username TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
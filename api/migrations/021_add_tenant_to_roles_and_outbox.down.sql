@@ -0,0 +1,27 @@
+ALTER TABLE outbox DROP COLUMN tenant_id;
+
+ALTER TABLE user_roles DROP CONSTRAINT user_roles_role_fkey;
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_role_fkey;
+
+-- os papéis voltam a ser os da loja padrão; as atribuições a papéis que só existiam em outras lojas se perdem
+DELETE FROM user_roles ur WHERE NOT EXISTS (
+  SELECT 1 FROM roles r WHERE r.tenant_id = '00000000-0000-0000-0000-000000000001' AND r.name = ur.role);
+DELETE FROM role_permissions WHERE tenant_id <> '00000000-0000-0000-0000-000000000001';
+DELETE FROM roles WHERE tenant_id <> '00000000-0000-0000-0000-000000000001';
+
+DROP INDEX user_roles_role_idx;
+ALTER TABLE user_roles DROP COLUMN tenant_id;
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_pkey;
+ALTER TABLE role_permissions DROP COLUMN tenant_id;
+ALTER TABLE role_permissions ADD CONSTRAINT role_permissions_pkey PRIMARY KEY (role, permission);
+
+ALTER TABLE roles DROP CONSTRAINT roles_pkey;
+ALTER TABLE roles DROP COLUMN tenant_id;
+ALTER TABLE roles ADD CONSTRAINT roles_pkey PRIMARY KEY (name);
+
+ALTER TABLE role_permissions ADD CONSTRAINT role_permissions_role_fkey
+  FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE;
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_role_fkey
+  FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE;
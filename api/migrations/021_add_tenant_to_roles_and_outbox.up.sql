@@ -0,0 +1,48 @@
+-- Papéis, suas permissões e a atribuição aos usuários passam a pertencer a cada loja: a edição
+-- de um papel numa loja não altera as permissões das outras. A outbox também guarda a loja, que
+-- segue no evento publicado.
+--
+-- Continuam globais de propósito:
+--   permissions        o catálogo de permissões é definido pelo código da API
+--   signing_keys       a API assina os tokens de todas as lojas; a loja vai na claim tid
+--   processed_events   (user-service) os IDs de evento são UUIDs, únicos entre as lojas
+
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_role_fkey;
+ALTER TABLE user_roles DROP CONSTRAINT user_roles_role_fkey;
+
+ALTER TABLE roles ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES tenants(id) ON DELETE CASCADE;
+ALTER TABLE roles ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE roles DROP CONSTRAINT roles_pkey;
+ALTER TABLE roles ADD CONSTRAINT roles_pkey PRIMARY KEY (tenant_id, name);
+
+ALTER TABLE role_permissions ADD COLUMN tenant_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001';
+ALTER TABLE role_permissions ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE role_permissions DROP CONSTRAINT role_permissions_pkey;
+ALTER TABLE role_permissions ADD CONSTRAINT role_permissions_pkey PRIMARY KEY (tenant_id, role, permission);
+
+-- as demais lojas recebem uma cópia dos papéis que usavam até aqui
+INSERT INTO roles (tenant_id, name, description, created_at, updated_at)
+SELECT t.id, r.name, r.description, r.created_at, r.updated_at
+  FROM tenants t CROSS JOIN roles r
+ WHERE t.id <> '00000000-0000-0000-0000-000000000001' AND r.tenant_id = '00000000-0000-0000-0000-000000000001';
+INSERT INTO role_permissions (tenant_id, role, permission)
+SELECT t.id, rp.role, rp.permission
+  FROM tenants t CROSS JOIN role_permissions rp
+ WHERE t.id <> '00000000-0000-0000-0000-000000000001' AND rp.tenant_id = '00000000-0000-0000-0000-000000000001';
+
+ALTER TABLE role_permissions ADD CONSTRAINT role_permissions_role_fkey
+  FOREIGN KEY (tenant_id, role) REFERENCES roles(tenant_id, name) ON DELETE CASCADE;
+
+ALTER TABLE user_roles ADD COLUMN tenant_id UUID;
+UPDATE user_roles ur SET tenant_id = u.tenant_id FROM users u WHERE u.id = ur.user_id;
+ALTER TABLE user_roles ALTER COLUMN tenant_id SET NOT NULL;
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_role_fkey
+  FOREIGN KEY (tenant_id, role) REFERENCES roles(tenant_id, name) ON DELETE CASCADE;
+DROP INDEX user_roles_role_idx;
+CREATE INDEX user_roles_role_idx ON user_roles (tenant_id, role);
+
+-- sem chave estrangeira: o evento fica na outbox até o expurgo, mesmo que a loja deixe de existir
+ALTER TABLE outbox ADD COLUMN tenant_id UUID;
+UPDATE outbox SET tenant_id = COALESCE((payload->>'tenant_id')::uuid, '00000000-0000-0000-0000-000000000001');
+ALTER TABLE outbox ALTER COLUMN tenant_id SET NOT NULL;
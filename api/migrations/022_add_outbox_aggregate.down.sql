@@ -0,0 +1,2 @@
+DROP INDEX outbox_pending_aggregate_idx;
+ALTER TABLE outbox DROP COLUMN aggregate_id;
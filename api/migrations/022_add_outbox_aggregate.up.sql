@@ -0,0 +1,7 @@
+-- Usuário de cada evento: o relay não publica um evento enquanto houver um anterior do mesmo
+-- usuário ainda pendente e reservado ou reagendado
+ALTER TABLE outbox ADD COLUMN aggregate_id UUID;
+UPDATE outbox SET aggregate_id = COALESCE((payload->>'id')::uuid, '00000000-0000-0000-0000-000000000000');
+ALTER TABLE outbox ALTER COLUMN aggregate_id SET NOT NULL;
+
+CREATE INDEX outbox_pending_aggregate_idx ON outbox (aggregate_id, id) WHERE sent_at IS NULL;
@@ -10,6 +10,8 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 
 	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/consumer"
+	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/env"
+	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/repository"
 )
 
 func main() {
@@ -27,7 +29,11 @@ func main() {
 	}
 	defer ch.Close()
 
-	// Garante que a fila existe
+	// Garante que as filas existem. Os argumentos da user.queue são os mesmos declarados pela
+	// API; as recusadas chegam à user.queue.dead pela policy aplicada no broker (make rabbitmq-policy)
+	if _, err := ch.QueueDeclare("user.queue.dead", true, false, false, false, nil); err != nil {
+		log.Fatalf("queue declare error: %v", err)
+	}
 	q, err := ch.QueueDeclare("user.queue", true, false, false, false, nil)
 	if err != nil {
 		log.Fatalf("queue declare error: %v", err)
@@ -43,6 +49,13 @@ func main() {
 	}
 	defer pool.Close()
 
+	// Expurgo dos eventos processados: reentregas mais antigas que a retenção não são esperadas
+	go purgeProcessedEvents(
+		repository.NewProcessedEventRepository(pool),
+		mustDuration("PROCESSED_EVENTS_RETENTION", 7*24*time.Hour),
+		mustDuration("PROCESSED_EVENTS_PURGE_INTERVAL", time.Hour),
+	)
+
 	// 3) Inicia o consumer
 	msgs, err := ch.Consume(q.Name, "", false, false, false, false, nil)
 	if err != nil {
@@ -51,11 +64,30 @@ func main() {
 	c := consumer.New(pool)
 	log.Println("user-service consumer started")
 	for d := range msgs {
-		if err := c.Process(d); err != nil {
-			log.Printf("process error: %v", err)
-			d.Nack(false, true)
-			continue
+		c.Handle(d)
+	}
+}
+
+// purgeProcessedEvents apaga a cada interval os eventos processados há mais tempo que retention
+func purgeProcessedEvents(repo repository.ProcessedEventRepository, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := repo.Purge(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("processed events purge error: %v", err)
+		} else if n > 0 {
+			log.Printf("processed events purge: %d eventos removidos", n)
 		}
-		d.Ack(false)
+		<-ticker.C
+	}
+}
+
+// mustDuration lê a duração key com env.Duration e encerra o processo se ela for inválida
+func mustDuration(key string, def time.Duration) time.Duration {
+	d, err := env.Duration(key, def)
+	if err != nil {
+		log.Fatal(err)
 	}
+	return d
 }
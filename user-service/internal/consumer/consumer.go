@@ -3,15 +3,23 @@ package consumer
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	amqp "github.com/rabbitmq/amqp091-go"
 
+	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/event"
 	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/model"
 	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/repository"
 )
 
+// ErrRejected indica um evento que nunca será aplicado por esta versão do serviço; deve
+// ser recusado sem volta à fila, para cair na fila de mensagens mortas
+var ErrRejected = errors.New("event rejected")
+
 type Consumer struct {
 	repo repository.UserRepository
 }
@@ -21,28 +29,60 @@ func New(db *pgxpool.Pool) *Consumer {
 	return &Consumer{repo: repository.NewUserRepository(db)}
 }
 
-// Payload esperado na fila
-type userEvent struct {
-	Action string     `json:"action"`
-	User   model.User `json:"user"`
+// Handle processa d e a confirma: erros da própria mensagem (ErrRejected) a recusam sem
+// volta à fila, para cair na user.queue.dead; os demais (ex.: banco fora do ar) a devolvem
+// à fila para nova tentativa.
+func (c *Consumer) Handle(d amqp.Delivery) {
+	err := c.Process(d)
+	switch {
+	case err == nil:
+		d.Ack(false)
+	case errors.Is(err, ErrRejected):
+		log.Printf("process error: %v, enviando para user.queue.dead", err)
+		d.Nack(false, false)
+	default:
+		log.Printf("process error: %v", err)
+		d.Nack(false, true)
+	}
 }
 
-// Process trata create/update/delete e persiste no DB
+// Process trata create/update/delete e persiste no DB. Eventos repetidos ou com ação
+// desconhecida são pulados. Mensagens que não podem ser lidas (formato inválido, versão
+// mais nova) ou que colidem com outra réplica devolvem ErrRejected, porque tentar de novo
+// não muda o resultado; ficam guardadas até o serviço ser atualizado ou a réplica corrigida.
 func (c *Consumer) Process(d amqp.Delivery) error {
-	var evt userEvent
-	if err := json.Unmarshal(d.Body, &evt); err != nil {
-		return err
+	evt, err := event.Parse(d)
+	if err != nil {
+		return fmt.Errorf("%w: mensagem %q: %v", ErrRejected, d.MessageId, err)
+	}
+	var user model.User
+	if err := json.Unmarshal(evt.Data, &user); err != nil {
+		return fmt.Errorf("%w: evento %s: dados do usuário: %v", ErrRejected, evt.ID, err)
+	}
+	if user.TenantID == uuid.Nil {
+		user.TenantID = evt.TenantID
 	}
 
 	ctx := context.Background()
 	switch evt.Action {
 	case "create", "update":
-		if err := c.repo.Save(ctx, evt.User); err != nil {
-			return err
-		}
-		log.Printf("usuario %s: %s", evt.Action, evt.User.Username)
+		err = c.repo.Save(ctx, evt.ID, user)
+	case "delete":
+		err = c.repo.Delete(ctx, evt.ID, user)
 	default:
 		log.Printf("acao desconhecida %q, pulando", evt.Action)
+		return nil
+	}
+	if errors.Is(err, repository.ErrDuplicate) {
+		log.Printf("evento %s repetido, pulando", evt.ID)
+		return nil
+	}
+	if errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("%w: evento %s: %v", ErrRejected, evt.ID, err)
+	}
+	if err != nil {
+		return err
 	}
+	log.Printf("usuario %s: %s (evento %s, correlation %s)", evt.Action, user.Username, evt.ID, evt.CorrelationID)
 	return nil
 }
@@ -0,0 +1,137 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/event"
+	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/model"
+	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/repository"
+)
+
+// memRepo conta os eventos aplicados e recusa os repetidos, como o repositório real;
+// err simula a falha do banco
+type memRepo struct {
+	seen    map[uuid.UUID]bool
+	applied int
+	err     error
+}
+
+func (m *memRepo) apply(eventID uuid.UUID) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.seen[eventID] {
+		return repository.ErrDuplicate
+	}
+	m.seen[eventID] = true
+	m.applied++
+	return nil
+}
+func (m *memRepo) Save(ctx context.Context, eventID uuid.UUID, u model.User) error {
+	return m.apply(eventID)
+}
+func (m *memRepo) Delete(ctx context.Context, eventID uuid.UUID, u model.User) error {
+	return m.apply(eventID)
+}
+
+func TestProcess(t *testing.T) {
+	repo := &memRepo{seen: map[uuid.UUID]bool{}}
+	c := &Consumer{repo: repo}
+	id := uuid.NewString()
+	delivery := func(version int) amqp.Delivery {
+		return amqp.Delivery{Body: []byte(`{"id":"` + id + `","type":"user.created","schema_version":` +
+			strconv.Itoa(version) + `,"user":{"username":"ana"}}`)}
+	}
+
+	if err := c.Process(delivery(1)); err != nil || repo.applied != 1 {
+		t.Fatalf("primeira entrega: esperado aplicar, recebeu %d, %v", repo.applied, err)
+	}
+	if err := c.Process(delivery(1)); err != nil || repo.applied != 1 {
+		t.Fatalf("reentrega: esperado ack sem aplicar de novo, recebeu %d, %v", repo.applied, err)
+	}
+	// versão mais nova não é confirmada: vai para a fila de mensagens mortas
+	if err := c.Process(delivery(2)); !errors.Is(err, ErrRejected) || repo.applied != 1 {
+		t.Fatalf("versão nova: esperado ErrRejected sem aplicar, recebeu %d, %v", repo.applied, err)
+	}
+
+	// o username de outra réplica não se resolve com novas tentativas; o banco fora do ar, sim
+	id = uuid.NewString()
+	repo.err = fmt.Errorf("%w: users_tenant_username_key", repository.ErrConflict)
+	if err := c.Process(delivery(1)); !errors.Is(err, ErrRejected) {
+		t.Fatalf("conflito: esperado ErrRejected, recebeu %v", err)
+	}
+	repo.err = errors.New("connection refused")
+	if err := c.Process(delivery(1)); err == nil || errors.Is(err, ErrRejected) {
+		t.Fatalf("banco fora do ar: esperado erro para nova tentativa, recebeu %v", err)
+	}
+}
+
+// ackRecorder registra como a mensagem foi confirmada
+type ackRecorder struct {
+	acked, nacked, requeued bool
+}
+
+func (a *ackRecorder) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+func (a *ackRecorder) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+func (a *ackRecorder) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func TestHandle(t *testing.T) {
+	binary := func(edit func(amqp.Table), body string) amqp.Delivery {
+		h := amqp.Table{
+			"ce-specversion": "1.0", "ce-id": uuid.NewString(), "ce-source": "/fruit-store-api",
+			"ce-type": "user.created", "ce-time": "2025-06-01T12:00:00Z", "ce-schemaversion": int32(1),
+		}
+		edit(h)
+		return amqp.Delivery{ContentType: "application/json", Headers: h, Body: []byte(body)}
+	}
+	structured := func(body string) amqp.Delivery {
+		return amqp.Delivery{ContentType: event.CloudEventsContentType, Body: []byte(body)}
+	}
+	valid := `{"username":"ana"}`
+	keep := func(amqp.Table) {}
+
+	cases := []struct {
+		name    string
+		d       amqp.Delivery
+		dbErr   error
+		ack     bool
+		requeue bool
+	}{
+		{name: "binário válido", d: binary(keep, valid), ack: true},
+		{name: "binário com specversion inválida", d: binary(func(h amqp.Table) { h["ce-specversion"] = "0.3" }, valid)},
+		{name: "binário sem ce-id", d: binary(func(h amqp.Table) { delete(h, "ce-id") }, valid)},
+		{name: "binário com ce-time inválido", d: binary(func(h amqp.Table) { h["ce-time"] = "ontem" }, valid)},
+		{name: "binário com dados ilegíveis", d: binary(keep, `{"username":`)},
+		{name: "estruturado ilegível", d: structured(`{"specversion":`)},
+		{name: "estruturado com specversion inválida", d: structured(`{"specversion":"0.3","id":"` + uuid.NewString() + `","type":"user.created","data":` + valid + `}`)},
+		{name: "estruturado sem id", d: structured(`{"specversion":"1.0","type":"user.created","data":` + valid + `}`)},
+		{name: "estruturado com dados que não são usuário", d: structured(`{"specversion":"1.0","id":"` + uuid.NewString() + `","type":"user.created","data":"ana"}`)},
+		{name: "banco fora do ar", d: binary(keep, valid), dbErr: errors.New("connection refused"), requeue: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Consumer{repo: &memRepo{seen: map[uuid.UUID]bool{}, err: tc.dbErr}}
+			ack := &ackRecorder{}
+			tc.d.Acknowledger = ack
+			c.Handle(tc.d)
+			if ack.acked != tc.ack || ack.nacked == tc.ack || ack.requeued != tc.requeue {
+				t.Fatalf("esperado ack=%v requeue=%v, recebeu %+v", tc.ack, tc.requeue, *ack)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Package env lê a configuração das variáveis de ambiente com as mesmas regras de
+// api/internal/env, que não pode ser importado de outro módulo: variável ausente usa o
+// padrão e valor inválido é erro.
+package env
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration lê uma duração positiva (ex.: "168h") de key, usando def se ausente
+func Duration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, got %q", key, v)
+	}
+	return d, nil
+}
@@ -0,0 +1,108 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CloudEventsContentType identifica uma mensagem CloudEvents no modo estruturado
+const CloudEventsContentType = "application/cloudevents+json"
+
+// cloudEvent traz os atributos CloudEvents 1.0 e as extensões usadas pela API
+type cloudEvent struct {
+	SpecVersion   string          `json:"specversion"`
+	ID            string          `json:"id"`
+	Source        string          `json:"source"`
+	Type          string          `json:"type"`
+	Time          string          `json:"time"`
+	SchemaVersion json.Number     `json:"schemaversion"`
+	CorrelationID string          `json:"correlationid"`
+	ActorType     string          `json:"actortype"`
+	ActorID       string          `json:"actorid"`
+	TenantID      string          `json:"tenantid"`
+	Data          json.RawMessage `json:"data"`
+}
+
+func parseCloudEventStructured(body []byte) (Envelope, error) {
+	var ce cloudEvent
+	if err := json.Unmarshal(body, &ce); err != nil {
+		return Envelope{}, err
+	}
+	return ce.envelope()
+}
+
+// parseCloudEventBinary lê os atributos dos cabeçalhos ce-*; o corpo é o próprio dado
+func parseCloudEventBinary(d amqp.Delivery) (Envelope, error) {
+	header := func(name string) string {
+		switch v := d.Headers["ce-"+name].(type) {
+		case string:
+			return v
+		case int32:
+			return strconv.Itoa(int(v))
+		case int64:
+			return strconv.FormatInt(v, 10)
+		}
+		return ""
+	}
+	ce := cloudEvent{
+		SpecVersion:   header("specversion"),
+		ID:            header("id"),
+		Source:        header("source"),
+		Type:          header("type"),
+		Time:          header("time"),
+		SchemaVersion: json.Number(header("schemaversion")),
+		CorrelationID: header("correlationid"),
+		ActorType:     header("actortype"),
+		ActorID:       header("actorid"),
+		TenantID:      header("tenantid"),
+		Data:          d.Body,
+	}
+	return ce.envelope()
+}
+
+// envelope converte o evento para o Envelope; o produtor é o source sem a barra inicial
+func (ce cloudEvent) envelope() (Envelope, error) {
+	if !strings.HasPrefix(ce.SpecVersion, "1.") {
+		return Envelope{}, fmt.Errorf("unsupported cloudevents specversion %q", ce.SpecVersion)
+	}
+	id, err := uuid.Parse(ce.ID)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("cloudevents id: %w", err)
+	}
+	e := Envelope{
+		ID:            id,
+		Type:          ce.Type,
+		SchemaVersion: 1,
+		Producer:      strings.TrimPrefix(ce.Source, "/"),
+		CorrelationID: ce.CorrelationID,
+		Action:        actionOf(ce.Type),
+		Data:          ce.Data,
+	}
+	if ce.SchemaVersion != "" {
+		v, err := ce.SchemaVersion.Int64()
+		if err != nil {
+			return Envelope{}, fmt.Errorf("cloudevents schemaversion: %w", err)
+		}
+		e.SchemaVersion = int(v)
+	}
+	if ce.Time != "" {
+		if e.OccurredAt, err = time.Parse(time.RFC3339Nano, ce.Time); err != nil {
+			return Envelope{}, fmt.Errorf("cloudevents time: %w", err)
+		}
+	}
+	if ce.ActorID != "" {
+		e.Actor = &Actor{Type: ce.ActorType, ID: ce.ActorID}
+	}
+	if ce.TenantID != "" {
+		if e.TenantID, err = uuid.Parse(ce.TenantID); err != nil {
+			return Envelope{}, fmt.Errorf("cloudevents tenantid: %w", err)
+		}
+	}
+	return e, nil
+}
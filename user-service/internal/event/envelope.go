@@ -0,0 +1,94 @@
+// Package event lê o envelope dos eventos publicados pela API; é uma cópia do formato
+// definido em api/internal/event e deve acompanhar suas mudanças.
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// SchemaVersion é a maior versão do envelope que este serviço entende
+const SchemaVersion = 1
+
+// ErrUnsupportedVersion indica um evento de versão mais nova que SchemaVersion
+var ErrUnsupportedVersion = errors.New("unsupported event schema version")
+
+// Actor é quem fez a alteração na API
+type Actor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Envelope é o evento recebido. Mensagens no formato antigo ({"action","user"}) chegam
+// com SchemaVersion 0 e sem ID, o que desliga a deduplicação.
+type Envelope struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Producer      string          `json:"producer"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Actor         *Actor          `json:"actor,omitempty"`
+	TenantID      uuid.UUID       `json:"tenant_id"`
+	Action        string          `json:"action"`
+	Data          json.RawMessage `json:"user"`
+}
+
+// Parse lê o evento de d em qualquer dos formatos publicados pela API: o envelope
+// (ou o formato antigo) e CloudEvents nos modos estruturado e binário. Campos ausentes
+// são completados pelas propriedades AMQP, que a API preenche com os mesmos valores.
+func Parse(d amqp.Delivery) (Envelope, error) {
+	var (
+		e   Envelope
+		err error
+	)
+	switch {
+	case d.Headers["ce-specversion"] != nil:
+		e, err = parseCloudEventBinary(d)
+	case strings.HasPrefix(d.ContentType, CloudEventsContentType):
+		e, err = parseCloudEventStructured(d.Body)
+	default:
+		err = json.Unmarshal(d.Body, &e)
+	}
+	if err != nil {
+		return Envelope{}, err
+	}
+	if e.SchemaVersion > SchemaVersion {
+		return e, fmt.Errorf("%w: %d", ErrUnsupportedVersion, e.SchemaVersion)
+	}
+	if e.ID == uuid.Nil && d.MessageId != "" {
+		e.ID, _ = uuid.Parse(d.MessageId)
+	}
+	if e.CorrelationID == "" {
+		e.CorrelationID = d.CorrelationId
+	}
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = d.Timestamp
+	}
+	if e.Producer == "" {
+		e.Producer = d.AppId
+	}
+	if e.Action == "" {
+		e.Action = actionOf(e.Type)
+	}
+	return e, nil
+}
+
+// actionOf traduz o tipo do evento para a ação do formato antigo
+func actionOf(typ string) string {
+	switch typ {
+	case "user.created":
+		return "create"
+	case "user.updated":
+		return "update"
+	case "user.deleted":
+		return "delete"
+	}
+	return ""
+}
@@ -0,0 +1,258 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// modos de publicação da API (EVENT_ENCODING)
+const (
+	modeEnvelope   = "envelope"
+	modeStructured = "cloudevents-structured"
+	modeBinary     = "cloudevents-binary"
+)
+
+func testEnvelope() Envelope {
+	return Envelope{
+		ID:            uuid.New(),
+		Type:          "user.updated",
+		SchemaVersion: 1,
+		OccurredAt:    time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		Producer:      "fruit-store-api",
+		CorrelationID: "req-1",
+		Actor:         &Actor{Type: "user", ID: "42"},
+		TenantID:      uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		Action:        "update",
+		Data:          json.RawMessage(`{"username":"ana"}`),
+	}
+}
+
+// published monta a entrega de e no formato mode do mesmo jeito que o publisher.Encode
+// da API; assim como o Envelope, deve acompanhar as mudanças de lá
+func published(t *testing.T, e Envelope, mode string) amqp.Delivery {
+	t.Helper()
+	d := amqp.Delivery{
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     e.ID.String(),
+		Type:          e.Type,
+		Timestamp:     e.OccurredAt,
+		AppId:         e.Producer,
+		CorrelationId: e.CorrelationID,
+	}
+	ce := map[string]any{
+		"specversion":     "1.0",
+		"id":              e.ID.String(),
+		"source":          "/" + e.Producer,
+		"type":            e.Type,
+		"time":            e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		"datacontenttype": "application/json",
+		"schemaversion":   e.SchemaVersion,
+		"correlationid":   e.CorrelationID,
+		"actortype":       e.Actor.Type,
+		"actorid":         e.Actor.ID,
+		"tenantid":        e.TenantID.String(),
+		"data":            e.Data,
+	}
+	var err error
+	switch mode {
+	case modeEnvelope:
+		d.ContentType = "application/json"
+		d.Headers = amqp.Table{
+			"event_id":       e.ID.String(),
+			"event_type":     e.Type,
+			"schema_version": int32(e.SchemaVersion),
+			"occurred_at":    e.OccurredAt.UTC().Format(time.RFC3339Nano),
+			"producer":       e.Producer,
+			"correlation_id": e.CorrelationID,
+			"actor_type":     e.Actor.Type,
+			"actor_id":       e.Actor.ID,
+			"tenant_id":      e.TenantID.String(),
+		}
+		d.Body, err = json.Marshal(e)
+	case modeStructured:
+		d.ContentType = CloudEventsContentType
+		d.Body, err = json.Marshal(ce)
+	case modeBinary:
+		d.ContentType = "application/json"
+		d.Headers = amqp.Table{"ce-schemaversion": int32(e.SchemaVersion)}
+		for _, k := range []string{"specversion", "id", "source", "type", "time", "correlationid", "actortype", "actorid", "tenantid"} {
+			d.Headers["ce-"+k] = ce[k]
+		}
+		d.Body = e.Data
+	default:
+		t.Fatalf("modo desconhecido %q", mode)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// editBody altera o JSON do corpo de d
+func editBody(t *testing.T, d *amqp.Delivery, edit func(map[string]any)) {
+	t.Helper()
+	var body map[string]any
+	if err := json.Unmarshal(d.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	edit(body)
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Body = b
+}
+
+func TestParse(t *testing.T) {
+	e := testEnvelope()
+	legacy := Envelope{Action: "update", Data: e.Data}
+
+	cases := []struct {
+		name    string
+		mode    string
+		mutate  func(t *testing.T, d *amqp.Delivery)
+		want    Envelope
+		wantErr error // nil com wantAny = false: sucesso
+		wantAny bool  // qualquer erro serve
+	}{
+		{name: "envelope", mode: modeEnvelope, want: e},
+		{name: "cloudevents estruturado", mode: modeStructured, want: e},
+		{name: "cloudevents binário", mode: modeBinary, want: e},
+		{
+			name: "formato antigo", mode: modeEnvelope, want: legacy,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				*d = amqp.Delivery{Body: []byte(`{"action":"update","user":{"username":"ana"}}`)}
+			},
+		},
+		{
+			// content type com parâmetros ainda é o modo estruturado
+			name: "estruturado com charset", mode: modeStructured, want: e,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				d.ContentType = CloudEventsContentType + "; charset=utf-8"
+			},
+		},
+		{
+			// o cabeçalho ce-specversion decide o modo binário, qualquer que seja o content type
+			name: "binário com content type do estruturado", mode: modeBinary, want: e,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.ContentType = CloudEventsContentType },
+		},
+		{
+			name: "ce-schemaversion int64", mode: modeBinary, want: e,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.Headers["ce-schemaversion"] = int64(1) },
+		},
+		{
+			name: "ce-schemaversion int32 mais nova", mode: modeBinary, wantErr: ErrUnsupportedVersion,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.Headers["ce-schemaversion"] = int32(2) },
+		},
+		{
+			name: "ce-schemaversion int64 mais nova", mode: modeBinary, wantErr: ErrUnsupportedVersion,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.Headers["ce-schemaversion"] = int64(2) },
+		},
+		{
+			name: "schema_version mais nova", mode: modeEnvelope, wantErr: ErrUnsupportedVersion,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) { b["schema_version"] = 2 })
+			},
+		},
+		{
+			name: "envelope sem id usa o message_id", mode: modeEnvelope, want: e,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) { delete(b, "id") })
+			},
+		},
+		{
+			name: "envelope sem id e message_id inválido", mode: modeEnvelope,
+			want: func() Envelope { w := e; w.ID = uuid.Nil; return w }(),
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) { delete(b, "id") })
+				d.MessageId = "abc"
+			},
+		},
+		{
+			name: "metadados ausentes vêm das propriedades AMQP", mode: modeEnvelope, want: e,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) {
+					delete(b, "correlation_id")
+					delete(b, "occurred_at")
+					delete(b, "producer")
+					delete(b, "action")
+				})
+			},
+		},
+		{
+			name: "specversion inválida no binário", mode: modeBinary, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.Headers["ce-specversion"] = "0.3" },
+		},
+		{
+			name: "specversion inválida no estruturado", mode: modeStructured, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) { b["specversion"] = "0.3" })
+			},
+		},
+		{
+			name: "ce-id inválido", mode: modeBinary, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.Headers["ce-id"] = "abc" },
+		},
+		{
+			// no CloudEvents o id é obrigatório: o message_id não o substitui
+			name: "binário sem ce-id", mode: modeBinary, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) { delete(d.Headers, "ce-id") },
+		},
+		{
+			name: "id inválido no estruturado", mode: modeStructured, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) { b["id"] = "abc" })
+			},
+		},
+		{
+			name: "tenantid inválido", mode: modeBinary, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) { d.Headers["ce-tenantid"] = "abc" },
+		},
+		{
+			name: "id inválido no envelope", mode: modeEnvelope, wantAny: true,
+			mutate: func(t *testing.T, d *amqp.Delivery) {
+				editBody(t, d, func(b map[string]any) { b["id"] = "abc" })
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := published(t, e, tc.mode)
+			if tc.mutate != nil {
+				tc.mutate(t, &d)
+			}
+			got, err := Parse(d)
+			switch {
+			case tc.wantErr != nil:
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("esperado %v, recebeu %v", tc.wantErr, err)
+				}
+				return
+			case tc.wantAny:
+				if err == nil {
+					t.Fatalf("esperado erro, recebeu %+v", got)
+				}
+				return
+			case err != nil:
+				t.Fatalf("esperado nil, recebeu %v", err)
+			}
+			if !got.OccurredAt.Equal(tc.want.OccurredAt) {
+				t.Fatalf("occurred_at: esperado %v, recebeu %v", tc.want.OccurredAt, got.OccurredAt)
+			}
+			got.OccurredAt, tc.want.OccurredAt = time.Time{}, time.Time{}
+			if string(got.Data) != string(tc.want.Data) {
+				t.Fatalf("dados: esperado %s, recebeu %s", tc.want.Data, got.Data)
+			}
+			got.Data, tc.want.Data = nil, nil
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("esperado %+v, recebeu %+v", tc.want, got)
+			}
+		})
+	}
+}
@@ -2,11 +2,20 @@ package model
 
 import (
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// DefaultTenant é a loja padrão da API, dona dos usuários dos eventos sem tenant_id
+var DefaultTenant = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// User é a réplica do usuário da API; ID e TenantID vêm do evento e são nulos nos eventos antigos
 type User struct {
+	ID        uuid.UUID `json:"id"`
+	TenantID  uuid.UUID `json:"tenant_id"`
 	Username  string    `json:"username"`
 	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
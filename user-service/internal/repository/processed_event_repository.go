@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ProcessedEventRepository mantém o registro usado para descartar reentregas
+type ProcessedEventRepository interface {
+	// Purge apaga os eventos processados antes de before e devolve quantos foram removidos
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type processedEventRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewProcessedEventRepository(db *pgxpool.Pool) ProcessedEventRepository {
+	return &processedEventRepo{db: db}
+}
+
+func (r *processedEventRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM processed_events WHERE processed_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -2,14 +2,37 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hsalmeida/fruit-store-monorepo/user-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// pgUniqueViolation é o SQLSTATE de violação de unicidade
+const pgUniqueViolation = "23505"
+
+var (
+	// ErrDuplicate indica um evento que já foi aplicado
+	ErrDuplicate = errors.New("event already processed")
+	// ErrConflict indica um evento que colide com outra réplica (ex.: username recriado na API
+	// antes de chegar o delete do anterior); tentar de novo não resolve
+	ErrConflict = errors.New("event conflicts with another replica")
+)
+
+// UserRepository aplica os eventos na réplica. eventID é registrado na mesma transação;
+// um ID já registrado devolve ErrDuplicate sem alterar nada. uuid.Nil (eventos antigos)
+// não é registrado.
 type UserRepository interface {
-	Save(ctx context.Context, u model.User) error
+	// Save cria ou atualiza a réplica do usuário; devolve ErrConflict se o username pertence
+	// a outra réplica com ID da API
+	Save(ctx context.Context, eventID uuid.UUID, u model.User) error
+	// Delete remove a réplica do usuário, se existir
+	Delete(ctx context.Context, eventID uuid.UUID, u model.User) error
 }
 
 type userRepo struct {
@@ -20,10 +43,85 @@ func NewUserRepository(db *pgxpool.Pool) UserRepository {
 	return &userRepo{db: db}
 }
 
-func (r *userRepo) Save(ctx context.Context, u model.User) error {
+// tenantOf devolve a loja do usuário; eventos antigos são da loja padrão
+func tenantOf(u model.User) uuid.UUID {
+	if u.TenantID == uuid.Nil {
+		return model.DefaultTenant
+	}
+	return u.TenantID
+}
 
-	_, err := r.db.Exec(ctx, `
-        INSERT INTO users (id, username, role, created_at, updated_at) VALUES ($1,$2,$3,$4,$5)
-    `, uuid.New(), u.Username, u.Role, u.CreatedAt, u.UpdatedAt)
+func (r *userRepo) Save(ctx context.Context, eventID uuid.UUID, u model.User) error {
+	tid := tenantOf(u)
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := markProcessed(ctx, tx, eventID); err != nil {
+			return err
+		}
+		// eventos antigos não trazem o ID; o username identifica o usuário na loja
+		if u.ID == uuid.Nil {
+			_, err := tx.Exec(ctx, `
+        INSERT INTO users (id, tenant_id, username, role, disabled, created_at, updated_at, local_id) VALUES ($1,$2,$3,$4,$5,$6,$7,TRUE)
+        ON CONFLICT (tenant_id, username) DO UPDATE
+           SET role = EXCLUDED.role, disabled = EXCLUDED.disabled, updated_at = EXCLUDED.updated_at
+    `, uuid.New(), tid, u.Username, u.Role, u.Disabled, u.CreatedAt, u.UpdatedAt)
+			return err
+		}
+		// só réplicas com ID local (gravadas por eventos antigos) passam a usar o da API; uma
+		// réplica com outro ID da API é outro usuário e cai no conflito abaixo
+		if _, err := tx.Exec(ctx, `
+        UPDATE users SET id = $1, local_id = FALSE
+         WHERE tenant_id = $2 AND username = $3 AND id <> $1 AND local_id`, u.ID, tid, u.Username); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+        INSERT INTO users (id, tenant_id, username, role, disabled, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6,$7)
+        ON CONFLICT (id) DO UPDATE
+           SET username = EXCLUDED.username, role = EXCLUDED.role,
+               disabled = EXCLUDED.disabled, updated_at = EXCLUDED.updated_at
+    `, u.ID, tid, u.Username, u.Role, u.Disabled, u.CreatedAt, u.UpdatedAt)
+		return err
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return fmt.Errorf("%w: %s", ErrConflict, pgErr.Message)
+	}
 	return err
 }
+
+func (r *userRepo) Delete(ctx context.Context, eventID uuid.UUID, u model.User) error {
+	tid := tenantOf(u)
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := markProcessed(ctx, tx, eventID); err != nil {
+			return err
+		}
+		if u.ID == uuid.Nil {
+			_, err := tx.Exec(ctx, `DELETE FROM users WHERE tenant_id = $1 AND username = $2`, tid, u.Username)
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			`DELETE FROM users WHERE id = $1 OR (tenant_id = $2 AND username = $3)`, u.ID, tid, u.Username)
+		return err
+	})
+}
+
+// execer é a parte de pgx.Tx usada por markProcessed
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// markProcessed registra eventID em tx; devolve ErrDuplicate se ele já estava registrado
+func markProcessed(ctx context.Context, tx execer, eventID uuid.UUID) error {
+	if eventID == uuid.Nil {
+		return nil
+	}
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO processed_events (event_id, processed_at) VALUES ($1,$2) ON CONFLICT DO NOTHING`,
+		eventID, time.Now())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// memProcessed imita o INSERT ... ON CONFLICT DO NOTHING em processed_events
+type memProcessed struct {
+	ids   map[uuid.UUID]bool
+	calls int
+}
+
+func (m *memProcessed) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	m.calls++
+	id := args[0].(uuid.UUID)
+	if m.ids[id] {
+		return pgconn.NewCommandTag("INSERT 0 0"), nil
+	}
+	m.ids[id] = true
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func TestMarkProcessed_Dedupes(t *testing.T) {
+	ctx := context.Background()
+	db := &memProcessed{ids: map[uuid.UUID]bool{}}
+	id := uuid.New()
+
+	if err := markProcessed(ctx, db, id); err != nil {
+		t.Fatalf("primeira entrega: esperado nil, recebeu %v", err)
+	}
+	if err := markProcessed(ctx, db, id); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("reentrega: esperado ErrDuplicate, recebeu %v", err)
+	}
+	if err := markProcessed(ctx, db, uuid.New()); err != nil {
+		t.Fatalf("outro evento: esperado nil, recebeu %v", err)
+	}
+
+	// eventos antigos, sem ID, não são registrados nem descartados
+	before := db.calls
+	for range 2 {
+		if err := markProcessed(ctx, db, uuid.Nil); err != nil {
+			t.Fatalf("evento sem ID: esperado nil, recebeu %v", err)
+		}
+	}
+	if db.calls != before {
+		t.Fatal("evento sem ID não deveria ser registrado")
+	}
+}
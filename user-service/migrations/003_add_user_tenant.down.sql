@@ -0,0 +1,3 @@
+ALTER TABLE users DROP CONSTRAINT users_tenant_username_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+ALTER TABLE users DROP COLUMN tenant_id;
@@ -0,0 +1,7 @@
+-- réplicas anteriores ao multi-tenant pertencem à loja padrão da API
+ALTER TABLE users ADD COLUMN tenant_id UUID NOT NULL
+  DEFAULT '00000000-0000-0000-0000-000000000001';
+
+-- o mesmo username pode existir em lojas diferentes
+ALTER TABLE users DROP CONSTRAINT users_username_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_username_key UNIQUE (tenant_id, username);
@@ -0,0 +1,5 @@
+-- Eventos já aplicados, para descartar as reentregas (a entrega é "pelo menos uma vez")
+CREATE TABLE processed_events (
+  event_id UUID PRIMARY KEY,
+  processed_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,2 @@
+-- Usado pelo expurgo dos eventos processados
+CREATE INDEX processed_events_processed_at_idx ON processed_events (processed_at);
@@ -0,0 +1,4 @@
+-- Marca as réplicas cujo id foi gerado aqui, por eventos sem o id da API; só elas podem
+-- trocar de id. As já existentes podem ser dessas, então começam marcadas.
+ALTER TABLE users ADD COLUMN local_id BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ALTER COLUMN local_id SET DEFAULT FALSE;